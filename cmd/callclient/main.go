@@ -0,0 +1,68 @@
+// Command callclient joins a consultation's video call signaling socket from
+// the terminal, for trying out signaling without a browser. Run one as the
+// user and one as the professional:
+//
+//	go run ./cmd/callclient -request 42 -token <JWT>
+//
+// Each line typed is sent as a frame, e.g. {"type": "offer", "sdp": "v=0 ..."},
+// and every frame received is printed.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fasthttp/websocket"
+)
+
+func main() {
+	server := flag.String("server", "ws://localhost:3000/api", "API base URL")
+	requestID := flag.Int("request", 0, "consultation request ID")
+	token := flag.String("token", os.Getenv("TOKEN"), "JWT of the user or professional (default $TOKEN)")
+	flag.Parse()
+
+	if *requestID == 0 || *token == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	url := fmt.Sprintf("%s/consultationrequests/%d/call", strings.TrimSuffix(*server, "/"), *requestID)
+	header := http.Header{"Authorization": {"Bearer " + *token}}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		if resp != nil {
+			log.Fatalf("Failed to join the call: %s (%s)", err, resp.Status)
+		}
+		log.Fatalf("Failed to join the call: %s", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
+				log.Fatalf("Failed to send: %s", err)
+			}
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "leave"}`))
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("Disconnected: %s", err)
+			return
+		}
+		fmt.Println(string(data))
+	}
+}
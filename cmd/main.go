@@ -2,9 +2,11 @@ package main
 
 import (
 	_ "gofiber-mongodb/docs" // swagger docs
+	"gofiber-mongodb/handlers"
 	"gofiber-mongodb/routes"
 	"gofiber-mongodb/server/database"
 	"log"
+	_ "time/tzdata" // time zones for availability calendars
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -27,7 +29,10 @@ import (
 // @host localhost:3000
 // @BasePath /api
 func main() {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// Leave room for image uploads plus multipart overhead
+		BodyLimit: 10 * 1024 * 1024,
+	})
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "http://localhost:3001", // Change to your allowed origin
@@ -35,8 +40,13 @@ func main() {
 	}))
 
 	database.ConnectDB()
+	database.ConnectKMS()
+	database.EnsureIndexes()
 	routes.SetupRoutes(app)
 
+	go handlers.WatchCohortBoards()
+	go handlers.RunScheduler()
+
 	// Swagger route
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
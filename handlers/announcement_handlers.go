@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"gofiber-mongodb/server/markdown"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateAnnouncement godoc
+// @Summary Create a site-wide announcement
+// @Description Post an announcement shown to everyone until it expires or they dismiss it. Moderators only.
+// @Tags announcements
+// @Accept  json
+// @Produce  json
+// @Param announcement body models.Announcement true "Announcement payload: title, content (Markdown) and optional expiresAt"
+// @Success 200 {object} models.Announcement
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /announcements [post]
+func CreateAnnouncement(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("announcements")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var announcement models.Announcement
+	if err := c.BodyParser(&announcement); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	announcement.Title = strings.TrimSpace(announcement.Title)
+	if announcement.Title == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Title is required"})
+	}
+	if err := checkLength("Title", announcement.Title, models.MaxAnnouncementTitleLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if strings.TrimSpace(announcement.Content) == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Content is required"})
+	}
+	if err := checkLength("Content", announcement.Content, models.MaxAnnouncementContentLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if !announcement.ExpiresAt.IsZero() && !announcement.ExpiresAt.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Expiry must be in the future"})
+	}
+
+	announcement.ID = primitive.NilObjectID
+	announcement.ContentHTML = markdown.Render(announcement.Content)
+	announcement.CreatedBy = user.ID
+	announcement.CreatedAt = time.Now()
+
+	result, err := collection.InsertOne(ctx, announcement)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	announcement.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditCreateAnnouncement,
+		TargetType: "announcement",
+		TargetName: announcement.Title,
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	return c.Status(http.StatusOK).JSON(announcement)
+}
+
+// GetAnnouncements godoc
+// @Summary List announcements
+// @Description List current announcements, newest first. Signed-in users and professionals do not see ones they dismissed.
+// @Tags announcements
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.Announcement
+// @Failure 500 {object} map[string]string
+// @Router /announcements [get]
+func GetAnnouncements(c *fiber.Ctx) error {
+	collection := database.GetCollection("announcements")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"$or": []bson.M{
+			{"expiresAt": bson.M{"$exists": false}},
+			{"expiresAt": bson.M{"$gt": time.Now()}},
+		},
+	}
+
+	user, prof := optionalCaller(c)
+	if user.ID != "" || prof.ProfID != 0 {
+		dismissed, err := database.GetCollection("announcementDismissals").Distinct(ctx, "announcementID", memberFilter(user, prof))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		if len(dismissed) > 0 {
+			filter["_id"] = bson.M{"$nin": dismissed}
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	announcements := []models.Announcement{}
+	if err := cursor.All(ctx, &announcements); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(announcements)
+}
+
+// DismissAnnouncement godoc
+// @Summary Dismiss an announcement
+// @Description Hide an announcement for the authenticated user or professional
+// @Tags announcements
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Announcement ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /announcements/{id}/dismiss [post]
+func DismissAnnouncement(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid announcement ID"})
+	}
+
+	count, err := database.GetCollection("announcements").CountDocuments(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if count == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Announcement not found"})
+	}
+
+	// Dismissing twice keeps the first dismissal
+	filter := memberFilter(user, prof)
+	filter["announcementID"] = objID
+	fields := bson.M{"announcementID": objID, "dismissedAt": time.Now()}
+	if prof.ProfID != 0 {
+		fields["profID"] = prof.ProfID
+	} else {
+		fields["userID"] = user.ID
+	}
+	update := bson.M{"$setOnInsert": fields}
+
+	_, err = database.GetCollection("announcementDismissals").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Announcement dismissed"})
+}
+
+// DeleteAnnouncement godoc
+// @Summary Delete an announcement
+// @Description Take down an announcement for everyone. Moderators only.
+// @Tags announcements
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Announcement ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /announcements/{id} [delete]
+func DeleteAnnouncement(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("announcements")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid announcement ID"})
+	}
+
+	var announcement models.Announcement
+	if err := collection.FindOneAndDelete(ctx, bson.M{"_id": objID}).Decode(&announcement); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Announcement not found"})
+	}
+
+	if _, err := database.GetCollection("announcementDismissals").DeleteMany(ctx, bson.M{"announcementID": objID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditDeleteAnnouncement,
+		TargetType: "announcement",
+		TargetName: announcement.Title,
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Announcement deleted"})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var pseudonymAdjectives = []string{
+	"Gentle", "Brave", "Quiet", "Sunny", "Calm", "Kind", "Bright", "Hopeful",
+	"Steady", "Warm", "Clever", "Patient", "Cheerful", "Curious", "Graceful", "Humble",
+}
+
+var pseudonymNouns = []string{
+	"Otter", "Wren", "Fern", "Willow", "Robin", "Maple", "Finch", "Koala",
+	"Lark", "Clover", "Dove", "Wattle", "Banksia", "Possum", "Heron", "Juniper",
+}
+
+// threadPseudonym derives the name an anonymous user goes by within one thread.
+// It is stable for the same user and post, differs between threads, and cannot
+// be reversed without the server secret.
+func threadPseudonym(postID int, userID string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	fmt.Fprintf(mac, "%d:%s", postID, userID)
+	sum := mac.Sum(nil)
+
+	adjective := pseudonymAdjectives[int(sum[0])%len(pseudonymAdjectives)]
+	noun := pseudonymNouns[int(sum[1])%len(pseudonymNouns)]
+	number := binary.BigEndian.Uint16(sum[2:4]) % 100
+
+	return fmt.Sprintf("%s %s %02d", adjective, noun, number)
+}
+
+// recordAnonymousAuthor stores the real author of an anonymous post or comment.
+func recordAnonymousAuthor(ctx context.Context, postID, commentID int, userID string) error {
+	_, err := database.GetCollection("anonymousAuthors").InsertOne(ctx, models.AnonymousAuthor{
+		PostID:    postID,
+		CommentID: commentID,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+// anonymousAuthorID looks up the real author of an anonymous post (commentID 0) or comment.
+func anonymousAuthorID(ctx context.Context, postID, commentID int) (string, error) {
+	filter := bson.M{"postID": postID, "commentID": bson.M{"$exists": false}}
+	if commentID != 0 {
+		filter = bson.M{"postID": postID, "commentID": commentID}
+	}
+
+	var author models.AnonymousAuthor
+	if err := database.GetCollection("anonymousAuthors").FindOne(ctx, filter).Decode(&author); err != nil {
+		return "", err
+	}
+
+	return author.UserID, nil
+}
+
+// postAuthorID returns the user who wrote post, looking through anonymity.
+func postAuthorID(ctx context.Context, post models.Post) (string, error) {
+	if !post.Anonymous {
+		return post.UserID, nil
+	}
+	return anonymousAuthorID(ctx, post.PostID, 0)
+}
+
+// commentAuthorID returns the user who wrote comment, looking through anonymity.
+func commentAuthorID(ctx context.Context, comment models.Comment) (string, error) {
+	if !comment.Anonymous {
+		return comment.UserID, nil
+	}
+	return anonymousAuthorID(ctx, comment.PostID, comment.CommentID)
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"gofiber-mongodb/server/imaging"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// attachmentBucket is the GridFS bucket holding image and thumbnail data.
+const attachmentBucket = "attachments"
+
+// claimAttachments checks that the caller uploaded every attachment in ids and
+// that none is in use yet, returning their object IDs for linkAttachments.
+func claimAttachments(ctx context.Context, ids []string, userID string, profID int) ([]primitive.ObjectID, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if len(ids) > models.MaxAttachmentsPerItem {
+		return nil, fmt.Errorf("At most %d images can be attached", models.MaxAttachmentsPerItem)
+	}
+
+	objIDs := make([]primitive.ObjectID, 0, len(ids))
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, errors.New("Invalid attachment ID")
+		}
+		if !seen[objID] {
+			seen[objID] = true
+			objIDs = append(objIDs, objID)
+		}
+	}
+
+	filter := bson.M{
+		"_id":    bson.M{"$in": objIDs},
+		"postID": bson.M{"$exists": false},
+	}
+	if profID != 0 {
+		filter["profID"] = profID
+	} else {
+		filter["userID"] = userID
+	}
+
+	count, err := database.GetCollection("attachments").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if int(count) != len(objIDs) {
+		return nil, errors.New("Attachments must be your own unused uploads")
+	}
+
+	return objIDs, nil
+}
+
+// linkAttachments records which post, or comment on it, uses the attachments.
+func linkAttachments(ctx context.Context, objIDs []primitive.ObjectID, postID, commentID int) error {
+	if len(objIDs) == 0 {
+		return nil
+	}
+
+	set := bson.M{"postID": postID}
+	if commentID != 0 {
+		set["commentID"] = commentID
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": objIDs}, "postID": bson.M{"$exists": false}}
+	_, err := database.GetCollection("attachments").UpdateMany(ctx, filter, bson.M{"$set": set})
+	return err
+}
+
+// hexIDs converts object IDs to the hex strings stored on posts and comments.
+func hexIDs(objIDs []primitive.ObjectID) []string {
+	var ids []string
+	for _, objID := range objIDs {
+		ids = append(ids, objID.Hex())
+	}
+	return ids
+}
+
+// deleteAttachments removes the attachments matching filter and their files.
+func deleteAttachments(ctx context.Context, filter bson.M) error {
+	collection := database.GetCollection("attachments")
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var attachments []models.Attachment
+	if err := cursor.All(ctx, &attachments); err != nil {
+		return err
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	bucket, err := database.GetBucket(attachmentBucket)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		for _, fileID := range []primitive.ObjectID{attachment.FileID, attachment.ThumbnailID} {
+			if err := bucket.Delete(fileID); err != nil {
+				log.Printf("Failed to delete file %s of attachment %s: %s", fileID.Hex(), attachment.ID.Hex(), err)
+			}
+		}
+	}
+
+	_, err = collection.DeleteMany(ctx, filter)
+	return err
+}
+
+// canViewAttachment reports whether the caller may download attachment.
+// Uploaders can always see their own images; anyone who can read the board can
+// see images on a post or comment that still exists.
+func canViewAttachment(ctx context.Context, attachment models.Attachment, user models.User, prof models.HealthCareProfessional) bool {
+	if prof.ProfID != 0 && attachment.ProfID == prof.ProfID {
+		return true
+	}
+	if user.ID != "" && attachment.UserID == user.ID {
+		return true
+	}
+	if attachment.PostID == 0 {
+		return false
+	}
+
+	if attachment.CommentID != 0 {
+		var comment models.Comment
+		err := database.GetCollection("comments").FindOne(ctx, bson.M{"commentID": attachment.CommentID}).Decode(&comment)
+		return err == nil && canAccessComment(ctx, comment, user, prof)
+	}
+	var post models.Post
+	err := database.GetCollection("posts").FindOne(ctx, bson.M{"postID": attachment.PostID}).Decode(&post)
+	return err == nil && canAccessPost(ctx, post, user, prof)
+}
+
+// UploadAttachment godoc
+// @Summary Upload an image
+// @Description Upload a JPEG, PNG or GIF image as multipart field "file". Metadata such as EXIF and GPS is stripped
+// @Description and a thumbnail is generated. Reference the returned ID when creating a post or comment.
+// @Tags attachments
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param file formData file true "Image file"
+// @Success 200 {object} models.Attachment
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /attachments [post]
+func UploadAttachment(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("attachments")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "An image file is required"})
+	}
+	if header.Size > models.MaxAttachmentSize {
+		return c.Status(http.StatusRequestEntityTooLarge).JSON(map[string]string{"error": fmt.Sprintf("Images must be at most %d MB", models.MaxAttachmentSize>>20)})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxAttachmentSize+1))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if len(data) > models.MaxAttachmentSize {
+		return c.Status(http.StatusRequestEntityTooLarge).JSON(map[string]string{"error": fmt.Sprintf("Images must be at most %d MB", models.MaxAttachmentSize>>20)})
+	}
+
+	result, err := imaging.Process(data)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	bucket, err := database.GetBucket(attachmentBucket)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	attachment := models.Attachment{
+		ID:                   primitive.NewObjectID(),
+		UserID:               user.ID,
+		ProfID:               prof.ProfID,
+		ContentType:          result.ContentType,
+		ThumbnailContentType: result.ThumbnailContentType,
+		Size:                 len(result.Data),
+		Width:                result.Width,
+		Height:               result.Height,
+		CreatedAt:            time.Now(),
+	}
+
+	// Stored file names are derived from the ID; the client's file name is not kept
+	attachment.FileID, err = bucket.UploadFromStream(attachment.ID.Hex(), bytes.NewReader(result.Data))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	attachment.ThumbnailID, err = bucket.UploadFromStream(attachment.ID.Hex()+"-thumb", bytes.NewReader(result.Thumbnail))
+	if err != nil {
+		bucket.Delete(attachment.FileID)
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if _, err := collection.InsertOne(ctx, attachment); err != nil {
+		bucket.Delete(attachment.FileID)
+		bucket.Delete(attachment.ThumbnailID)
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(attachment)
+}
+
+// sendAttachment writes an attachment's image, or its thumbnail, to the response.
+func sendAttachment(c *fiber.Ctx, thumbnail bool) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("attachments")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid attachment ID"})
+	}
+
+	// Attachments the caller may not see are reported as missing
+	var attachment models.Attachment
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&attachment); err != nil || !canViewAttachment(ctx, attachment, user, prof) {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Attachment not found"})
+	}
+
+	bucket, err := database.GetBucket(attachmentBucket)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	fileID, contentType := attachment.FileID, attachment.ContentType
+	if thumbnail {
+		fileID, contentType = attachment.ThumbnailID, attachment.ThumbnailContentType
+	}
+
+	var buf bytes.Buffer
+	if _, err := bucket.DownloadToStream(fileID, &buf); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	c.Set("X-Content-Type-Options", "nosniff")
+	return c.Status(http.StatusOK).Send(buf.Bytes())
+}
+
+// GetAttachment godoc
+// @Summary Download an image
+// @Description Download an attached image. Uploaders can always see their images; others can once it is on a post or comment.
+// @Tags attachments
+// @Produce  image/jpeg,image/png,image/gif
+// @Param id path string true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /attachments/{id} [get]
+func GetAttachment(c *fiber.Ctx) error {
+	return sendAttachment(c, false)
+}
+
+// GetAttachmentThumbnail godoc
+// @Summary Download an image thumbnail
+// @Description Download the thumbnail of an attached image, with the same access rules as the image
+// @Tags attachments
+// @Produce  image/jpeg,image/png
+// @Param id path string true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /attachments/{id}/thumbnail [get]
+func GetAttachmentThumbnail(c *fiber.Ctx) error {
+	return sendAttachment(c, true)
+}
+
+// DeleteAttachment godoc
+// @Summary Delete an unused upload
+// @Description Delete an image the caller uploaded but has not attached to a post or comment
+// @Tags attachments
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Attachment ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /attachments/{id} [delete]
+func DeleteAttachment(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("attachments")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid attachment ID"})
+	}
+
+	filter := bson.M{"_id": id, "postID": bson.M{"$exists": false}}
+	if prof.ProfID != 0 {
+		filter["profID"] = prof.ProfID
+	} else {
+		filter["userID"] = user.ID
+	}
+
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if count == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Attachment not found"})
+	}
+
+	if err := deleteAttachments(ctx, filter); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Attachment deleted"})
+}
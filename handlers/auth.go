@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// roleProfessional is the "role" claim carried by tokens issued to healthcare professionals.
+const roleProfessional = "professional"
+
+// errUserNotFound is returned when a valid token refers to a user that no longer exists.
+var errUserNotFound = errors.New("User not found")
+
+// errProfessionalNotFound is returned when a valid token refers to a professional that no longer exists.
+var errProfessionalNotFound = errors.New("Professional not found")
+
+// tokenClaims parses and validates the bearer token on the request.
+func tokenClaims(c *fiber.Ctx) (jwt.MapClaims, error) {
+	// Extract the token from the Authorization header
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return nil, errors.New("Missing or malformed JWT")
+	}
+
+	splitToken := strings.Split(authHeader, "Bearer ")
+	if len(splitToken) != 2 {
+		return nil, errors.New("Malformed JWT")
+	}
+
+	return parseToken(splitToken[1])
+}
+
+// parseToken validates a raw JWT string and returns its claims.
+func parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(os.Getenv("SECRET")), nil
+	})
+	if err != nil {
+		return nil, errors.New("Invalid or expired JWT")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("Invalid or expired JWT")
+	}
+
+	return claims, nil
+}
+
+// currentUser loads the user identified by the "email" claim of the bearer token.
+func currentUser(c *fiber.Ctx) (models.User, error) {
+	var user models.User
+
+	claims, err := tokenClaims(c)
+	if err != nil {
+		return user, err
+	}
+
+	// Professional tokens carry the professional's email, which must not
+	// be mistaken for a user account with the same address
+	if claims["role"] == roleProfessional {
+		return user, errors.New("User account required")
+	}
+
+	// Check if the "email" claim is present and is a string
+	email, ok := claims["email"].(string)
+	if !ok || email == "" {
+		return user, errors.New("Invalid JWT claims")
+	}
+
+	collection := database.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		return user, errUserNotFound
+	}
+
+	return user, nil
+}
+
+// isModerator reports whether the user may act on moderation tools.
+func isModerator(user models.User) bool {
+	return user.Role == models.RoleModerator || user.Role == models.RoleAdmin
+}
+
+// currentUserOrProfessional resolves the caller from whichever kind of token they present.
+// Exactly one of the returned user and professional is set when err is nil.
+func currentUserOrProfessional(c *fiber.Ctx) (models.User, models.HealthCareProfessional, error) {
+	var user models.User
+	var prof models.HealthCareProfessional
+	var err error
+	if isProfessionalToken(c) {
+		prof, err = currentProfessional(c)
+	} else {
+		user, err = currentUser(c)
+	}
+	return user, prof, err
+}
+
+// isProfessionalToken reports whether the bearer token was issued to a professional.
+func isProfessionalToken(c *fiber.Ctx) bool {
+	claims, err := tokenClaims(c)
+	return err == nil && claims["role"] == roleProfessional
+}
+
+// currentProfessional loads the professional identified by the "profID" claim of the bearer token.
+func currentProfessional(c *fiber.Ctx) (models.HealthCareProfessional, error) {
+	var prof models.HealthCareProfessional
+
+	claims, err := tokenClaims(c)
+	if err != nil {
+		return prof, err
+	}
+
+	if claims["role"] != roleProfessional {
+		return prof, errors.New("Professional account required")
+	}
+
+	// JSON numbers are decoded as float64
+	profID, ok := claims["profID"].(float64)
+	if !ok || profID == 0 {
+		return prof, errors.New("Invalid JWT claims")
+	}
+
+	collection := database.GetCollection("professionals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := collection.FindOne(ctx, bson.M{"profID": int(profID)}).Decode(&prof); err != nil {
+		return prof, errProfessionalNotFound
+	}
+
+	return prof, nil
+}
@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxSlotDays bounds how many days of slots one request can list.
+const maxSlotDays = 31
+
+// interval is a half-open stretch of time [start, end).
+type interval struct {
+	start, end time.Time
+}
+
+// parseClock reads a "15:04" time of day as minutes past midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("Times must be in HH:MM form, got %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validateAvailability checks a schedule submitted by a professional and
+// fills in defaults.
+func validateAvailability(availability *models.Availability) error {
+	availability.TimeZone = strings.TrimSpace(availability.TimeZone)
+	if availability.TimeZone == "" {
+		return errors.New("Time zone is required")
+	}
+	if _, err := time.LoadLocation(availability.TimeZone); err != nil {
+		return fmt.Errorf("Unknown time zone %q", availability.TimeZone)
+	}
+
+	for _, window := range availability.Weekly {
+		if window.Weekday < 0 || window.Weekday > 6 {
+			return errors.New("Weekday must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return err
+		}
+		if start >= end {
+			return errors.New("Each window must end after it starts")
+		}
+	}
+
+	if availability.SlotMinutes == 0 {
+		availability.SlotMinutes = models.DefaultSlotMinutes
+	}
+	if availability.SlotMinutes < models.MinSlotMinutes || availability.SlotMinutes > models.MaxSlotMinutes {
+		return fmt.Errorf("Slot length must be between %d and %d minutes", models.MinSlotMinutes, models.MaxSlotMinutes)
+	}
+	if availability.BufferMinutes < 0 || availability.BufferMinutes > models.MaxBufferMinutes {
+		return fmt.Errorf("Buffer must be between 0 and %d minutes", models.MaxBufferMinutes)
+	}
+	return nil
+}
+
+// findAvailability loads a professional's schedule.
+func findAvailability(ctx context.Context, profID int) (models.Availability, error) {
+	var availability models.Availability
+	err := database.GetCollection("availability").FindOne(ctx, bson.M{"profID": profID}).Decode(&availability)
+	return availability, err
+}
+
+// mergeIntervals sorts intervals and joins any that overlap or touch.
+func mergeIntervals(intervals []interval) []interval {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start.Before(intervals[j].start) })
+
+	var merged []interval
+	for _, iv := range intervals {
+		if n := len(merged); n > 0 && !iv.start.After(merged[n-1].end) {
+			if iv.end.After(merged[n-1].end) {
+				merged[n-1].end = iv.end
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// subtractIntervals removes every block from intervals.
+func subtractIntervals(intervals, blocks []interval) []interval {
+	for _, block := range blocks {
+		var kept []interval
+		for _, iv := range intervals {
+			if !block.start.Before(iv.end) || !block.end.After(iv.start) {
+				kept = append(kept, iv)
+				continue
+			}
+			if block.start.After(iv.start) {
+				kept = append(kept, interval{iv.start, block.start})
+			}
+			if block.end.Before(iv.end) {
+				kept = append(kept, interval{block.end, iv.end})
+			}
+		}
+		intervals = kept
+	}
+	return intervals
+}
+
+// workingIntervals lists when a professional works between from and to: their
+// weekly windows plus extra time, minus leave.
+func workingIntervals(ctx context.Context, availability models.Availability, from, to time.Time) ([]interval, error) {
+	filter := bson.M{"profID": availability.ProfID, "start": bson.M{"$lt": to}, "end": bson.M{"$gt": from}}
+	cursor, err := database.GetCollection("availabilityExceptions").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var exceptions []models.AvailabilityException
+	if err := cursor.All(ctx, &exceptions); err != nil {
+		return nil, err
+	}
+
+	return openIntervals(availability, exceptions, from, to)
+}
+
+// openIntervals lays out a professional's weekly windows between from and to,
+// adds the extra time and removes the leave among exceptions. Windows are laid
+// out in the schedule's own time zone, so they keep their wall-clock times
+// across daylight saving changes.
+func openIntervals(availability models.Availability, exceptions []models.AvailabilityException, from, to time.Time) ([]interval, error) {
+	loc, err := time.LoadLocation(availability.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	var open []interval
+	localFrom := from.In(loc)
+	day := time.Date(localFrom.Year(), localFrom.Month(), localFrom.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, window := range availability.Weekly {
+			if time.Weekday(window.Weekday) != day.Weekday() {
+				continue
+			}
+			start, _ := parseClock(window.Start)
+			end, _ := parseClock(window.End)
+			open = append(open, interval{
+				start: time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc),
+				end:   time.Date(day.Year(), day.Month(), day.Day(), end/60, end%60, 0, 0, loc),
+			})
+		}
+	}
+
+	var leave []interval
+	for _, exception := range exceptions {
+		if exception.Available {
+			open = append(open, interval{exception.Start, exception.End})
+		} else {
+			leave = append(leave, interval{exception.Start, exception.End})
+		}
+	}
+
+	open = subtractIntervals(mergeIntervals(open), leave)
+	return subtractIntervals(open, []interval{{time.Time{}, from}, {to, to.AddDate(1, 0, 0)}}), nil
+}
+
+// generateSlots cuts a professional's free time between from and to into
+// slots of the given length, keeping their buffer clear around every active
+// booking and between consecutive slots. Slots in the past are left out.
+func generateSlots(ctx context.Context, availability models.Availability, from, to time.Time, minutes int) ([]models.Slot, error) {
+	open, err := workingIntervals(ctx, availability, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := time.Duration(availability.BufferMinutes) * time.Minute
+	filter := bson.M{
+		"profID": availability.ProfID,
+		"status": models.BookingActive,
+		"start":  bson.M{"$lt": to.Add(buffer)},
+		"end":    bson.M{"$gt": from.Add(-buffer)},
+	}
+	cursor, err := database.GetCollection("bookings").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var bookings []models.Booking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return nil, err
+	}
+
+	return freeSlots(availability, open, bookings, minutes), nil
+}
+
+// freeSlots cuts open into slots of the given length that keep the
+// professional's buffer clear of bookings. Slots in the past are left out.
+func freeSlots(availability models.Availability, open []interval, bookings []models.Booking, minutes int) []models.Slot {
+	length := time.Duration(minutes) * time.Minute
+	buffer := time.Duration(availability.BufferMinutes) * time.Minute
+
+	now := time.Now()
+	slots := []models.Slot{}
+	for _, iv := range open {
+		for start := iv.start; !start.Add(length).After(iv.end); start = start.Add(length + buffer) {
+			end := start.Add(length)
+			if start.Before(now) {
+				continue
+			}
+
+			free := true
+			for _, booking := range bookings {
+				if booking.Start.Before(end.Add(buffer)) && booking.End.Add(buffer).After(start) {
+					free = false
+					break
+				}
+			}
+			if free {
+				slots = append(slots, models.Slot{Start: start.UTC(), End: end.UTC()})
+			}
+		}
+	}
+	return slots
+}
+
+// bookSlot reserves the slot starting at start on the calendar of request's
+// professional. minutes of 0 uses the professional's default slot length.
+// On failure it returns the HTTP status to respond with.
+//
+// The booking is written before the calendar's booking version is bumped,
+// and withdrawn if another booking bumped it first, so two bookings checked
+// against the same calendar can never both stand.
+func bookSlot(ctx context.Context, request models.ConsultationRequests, start time.Time, minutes int) (models.Booking, int, error) {
+	var booking models.Booking
+
+	availability, err := findAvailability(ctx, request.ProfID)
+	if err != nil {
+		return booking, http.StatusConflict, errors.New("This professional has not published their availability")
+	}
+	if minutes == 0 {
+		minutes = availability.SlotMinutes
+	}
+	if minutes < models.MinSlotMinutes || minutes > models.MaxSlotMinutes {
+		return booking, http.StatusBadRequest, fmt.Errorf("Consultation length must be between %d and %d minutes", models.MinSlotMinutes, models.MaxSlotMinutes)
+	}
+
+	// Slots are generated from the start of the day so the requested time is
+	// checked against the same grid the slot listing shows
+	loc, err := time.LoadLocation(availability.TimeZone)
+	if err != nil {
+		return booking, http.StatusInternalServerError, err
+	}
+	local := start.In(loc)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	slots, err := generateSlots(ctx, availability, dayStart, dayStart.AddDate(0, 0, 1), minutes)
+	if err != nil {
+		return booking, http.StatusInternalServerError, err
+	}
+
+	offered := false
+	for _, slot := range slots {
+		if slot.Start.Equal(start) {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		return booking, http.StatusConflict, errors.New("That slot is not available")
+	}
+
+	bookings := database.GetCollection("bookings")
+	booking = models.Booking{
+		ProfID:    request.ProfID,
+		UserID:    request.UserID,
+		RequestID: request.RequestID,
+		Start:     start.UTC(),
+		End:       start.Add(time.Duration(minutes) * time.Minute).UTC(),
+		Status:    models.BookingActive,
+		CreatedAt: time.Now(),
+	}
+	result, err := bookings.InsertOne(ctx, booking)
+	if err != nil {
+		return booking, http.StatusInternalServerError, err
+	}
+	booking.ID = result.InsertedID.(primitive.ObjectID)
+
+	filter := bson.M{"profID": request.ProfID, "bookingVersion": availability.BookingVersion}
+	claim, err := database.GetCollection("availability").UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"bookingVersion": 1}})
+	if err != nil || claim.MatchedCount == 0 {
+		if _, err := bookings.DeleteOne(ctx, bson.M{"_id": booking.ID}); err != nil {
+			log.Printf("Failed to withdraw booking %s: %s", booking.ID.Hex(), err)
+		}
+		return booking, http.StatusConflict, errors.New("Someone else just booked this professional, please pick a slot again")
+	}
+
+	return booking, http.StatusOK, nil
+}
+
+// releaseBookings frees the calendar time held for a consultation request,
+// except for the booking keep, which may be zero.
+func releaseBookings(ctx context.Context, requestID int, keep primitive.ObjectID) error {
+	filter := bson.M{"requestID": requestID, "status": models.BookingActive}
+	if !keep.IsZero() {
+		filter["_id"] = bson.M{"$ne": keep}
+	}
+	_, err := database.GetCollection("bookings").UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": models.BookingReleased}})
+	return err
+}
+
+// SetAvailability godoc
+// @Summary Set weekly availability
+// @Description Replace the authenticated professional's weekly schedule. Windows are given per weekday (0 is Sunday)
+// @Description as HH:MM times in timeZone. slotMinutes is the default consultation length and bufferMinutes the gap
+// @Description kept between appointments.
+// @Tags availability
+// @Accept  json
+// @Produce  json
+// @Param availability body models.Availability true "Availability payload"
+// @Success 200 {object} models.Availability
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/availability [put]
+func SetAvailability(c *fiber.Ctx) error {
+	prof, err := currentProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("availability")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var availability models.Availability
+	if err := c.BodyParser(&availability); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if err := validateAvailability(&availability); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if availability.Weekly == nil {
+		availability.Weekly = []models.AvailabilityWindow{}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"timeZone":      availability.TimeZone,
+			"weekly":        availability.Weekly,
+			"slotMinutes":   availability.SlotMinutes,
+			"bufferMinutes": availability.BufferMinutes,
+			"updatedAt":     time.Now(),
+		},
+		"$setOnInsert": bson.M{"bookingVersion": 0},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"profID": prof.ProfID}, update, opts).Decode(&availability); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(availability)
+}
+
+// GetAvailability godoc
+// @Summary Get a professional's weekly availability
+// @Description Get the weekly schedule a professional has published
+// @Tags availability
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Professional ID"
+// @Success 200 {object} models.Availability
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /professionals/{id}/availability [get]
+func GetAvailability(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid professional ID"})
+	}
+
+	availability, err := findAvailability(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "This professional has not published their availability"})
+	}
+
+	return c.Status(http.StatusOK).JSON(availability)
+}
+
+// CreateAvailabilityException godoc
+// @Summary Add leave or extra working time
+// @Description Block out time (available false), such as leave, or open extra time (available true) on the
+// @Description authenticated professional's calendar. Existing bookings are not affected.
+// @Tags availability
+// @Accept  json
+// @Produce  json
+// @Param exception body models.AvailabilityException true "Exception payload"
+// @Success 200 {object} models.AvailabilityException
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/availability/exceptions [post]
+func CreateAvailabilityException(c *fiber.Ctx) error {
+	prof, err := currentProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("availabilityExceptions")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var exception models.AvailabilityException
+	if err := c.BodyParser(&exception); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if exception.Start.IsZero() || !exception.End.After(exception.Start) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "An exception needs a start and an end after it"})
+	}
+	if !exception.End.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "An exception must end in the future"})
+	}
+	exception.Reason = strings.TrimSpace(exception.Reason)
+	if err := checkLength("Reason", exception.Reason, maxReasonLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	exception.ID = primitive.NilObjectID
+	exception.ProfID = prof.ProfID
+
+	result, err := collection.InsertOne(ctx, exception)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	exception.ID = result.InsertedID.(primitive.ObjectID)
+
+	return c.Status(http.StatusOK).JSON(exception)
+}
+
+// GetAvailabilityExceptions godoc
+// @Summary List leave and extra working time
+// @Description List the authenticated professional's exceptions that have not ended yet, soonest first
+// @Tags availability
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.AvailabilityException
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/availability/exceptions [get]
+func GetAvailabilityExceptions(c *fiber.Ctx) error {
+	prof, err := currentProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("availabilityExceptions")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"profID": prof.ProfID, "end": bson.M{"$gt": time.Now()}}
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	exceptions := []models.AvailabilityException{}
+	if err := cursor.All(ctx, &exceptions); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(exceptions)
+}
+
+// DeleteAvailabilityException godoc
+// @Summary Remove leave or extra working time
+// @Description Remove one of the authenticated professional's exceptions
+// @Tags availability
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Exception ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/availability/exceptions/{id} [delete]
+func DeleteAvailabilityException(c *fiber.Ctx) error {
+	prof, err := currentProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("availabilityExceptions")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid exception ID"})
+	}
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": objID, "profID": prof.ProfID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Exception not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Exception deleted"})
+}
+
+// GetSlots godoc
+// @Summary List bookable slots
+// @Description List a professional's free slots, in UTC, for the days starting at from (a date in the professional's
+// @Description time zone). Book one by scheduling an accepted consultation request at its start time.
+// @Tags availability
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Professional ID"
+// @Param from query string false "First day, YYYY-MM-DD (default today)"
+// @Param days query int false "Number of days (default 7, max 31)"
+// @Param length query int false "Consultation length in minutes (default the professional's slot length)"
+// @Success 200 {array} models.Slot
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/{id}/slots [get]
+func GetSlots(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid professional ID"})
+	}
+
+	availability, err := findAvailability(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "This professional has not published their availability"})
+	}
+	loc, err := time.LoadLocation(availability.TimeZone)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if s := c.Query("from"); s != "" {
+		if from, err = time.ParseInLocation("2006-01-02", s, loc); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "From must be a date in YYYY-MM-DD form"})
+		}
+	}
+
+	days := c.QueryInt("days", 7)
+	if days <= 0 {
+		days = 7
+	}
+	if days > maxSlotDays {
+		days = maxSlotDays
+	}
+
+	minutes := c.QueryInt("length", availability.SlotMinutes)
+	if minutes < models.MinSlotMinutes || minutes > models.MaxSlotMinutes {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": fmt.Sprintf("Length must be between %d and %d minutes", models.MinSlotMinutes, models.MaxSlotMinutes)})
+	}
+
+	slots, err := generateSlots(ctx, availability, from, from.AddDate(0, 0, days), minutes)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(slots)
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// at parses a "2006-01-02 15:04" wall-clock time in zone.
+func at(t *testing.T, zone, value string) time.Time {
+	t.Helper()
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func sameIntervals(got, want []interval) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].start.Equal(want[i].start) || !got[i].end.Equal(want[i].end) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOpenIntervals(t *testing.T) {
+	const sydney = "Australia/Sydney"
+	const newYork = "America/New_York"
+	const utc = "UTC"
+
+	// 2027-03-01 is a Monday
+	weekdays := []models.AvailabilityWindow{
+		{Weekday: 1, Start: "09:00", End: "12:00"},
+		{Weekday: 2, Start: "09:00", End: "17:00"},
+	}
+
+	tests := []struct {
+		name       string
+		zone       string
+		weekly     []models.AvailabilityWindow
+		exceptions []models.AvailabilityException
+		from, to   string
+		want       [][2]string
+	}{
+		{
+			name:   "weekly windows in the schedule's zone",
+			zone:   sydney,
+			weekly: weekdays,
+			from:   "2027-03-01 00:00",
+			to:     "2027-03-08 00:00",
+			want:   [][2]string{{"2027-03-01 09:00", "2027-03-01 12:00"}, {"2027-03-02 09:00", "2027-03-02 17:00"}},
+		},
+		{
+			name:   "clipped to from and to",
+			zone:   sydney,
+			weekly: weekdays,
+			from:   "2027-03-01 10:00",
+			to:     "2027-03-02 12:00",
+			want:   [][2]string{{"2027-03-01 10:00", "2027-03-01 12:00"}, {"2027-03-02 09:00", "2027-03-02 12:00"}},
+		},
+		{
+			name:   "windows keep their wall-clock times when clocks go forward",
+			zone:   newYork,
+			weekly: []models.AvailabilityWindow{{Weekday: 0, Start: "09:00", End: "12:00"}},
+			from:   "2027-03-07 00:00",
+			to:     "2027-03-15 00:00",
+			want:   [][2]string{{"2027-03-07 09:00", "2027-03-07 12:00"}, {"2027-03-14 09:00", "2027-03-14 12:00"}},
+		},
+		{
+			name:   "a window across the skipped hour is an hour shorter",
+			zone:   newYork,
+			weekly: []models.AvailabilityWindow{{Weekday: 0, Start: "01:00", End: "04:00"}},
+			from:   "2027-03-14 00:00",
+			to:     "2027-03-15 00:00",
+			want:   [][2]string{{"2027-03-14 01:00", "2027-03-14 04:00"}},
+		},
+		{
+			name:   "windows keep their wall-clock times when clocks go back",
+			zone:   sydney,
+			weekly: []models.AvailabilityWindow{{Weekday: 0, Start: "01:00", End: "04:00"}},
+			from:   "2027-03-28 00:00",
+			to:     "2027-04-05 00:00",
+			want:   [][2]string{{"2027-03-28 01:00", "2027-03-28 04:00"}, {"2027-04-04 01:00", "2027-04-04 04:00"}},
+		},
+		{
+			name:   "leave overlapping two windows",
+			zone:   utc,
+			weekly: weekdays,
+			exceptions: []models.AvailabilityException{
+				{Start: at(t, utc, "2027-03-01 11:00"), End: at(t, utc, "2027-03-02 10:00")},
+			},
+			from: "2027-03-01 00:00",
+			to:   "2027-03-03 00:00",
+			want: [][2]string{{"2027-03-01 09:00", "2027-03-01 11:00"}, {"2027-03-02 10:00", "2027-03-02 17:00"}},
+		},
+		{
+			name:   "leave inside a window splits it",
+			zone:   utc,
+			weekly: weekdays,
+			exceptions: []models.AvailabilityException{
+				{Start: at(t, utc, "2027-03-02 12:00"), End: at(t, utc, "2027-03-02 13:00")},
+			},
+			from: "2027-03-02 00:00",
+			to:   "2027-03-03 00:00",
+			want: [][2]string{{"2027-03-02 09:00", "2027-03-02 12:00"}, {"2027-03-02 13:00", "2027-03-02 17:00"}},
+		},
+		{
+			name:   "leave covering a whole window",
+			zone:   utc,
+			weekly: weekdays,
+			exceptions: []models.AvailabilityException{
+				{Start: at(t, utc, "2027-03-01 08:00"), End: at(t, utc, "2027-03-01 13:00")},
+			},
+			from: "2027-03-01 00:00",
+			to:   "2027-03-02 00:00",
+			want: nil,
+		},
+		{
+			name:   "extra time touching a window joins it",
+			zone:   utc,
+			weekly: weekdays,
+			exceptions: []models.AvailabilityException{
+				{Start: at(t, utc, "2027-03-01 12:00"), End: at(t, utc, "2027-03-01 14:00"), Available: true},
+				{Start: at(t, utc, "2027-03-01 07:00"), End: at(t, utc, "2027-03-01 09:00"), Available: true},
+			},
+			from: "2027-03-01 00:00",
+			to:   "2027-03-02 00:00",
+			want: [][2]string{{"2027-03-01 07:00", "2027-03-01 14:00"}},
+		},
+		{
+			name:   "extra time on a day off",
+			zone:   utc,
+			weekly: weekdays,
+			exceptions: []models.AvailabilityException{
+				{Start: at(t, utc, "2027-03-06 10:00"), End: at(t, utc, "2027-03-06 12:00"), Available: true},
+			},
+			from: "2027-03-06 00:00",
+			to:   "2027-03-07 00:00",
+			want: [][2]string{{"2027-03-06 10:00", "2027-03-06 12:00"}},
+		},
+		{
+			name:   "leave wins over extra time",
+			zone:   utc,
+			weekly: weekdays,
+			exceptions: []models.AvailabilityException{
+				{Start: at(t, utc, "2027-03-01 12:00"), End: at(t, utc, "2027-03-01 14:00"), Available: true},
+				{Start: at(t, utc, "2027-03-01 11:00"), End: at(t, utc, "2027-03-01 13:00")},
+			},
+			from: "2027-03-01 00:00",
+			to:   "2027-03-02 00:00",
+			want: [][2]string{{"2027-03-01 09:00", "2027-03-01 11:00"}, {"2027-03-01 13:00", "2027-03-01 14:00"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			availability := models.Availability{TimeZone: tt.zone, Weekly: tt.weekly}
+			got, err := openIntervals(availability, tt.exceptions, at(t, tt.zone, tt.from), at(t, tt.zone, tt.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []interval
+			for _, w := range tt.want {
+				want = append(want, interval{at(t, tt.zone, w[0]), at(t, tt.zone, w[1])})
+			}
+			if !sameIntervals(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	const utc = "UTC"
+	const sydney = "Australia/Sydney"
+
+	tests := []struct {
+		name     string
+		zone     string
+		buffer   int
+		open     [][2]string
+		bookings [][2]string
+		minutes  int
+		want     []string
+	}{
+		{
+			name:    "back to back without a buffer",
+			zone:    utc,
+			open:    [][2]string{{"2027-03-01 09:00", "2027-03-01 11:00"}},
+			minutes: 30,
+			want:    []string{"2027-03-01 09:00", "2027-03-01 09:30", "2027-03-01 10:00", "2027-03-01 10:30"},
+		},
+		{
+			name:    "buffer between slots",
+			zone:    utc,
+			buffer:  15,
+			open:    [][2]string{{"2027-03-01 09:00", "2027-03-01 11:00"}},
+			minutes: 30,
+			want:    []string{"2027-03-01 09:00", "2027-03-01 09:45", "2027-03-01 10:30"},
+		},
+		{
+			name:    "a slot that does not fit is dropped",
+			zone:    utc,
+			open:    [][2]string{{"2027-03-01 09:00", "2027-03-01 09:50"}},
+			minutes: 30,
+			want:    []string{"2027-03-01 09:00"},
+		},
+		{
+			name:     "a booking may touch a slot without a buffer",
+			zone:     utc,
+			open:     [][2]string{{"2027-03-01 09:00", "2027-03-01 11:00"}},
+			bookings: [][2]string{{"2027-03-01 10:00", "2027-03-01 10:30"}},
+			minutes:  30,
+			want:     []string{"2027-03-01 09:00", "2027-03-01 09:30", "2027-03-01 10:30"},
+		},
+		{
+			name:     "buffer kept on both sides of a booking",
+			zone:     utc,
+			buffer:   15,
+			open:     [][2]string{{"2027-03-01 09:00", "2027-03-01 12:00"}},
+			bookings: [][2]string{{"2027-03-01 10:00", "2027-03-01 10:30"}},
+			minutes:  30,
+			want:     []string{"2027-03-01 09:00", "2027-03-01 11:15"},
+		},
+		{
+			name:     "buffer reaches a booking outside the open time",
+			zone:     utc,
+			buffer:   30,
+			open:     [][2]string{{"2027-03-01 09:00", "2027-03-01 10:30"}},
+			bookings: [][2]string{{"2027-03-01 08:00", "2027-03-01 08:45"}},
+			minutes:  30,
+			want:     []string{"2027-03-01 10:00"},
+		},
+		{
+			name:    "slots across the day clocks go back are a real hour apart",
+			zone:    sydney,
+			open:    [][2]string{{"2027-04-04 01:00", "2027-04-04 04:00"}},
+			minutes: 60,
+			want:    []string{"2027-04-03 14:00", "2027-04-03 15:00", "2027-04-03 16:00", "2027-04-03 17:00"},
+		},
+		{
+			name:    "slots in the past are left out",
+			zone:    utc,
+			open:    [][2]string{{"2020-03-02 09:00", "2020-03-02 11:00"}},
+			minutes: 30,
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			availability := models.Availability{TimeZone: tt.zone, BufferMinutes: tt.buffer}
+
+			var open []interval
+			for _, o := range tt.open {
+				open = append(open, interval{at(t, tt.zone, o[0]), at(t, tt.zone, o[1])})
+			}
+			var bookings []models.Booking
+			for _, b := range tt.bookings {
+				bookings = append(bookings, models.Booking{Start: at(t, tt.zone, b[0]), End: at(t, tt.zone, b[1])})
+			}
+
+			got := freeSlots(availability, open, bookings, tt.minutes)
+
+			// Expected starts are in UTC, as slots are returned
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d slots %v, want starts %v", len(got), got, tt.want)
+			}
+			for i, slot := range got {
+				start := at(t, utc, tt.want[i])
+				if !slot.Start.Equal(start) || !slot.End.Equal(start.Add(time.Duration(tt.minutes)*time.Minute)) {
+					t.Errorf("slot %d is %s to %s, want %s for %d minutes", i, slot.Start, slot.End, start, tt.minutes)
+				}
+			}
+		})
+	}
+}
+
+func TestBookSlotRace(t *testing.T) {
+	connectTestDB(t)
+
+	profID := nextTestID(t, "profID")
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	day := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, time.UTC)
+	insertTestDocument(t, "availability", models.Availability{
+		ProfID:      profID,
+		TimeZone:    "UTC",
+		Weekly:      []models.AvailabilityWindow{{Weekday: int(day.Weekday()), Start: "09:00", End: "17:00"}},
+		SlotMinutes: 30,
+		UpdatedAt:   time.Now(),
+	})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		database.GetCollection("bookings").DeleteMany(ctx, bson.M{"profID": profID})
+	})
+
+	// Race for several slots to give the two bookings a fair chance to interleave
+	for slot := 0; slot < 10; slot++ {
+		start := day.Add(9*time.Hour + time.Duration(slot)*30*time.Minute)
+
+		var wg sync.WaitGroup
+		ready := make(chan struct{})
+		statuses := make([]int, 2)
+		for i := range statuses {
+			request := models.ConsultationRequests{
+				RequestID: nextTestID(t, "requestID"),
+				UserID:    primitive.NewObjectID().Hex(),
+				ProfID:    profID,
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				<-ready
+				_, status, err := bookSlot(ctx, request, start, 0)
+				if status == http.StatusInternalServerError {
+					t.Errorf("booking %s failed: %s", start, err)
+				}
+				statuses[i] = status
+			}(i)
+		}
+		close(ready)
+		wg.Wait()
+
+		ok := 0
+		for _, status := range statuses {
+			switch status {
+			case http.StatusOK:
+				ok++
+			case http.StatusConflict:
+			default:
+				t.Errorf("booking %s got status %d, want 200 or 409", start, status)
+			}
+		}
+		if ok != 1 {
+			t.Errorf("booking %s got statuses %v, want exactly one 200", start, statuses)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		count, err := database.GetCollection("bookings").CountDocuments(ctx, bson.M{"profID": profID, "start": start, "status": models.BookingActive})
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("slot %s has %d active bookings, want 1", start, count)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// blockedUserIDs returns the users that userID has blocked.
+func blockedUserIDs(ctx context.Context, userID string) ([]string, error) {
+	cursor, err := database.GetCollection("blocks").Find(ctx, bson.M{"userID": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []models.Block
+	if err := cursor.All(ctx, &blocks); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.BlockedUserID
+	}
+	return ids, nil
+}
+
+// BlockUser godoc
+// @Summary Block a user
+// @Description Hide a user's posts from the authenticated user's feeds
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/block [post]
+func BlockUser(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("blocks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	blockedID := c.Params("id")
+	objID, err := primitive.ObjectIDFromHex(blockedID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid user ID"})
+	}
+	if blockedID == user.ID {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "You cannot block yourself"})
+	}
+
+	count, err := database.GetCollection("users").CountDocuments(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if count == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "User not found"})
+	}
+
+	filter := bson.M{"userID": user.ID, "blockedUserID": blockedID}
+	update := bson.M{
+		"$setOnInsert": bson.M{"createdAt": time.Now()},
+	}
+	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "User blocked"})
+}
+
+// UnblockUser godoc
+// @Summary Unblock a user
+// @Description Show a previously blocked user's posts again
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/block [delete]
+func UnblockUser(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("blocks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = collection.DeleteOne(ctx, bson.M{"userID": user.ID, "blockedUserID": c.Params("id")})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "User unblocked"})
+}
+
+// GetBlockedUsers godoc
+// @Summary List blocked users
+// @Description List the users the authenticated user has blocked
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.Block
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /blocks [get]
+func GetBlockedUsers(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("blocks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"userID": user.ID}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	blocks := []models.Block{}
+	if err := cursor.All(ctx, &blocks); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(blocks)
+}
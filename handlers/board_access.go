@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// restrictedVisibilities are the board visibilities that limit who can read.
+var restrictedVisibilities = []string{models.BoardMembersOnly, models.BoardProfessionalsOnly, models.BoardInviteOnly}
+
+// validVisibility reports whether v is a known board visibility.
+func validVisibility(v string) bool {
+	switch v {
+	case "", models.BoardPublic, models.BoardMembersOnly, models.BoardProfessionalsOnly, models.BoardInviteOnly:
+		return true
+	}
+	return false
+}
+
+// optionalCaller identifies the caller when they sent a valid token, and
+// returns zero values for anonymous visitors.
+func optionalCaller(c *fiber.Ctx) (models.User, models.HealthCareProfessional) {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return models.User{}, models.HealthCareProfessional{}
+	}
+	return user, prof
+}
+
+// memberFilter matches the membership rows of the caller.
+func memberFilter(user models.User, prof models.HealthCareProfessional) bson.M {
+	if prof.ProfID != 0 {
+		return bson.M{"profID": prof.ProfID}
+	}
+	return bson.M{"userID": user.ID}
+}
+
+// findMembership loads the caller's membership of a board.
+func findMembership(ctx context.Context, boardID int, user models.User, prof models.HealthCareProfessional) (models.BoardMember, bool) {
+	var member models.BoardMember
+	if user.ID == "" && prof.ProfID == 0 {
+		return member, false
+	}
+
+	filter := memberFilter(user, prof)
+	filter["boardID"] = boardID
+	err := database.GetCollection("boardMembers").FindOne(ctx, filter).Decode(&member)
+	return member, err == nil
+}
+
+// canAccessBoard reports whether the caller may read and write on board.
+// Site moderators can always access every board.
+func canAccessBoard(ctx context.Context, board models.ForumBoard, user models.User, prof models.HealthCareProfessional) bool {
+	switch board.Visibility {
+	case "", models.BoardPublic:
+		return true
+	}
+	if isModerator(user) {
+		return true
+	}
+
+	if board.Visibility == models.BoardProfessionalsOnly {
+		return prof.ProfID != 0
+	}
+	_, ok := findMembership(ctx, board.BoardID, user, prof)
+	return ok
+}
+
+// canManageBoard reports whether the caller may manage members of board.
+func canManageBoard(ctx context.Context, board models.ForumBoard, user models.User, prof models.HealthCareProfessional) bool {
+	if isModerator(user) {
+		return true
+	}
+	member, ok := findMembership(ctx, board.BoardID, user, prof)
+	return ok && member.Role == models.BoardRoleManager
+}
+
+// canAccessPost reports whether the caller may see post, based on its board.
+func canAccessPost(ctx context.Context, post models.Post, user models.User, prof models.HealthCareProfessional) bool {
+	board, err := findBoard(ctx, post.BoardID)
+	return err == nil && canAccessBoard(ctx, board, user, prof)
+}
+
+// postBoard loads the board a post belongs to.
+func postBoard(ctx context.Context, postID int) (models.ForumBoard, error) {
+	var post models.Post
+	if err := database.GetCollection("posts").FindOne(ctx, bson.M{"postID": postID}).Decode(&post); err != nil {
+		return models.ForumBoard{}, err
+	}
+	return findBoard(ctx, post.BoardID)
+}
+
+// canAccessComment reports whether the caller may see comment, based on the board of its post.
+func canAccessComment(ctx context.Context, comment models.Comment, user models.User, prof models.HealthCareProfessional) bool {
+	board, err := postBoard(ctx, comment.PostID)
+	return err == nil && canAccessBoard(ctx, board, user, prof)
+}
+
+// hiddenBoardIDs lists the restricted boards the caller cannot read.
+func hiddenBoardIDs(ctx context.Context, user models.User, prof models.HealthCareProfessional) ([]int, error) {
+	if isModerator(user) {
+		return nil, nil
+	}
+
+	cursor, err := database.GetCollection("boards").Find(ctx, bson.M{"visibility": bson.M{"$in": restrictedVisibilities}})
+	if err != nil {
+		return nil, err
+	}
+	var boards []models.ForumBoard
+	if err := cursor.All(ctx, &boards); err != nil {
+		return nil, err
+	}
+	if len(boards) == 0 {
+		return nil, nil
+	}
+
+	joined := map[int]bool{}
+	if user.ID != "" || prof.ProfID != 0 {
+		values, err := database.GetCollection("boardMembers").Distinct(ctx, "boardID", memberFilter(user, prof))
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			switch id := value.(type) {
+			case int32:
+				joined[int(id)] = true
+			case int64:
+				joined[int(id)] = true
+			}
+		}
+	}
+
+	var hidden []int
+	for _, board := range boards {
+		if board.Visibility == models.BoardProfessionalsOnly && prof.ProfID != 0 {
+			continue
+		}
+		if board.Visibility != models.BoardProfessionalsOnly && joined[board.BoardID] {
+			continue
+		}
+		hidden = append(hidden, board.BoardID)
+	}
+	return hidden, nil
+}
+
+// excludeHiddenBoards narrows a post filter to boards the caller can read.
+func excludeHiddenBoards(ctx context.Context, filter bson.M, user models.User, prof models.HealthCareProfessional) error {
+	hidden, err := hiddenBoardIDs(ctx, user, prof)
+	if err != nil || len(hidden) == 0 {
+		return err
+	}
+
+	// Kept under $and so it combines with any boardID condition already present
+	and, _ := filter["$and"].([]bson.M)
+	filter["$and"] = append(and, bson.M{"boardID": bson.M{"$nin": hidden}})
+	return nil
+}
+
+// boardAudience narrows the users and professionals about to be notified
+// about board content to those who can read the board.
+func boardAudience(ctx context.Context, board models.ForumBoard, userIDs []string, profIDs []int) ([]string, []int, error) {
+	switch board.Visibility {
+	case "", models.BoardPublic:
+		return userIDs, profIDs, nil
+	}
+
+	allowedUsers := map[string]bool{}
+	allowedProfs := map[int]bool{}
+
+	// Site moderators can read every board
+	var objIDs []primitive.ObjectID
+	for _, userID := range userIDs {
+		if objID, err := primitive.ObjectIDFromHex(userID); err == nil {
+			objIDs = append(objIDs, objID)
+		}
+	}
+	if len(objIDs) > 0 {
+		filter := bson.M{"_id": bson.M{"$in": objIDs}, "role": bson.M{"$in": []string{models.RoleModerator, models.RoleAdmin}}}
+		cursor, err := database.GetCollection("users").Find(ctx, filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		var moderators []models.User
+		if err := cursor.All(ctx, &moderators); err != nil {
+			return nil, nil, err
+		}
+		for _, moderator := range moderators {
+			allowedUsers[moderator.ID] = true
+		}
+	}
+
+	if board.Visibility == models.BoardProfessionalsOnly {
+		for _, profID := range profIDs {
+			allowedProfs[profID] = true
+		}
+	} else {
+		cursor, err := database.GetCollection("boardMembers").Find(ctx, bson.M{"boardID": board.BoardID})
+		if err != nil {
+			return nil, nil, err
+		}
+		var members []models.BoardMember
+		if err := cursor.All(ctx, &members); err != nil {
+			return nil, nil, err
+		}
+		for _, member := range members {
+			if member.UserID != "" {
+				allowedUsers[member.UserID] = true
+			} else {
+				allowedProfs[member.ProfID] = true
+			}
+		}
+	}
+
+	var keptUsers []string
+	for _, userID := range userIDs {
+		if allowedUsers[userID] {
+			keptUsers = append(keptUsers, userID)
+		}
+	}
+	var keptProfs []int
+	for _, profID := range profIDs {
+		if allowedProfs[profID] {
+			keptProfs = append(keptProfs, profID)
+		}
+	}
+	return keptUsers, keptProfs, nil
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateBoard godoc
+// @Summary Create a new forum board
+// @Description Create a new forum board. Moderators only.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param board body models.ForumBoard true "Board Payload"
+// @Success 200 {object} models.ForumBoard
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards [post]
+func CreateBoard(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("boards")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var board models.ForumBoard
+	if err := c.BodyParser(&board); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if board.Topic == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Topic is required"})
+	}
+	if !validVisibility(board.Visibility) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Visibility must be one of public, members, professionals or invite"})
+	}
+
+	boardID, err := database.NextID(ctx, "boardID")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	board.BoardID = boardID
+
+	_, err = collection.InsertOne(ctx, board)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(board)
+}
+
+// GetBoards godoc
+// @Summary List forum boards
+// @Description List forum boards. Invite-only boards are only listed to their members and moderators.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.ForumBoard
+// @Failure 500 {object} map[string]string
+// @Router /boards [get]
+func GetBoards(c *fiber.Ctx) error {
+	collection := database.GetCollection("boards")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	user, prof := optionalCaller(c)
+	if !isModerator(user) {
+		// Invite-only boards are unlisted; other restricted boards stay
+		// visible so people can find and join them
+		visible := []bson.M{{"visibility": bson.M{"$ne": models.BoardInviteOnly}}}
+		if user.ID != "" || prof.ProfID != 0 {
+			joined, err := database.GetCollection("boardMembers").Distinct(ctx, "boardID", memberFilter(user, prof))
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+			}
+			if len(joined) > 0 {
+				visible = append(visible, bson.M{"boardID": bson.M{"$in": joined}})
+			}
+		}
+		filter["$or"] = visible
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "topic", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	boards := []models.ForumBoard{}
+	if err := cursor.All(ctx, &boards); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(boards)
+}
+
+// GetBoard godoc
+// @Summary Get a forum board by ID
+// @Description Get a forum board by ID. Invite-only boards are only found by their members and moderators.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Success 200 {object} models.ForumBoard
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /boards/{id} [get]
+func GetBoard(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	board, err := findBoard(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+
+	// Invite-only boards are unlisted, so outsiders cannot look them up by ID either
+	user, prof := optionalCaller(c)
+	if board.Visibility == models.BoardInviteOnly && !canAccessBoard(ctx, board, user, prof) {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(board)
+}
+
+// UpdateBoard godoc
+// @Summary Update a forum board
+// @Description Update a forum board's topic, description and settings. Moderators only.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param board body models.ForumBoard true "Board Payload"
+// @Success 200 {object} models.ForumBoard
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id} [put]
+func UpdateBoard(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("boards")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	var board models.ForumBoard
+	if err := c.BodyParser(&board); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	board.BoardID = id
+	if !validVisibility(board.Visibility) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Visibility must be one of public, members, professionals or invite"})
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"boardID": id}, bson.M{"$set": board})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(board)
+}
+
+// findBoard loads a forum board by its ID.
+func findBoard(ctx context.Context, boardID int) (models.ForumBoard, error) {
+	var board models.ForumBoard
+	err := database.GetCollection("boards").FindOne(ctx, bson.M{"boardID": boardID}).Decode(&board)
+	return board, err
+}
@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// bookmarkEntry is a bookmark together with the content it points at.
+// Available is false when that content has been deleted or is hidden from
+// the user, in which case only the bookmark itself is returned.
+type bookmarkEntry struct {
+	models.Bookmark
+	Available bool            `json:"available"`
+	Post      *models.Post    `json:"post,omitempty"`
+	Comment   *models.Comment `json:"comment,omitempty"`
+}
+
+// findCollection loads one of userID's bookmark collections by its hex ID.
+func findCollection(ctx context.Context, userID, id string) (models.BookmarkCollection, error) {
+	var collection models.BookmarkCollection
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return collection, err
+	}
+
+	err = database.GetCollection("bookmarkCollections").FindOne(ctx, bson.M{"_id": objID, "userID": userID}).Decode(&collection)
+	return collection, err
+}
+
+// collectionName validates and trims a bookmark collection name.
+func collectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("Name is required")
+	}
+	if err := checkLength("Name", name, models.MaxCollectionNameLength); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// CreateBookmark godoc
+// @Summary Bookmark a post or comment
+// @Description Save a post, or a comment by giving its commentID, optionally into one of the user's collections
+// @Tags bookmarks
+// @Accept  json
+// @Produce  json
+// @Param bookmark body models.Bookmark true "Bookmark payload: postID or commentID, optional collectionID"
+// @Success 200 {object} models.Bookmark
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /bookmarks [post]
+func CreateBookmark(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var bookmark models.Bookmark
+	if err := c.BodyParser(&bookmark); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	// A comment's post is looked up rather than trusted from the request
+	if bookmark.CommentID != 0 {
+		var comment models.Comment
+		if err := database.GetCollection("comments").FindOne(ctx, bson.M{"commentID": bookmark.CommentID}).Decode(&comment); err != nil {
+			return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Comment not found"})
+		}
+		bookmark.PostID = comment.PostID
+	} else {
+		if bookmark.PostID == 0 {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Post ID or comment ID is required"})
+		}
+	}
+
+	board, err := postBoard(ctx, bookmark.PostID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+	if !canAccessBoard(ctx, board, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	if bookmark.CollectionID != "" {
+		bookmarkCollection, err := findCollection(ctx, user.ID, bookmark.CollectionID)
+		if err != nil {
+			return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Collection not found"})
+		}
+		bookmark.CollectionID = bookmarkCollection.ID.Hex()
+	}
+
+	bookmark.UserID = user.ID
+
+	// Saving the same thing into the same collection twice keeps one bookmark
+	filter := bson.M{
+		"userID":       bookmark.UserID,
+		"postID":       bookmark.PostID,
+		"commentID":    bson.M{"$exists": false},
+		"collectionID": bson.M{"$exists": false},
+	}
+	if bookmark.CommentID != 0 {
+		filter["commentID"] = bookmark.CommentID
+	}
+	if bookmark.CollectionID != "" {
+		filter["collectionID"] = bookmark.CollectionID
+	}
+
+	fields := bson.M{
+		"userID":    bookmark.UserID,
+		"postID":    bookmark.PostID,
+		"createdAt": time.Now(),
+	}
+	if bookmark.CommentID != 0 {
+		fields["commentID"] = bookmark.CommentID
+	}
+	if bookmark.CollectionID != "" {
+		fields["collectionID"] = bookmark.CollectionID
+	}
+	update := bson.M{"$setOnInsert": fields}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&bookmark); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(bookmark)
+}
+
+// GetBookmarks godoc
+// @Summary List bookmarks
+// @Description List the authenticated user's bookmarks, newest first, with the saved content.
+// @Description Bookmarks whose content was deleted are kept and marked unavailable.
+// @Tags bookmarks
+// @Accept  json
+// @Produce  json
+// @Param collectionID query string false "Only list this collection; \"unsorted\" lists bookmarks in no collection"
+// @Param limit query int false "Maximum number of bookmarks (default 50, max 100)"
+// @Success 200 {array} bookmarkEntry
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /bookmarks [get]
+func GetBookmarks(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"userID": user.ID}
+	switch collectionID := c.Query("collectionID"); collectionID {
+	case "":
+	case "unsorted":
+		filter["collectionID"] = bson.M{"$exists": false}
+	default:
+		bookmarkCollection, err := findCollection(ctx, user.ID, collectionID)
+		if err != nil {
+			return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Collection not found"})
+		}
+		filter["collectionID"] = bookmarkCollection.ID.Hex()
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var bookmarks []models.Bookmark
+	if err := cursor.All(ctx, &bookmarks); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	entries, err := loadBookmarkedContent(ctx, bookmarks, user)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(entries)
+}
+
+// loadBookmarkedContent fetches the posts and comments bookmarks point at in
+// two queries. Anything that no longer exists, or sits on a board user can no
+// longer read, leaves its entry unavailable.
+func loadBookmarkedContent(ctx context.Context, bookmarks []models.Bookmark, user models.User) ([]bookmarkEntry, error) {
+	var postIDs, commentIDs []int
+	for _, bookmark := range bookmarks {
+		postIDs = append(postIDs, bookmark.PostID)
+		if bookmark.CommentID != 0 {
+			commentIDs = append(commentIDs, bookmark.CommentID)
+		}
+	}
+
+	posts := map[int]*models.Post{}
+	if len(postIDs) > 0 {
+		cursor, err := database.GetCollection("posts").Find(ctx, bson.M{"postID": bson.M{"$in": postIDs}})
+		if err != nil {
+			return nil, err
+		}
+		var found []models.Post
+		if err := cursor.All(ctx, &found); err != nil {
+			return nil, err
+		}
+		if err := showPolls(ctx, found, user.ID); err != nil {
+			return nil, err
+		}
+
+		hidden, err := hiddenBoardIDs(ctx, user, models.HealthCareProfessional{})
+		if err != nil {
+			return nil, err
+		}
+		hiddenBoards := map[int]bool{}
+		for _, boardID := range hidden {
+			hiddenBoards[boardID] = true
+		}
+		for i := range found {
+			if !hiddenBoards[found[i].BoardID] {
+				posts[found[i].PostID] = &found[i]
+			}
+		}
+	}
+
+	comments := map[int]*models.Comment{}
+	if len(commentIDs) > 0 {
+		cursor, err := database.GetCollection("comments").Find(ctx, bson.M{"commentID": bson.M{"$in": commentIDs}})
+		if err != nil {
+			return nil, err
+		}
+		var found []models.Comment
+		if err := cursor.All(ctx, &found); err != nil {
+			return nil, err
+		}
+		for i := range found {
+			comments[found[i].CommentID] = &found[i]
+		}
+	}
+
+	entries := make([]bookmarkEntry, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		entry := bookmarkEntry{Bookmark: bookmark, Post: posts[bookmark.PostID]}
+		if bookmark.CommentID != 0 {
+			// The post is left out when its board is hidden, and the comment goes with it
+			if entry.Post != nil {
+				entry.Comment = comments[bookmark.CommentID]
+			}
+			entry.Available = entry.Post != nil && entry.Comment != nil
+		} else {
+			entry.Available = entry.Post != nil
+		}
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+// DeleteBookmark godoc
+// @Summary Remove a bookmark
+// @Description Remove one of the authenticated user's bookmarks
+// @Tags bookmarks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Bookmark ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /bookmarks/{id} [delete]
+func DeleteBookmark(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid bookmark ID"})
+	}
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id, "userID": user.ID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Bookmark not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Bookmark removed"})
+}
+
+// CreateBookmarkCollection godoc
+// @Summary Create a bookmark collection
+// @Description Create a named collection to group bookmarks in
+// @Tags bookmarks
+// @Accept  json
+// @Produce  json
+// @Param collection body models.BookmarkCollection true "Collection payload (only name is used)"
+// @Success 200 {object} models.BookmarkCollection
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /bookmarks/collections [post]
+func CreateBookmarkCollection(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("bookmarkCollections")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	name, err := collectionName(requestData.Name)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	bookmarkCollection := models.BookmarkCollection{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := collection.InsertOne(ctx, bookmarkCollection); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(bookmarkCollection)
+}
+
+// GetBookmarkCollections godoc
+// @Summary List bookmark collections
+// @Description List the authenticated user's bookmark collections by name
+// @Tags bookmarks
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.BookmarkCollection
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /bookmarks/collections [get]
+func GetBookmarkCollections(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("bookmarkCollections")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"userID": user.ID}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collections := []models.BookmarkCollection{}
+	if err := cursor.All(ctx, &collections); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(collections)
+}
+
+// RenameBookmarkCollection godoc
+// @Summary Rename a bookmark collection
+// @Description Rename one of the authenticated user's bookmark collections
+// @Tags bookmarks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Collection ID"
+// @Param collection body models.BookmarkCollection true "Collection payload (only name is used)"
+// @Success 200 {object} models.BookmarkCollection
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /bookmarks/collections/{id} [put]
+func RenameBookmarkCollection(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("bookmarkCollections")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	name, err := collectionName(requestData.Name)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	bookmarkCollection, err := findCollection(ctx, user.ID, c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Collection not found"})
+	}
+
+	update := bson.M{
+		"$set": bson.M{"name": name},
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": bookmarkCollection.ID}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	bookmarkCollection.Name = name
+	return c.Status(http.StatusOK).JSON(bookmarkCollection)
+}
+
+// DeleteBookmarkCollection godoc
+// @Summary Delete a bookmark collection
+// @Description Delete one of the authenticated user's bookmark collections together with the bookmarks in it
+// @Tags bookmarks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Collection ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /bookmarks/collections/{id} [delete]
+func DeleteBookmarkCollection(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("bookmarkCollections")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookmarkCollection, err := findCollection(ctx, user.ID, c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Collection not found"})
+	}
+
+	filter := bson.M{"userID": user.ID, "collectionID": bookmarkCollection.ID.Hex()}
+	if _, err := database.GetCollection("bookmarks").DeleteMany(ctx, filter); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if _, err := collection.DeleteOne(ctx, bson.M{"_id": bookmarkCollection.ID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Collection deleted"})
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"gofiber-mongodb/server/ical"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Calendar feed limits.
+const (
+	// calendarFeedPastDays is how far back a feed keeps past consultations.
+	calendarFeedPastDays = 90
+	// maxCalendarFeedEvents bounds the number of consultations in one feed.
+	maxCalendarFeedEvents = 500
+)
+
+// calendarContentType is the media type of iCalendar responses.
+const calendarContentType = "text/calendar; charset=utf-8"
+
+// consultationEventStatus maps a consultation request status to the status
+// of its calendar event.
+func consultationEventStatus(status string) string {
+	switch status {
+	case models.ConsultationCancelled, models.ConsultationDeclined:
+		return ical.StatusCancelled
+	case models.ConsultationPending, models.ConsultationAccepted:
+		return ical.StatusTentative
+	}
+	return ical.StatusConfirmed
+}
+
+// consultationEvents turns scheduled consultation requests into calendar
+// events, titled with the other party's name as seen by the user or, when
+// forProfessional is set, by the professional.
+func consultationEvents(ctx context.Context, requests []models.ConsultationRequests, forProfessional bool) ([]ical.Event, error) {
+	names := map[string]string{}
+	if forProfessional {
+		var objIDs []primitive.ObjectID
+		for _, request := range requests {
+			if objID, err := primitive.ObjectIDFromHex(request.UserID); err == nil {
+				objIDs = append(objIDs, objID)
+			}
+		}
+		if len(objIDs) > 0 {
+			cursor, err := database.GetCollection("users").Find(ctx, bson.M{"_id": bson.M{"$in": objIDs}})
+			if err != nil {
+				return nil, err
+			}
+			var users []models.User
+			if err := cursor.All(ctx, &users); err != nil {
+				return nil, err
+			}
+			for _, user := range users {
+				names[user.ID] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+			}
+		}
+	} else {
+		var profIDs []int
+		for _, request := range requests {
+			profIDs = append(profIDs, request.ProfID)
+		}
+		if len(profIDs) > 0 {
+			cursor, err := database.GetCollection("professionals").Find(ctx, bson.M{"profID": bson.M{"$in": profIDs}})
+			if err != nil {
+				return nil, err
+			}
+			var profs []models.HealthCareProfessional
+			if err := cursor.All(ctx, &profs); err != nil {
+				return nil, err
+			}
+			for _, prof := range profs {
+				names[fmt.Sprint(prof.ProfID)] = strings.TrimSpace(prof.FirstName + " " + prof.LastName)
+			}
+		}
+	}
+
+	events := make([]ical.Event, 0, len(requests))
+	for _, request := range requests {
+		name := names[fmt.Sprint(request.ProfID)]
+		if forProfessional {
+			name = names[request.UserID]
+		}
+		summary := "Consultation"
+		if name != "" {
+			summary += " with " + name
+		}
+
+		minutes := request.DurationMinutes
+		if minutes == 0 {
+			minutes = models.DefaultSlotMinutes
+		}
+
+		modified := request.CreatedAt
+		if n := len(request.StatusHistory); n > 0 {
+			modified = request.StatusHistory[n-1].ChangedAt
+		}
+
+		events = append(events, ical.Event{
+			UID:          fmt.Sprintf("consultation-%d@mypregnancy", request.RequestID),
+			Sequence:     request.Sequence,
+			Start:        request.ConsultationDateTime,
+			End:          request.ConsultationDateTime.Add(time.Duration(minutes) * time.Minute),
+			Summary:      summary,
+			Description:  fmt.Sprintf("Consultation request #%d is %s.", request.RequestID, strings.ReplaceAll(request.Status, "_", " ")),
+			Location:     request.CommunicationType,
+			Status:       consultationEventStatus(request.Status),
+			LastModified: modified,
+		})
+	}
+	return events, nil
+}
+
+// hashFeedToken returns the stored form of a calendar feed token.
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetConsultationCalendar godoc
+// @Summary Download a consultation as an iCalendar file
+// @Description Download a scheduled consultation as an .ics file for the authenticated user or professional. Importing
+// @Description it again after the consultation changes updates the existing calendar entry.
+// @Tags calendar
+// @Produce  text/calendar
+// @Param id path int true "Request ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /consultationrequests/{id}/calendar [get]
+func GetConsultationCalendar(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	scheduled := false
+	for _, change := range request.StatusHistory {
+		if change.Status == models.ConsultationScheduled {
+			scheduled = true
+			break
+		}
+	}
+	if !scheduled {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "This consultation has not been scheduled yet"})
+	}
+
+	events, err := consultationEvents(ctx, []models.ConsultationRequests{request}, prof.ProfID != 0)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	calendar := ical.Calendar{Method: "PUBLISH", Events: events}
+
+	c.Set(fiber.HeaderContentType, calendarContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="consultation-%d.ics"`, request.RequestID))
+	return c.Status(http.StatusOK).SendString(calendar.Render())
+}
+
+// CreateCalendarFeed godoc
+// @Summary Create a calendar subscription feed
+// @Description Create a private webcal feed of the authenticated user's or professional's consultations. Creating a
+// @Description feed again replaces the old one, so its URL stops working. The URL contains the only copy of the token.
+// @Tags calendar
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /calendar/feed [post]
+func CreateCalendarFeed(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("calendarFeeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	feed := models.CalendarFeed{
+		UserID:    user.ID,
+		ProfID:    prof.ProfID,
+		TokenHash: hashFeedToken(token),
+		CreatedAt: time.Now(),
+	}
+	if prof.ProfID != 0 {
+		feed.UserID = ""
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := collection.ReplaceOne(ctx, memberFilter(user, prof), feed, opts); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	url := c.BaseURL() + "/api/calendar/feeds/" + token + ".ics"
+	webcal := "webcal" + strings.TrimPrefix(strings.TrimPrefix(url, "https"), "http")
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"url": url, "webcalURL": webcal})
+}
+
+// DeleteCalendarFeed godoc
+// @Summary Turn off the calendar subscription feed
+// @Description Revoke the authenticated user's or professional's calendar feed URL
+// @Tags calendar
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /calendar/feed [delete]
+func DeleteCalendarFeed(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("calendarFeeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, memberFilter(user, prof))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "No calendar feed to turn off"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Calendar feed turned off"})
+}
+
+// GetCalendarFeed godoc
+// @Summary Calendar subscription feed
+// @Description The iCalendar feed behind a calendar feed URL. The token in the URL is the only credential, so calendar
+// @Description apps can subscribe without signing in. Cancelled consultations stay in the feed marked as cancelled.
+// @Tags calendar
+// @Produce  text/calendar
+// @Param token path string true "Feed token, optionally followed by .ics"
+// @Success 200 {file} file
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /calendar/feeds/{token} [get]
+func GetCalendarFeed(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	token := strings.TrimSuffix(c.Params("token"), ".ics")
+
+	var feed models.CalendarFeed
+	if err := database.GetCollection("calendarFeeds").FindOne(ctx, bson.M{"tokenHash": hashFeedToken(token)}).Decode(&feed); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Calendar feed not found"})
+	}
+
+	// Requests that were ever scheduled stay in the feed, so cancellations reach subscribers
+	filter := bson.M{
+		"statusHistory.status": models.ConsultationScheduled,
+		"consultationDateTime": bson.M{"$gte": time.Now().AddDate(0, 0, -calendarFeedPastDays)},
+	}
+	if feed.ProfID != 0 {
+		filter["profID"] = feed.ProfID
+	} else {
+		filter["userID"] = feed.UserID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "consultationDateTime", Value: 1}}).SetLimit(maxCalendarFeedEvents)
+	cursor, err := database.GetCollection("consultationrequests").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	var requests []models.ConsultationRequests
+	if err := cursor.All(ctx, &requests); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	events, err := consultationEvents(ctx, requests, feed.ProfID != 0)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	calendar := ical.Calendar{Name: "MyPregnancy consultations", Events: events}
+
+	c.Set(fiber.HeaderContentType, calendarContentType)
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	return c.Status(http.StatusOK).SendString(calendar.Render())
+}
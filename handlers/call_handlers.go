@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The backend only relays signaling for video calls; the media flows directly
+// between the two browsers, through a TURN server when they cannot reach
+// each other.
+
+// callReadLimit bounds a signaling frame. SDP offers with many codecs run to a few kilobytes.
+const callReadLimit = 64 * 1024
+
+// iceServer is one STUN or TURN server, in the shape RTCPeerConnection takes.
+type iceServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// defaultICEServers are used when ICE_SERVERS is not set.
+var defaultICEServers = []iceServer{{URLs: []string{"stun:stun.l.google.com:19302"}}}
+
+// callICEServers returns the STUN and TURN servers for a call, from the JSON
+// list in ICE_SERVERS. When TURN_SECRET is set, TURN servers listed without
+// a username get short-lived credentials from it, in the TURN REST API form
+// coturn's use-auth-secret accepts, valid until expires.
+func callICEServers(name string, expires time.Time) []iceServer {
+	servers := defaultICEServers
+	if raw := os.Getenv("ICE_SERVERS"); raw != "" {
+		var configured []iceServer
+		if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+			log.Printf("Ignoring invalid ICE_SERVERS: %s", err)
+		} else {
+			servers = configured
+		}
+	}
+
+	secret := os.Getenv("TURN_SECRET")
+	result := make([]iceServer, 0, len(servers))
+	for _, server := range servers {
+		if secret != "" && server.Username == "" && isTURNServer(server) {
+			server.Username = fmt.Sprintf("%d:%s", expires.Unix(), name)
+			mac := hmac.New(sha1.New, []byte(secret))
+			mac.Write([]byte(server.Username))
+			server.Credential = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		result = append(result, server)
+	}
+	return result
+}
+
+func isTURNServer(server iceServer) bool {
+	for _, url := range server.URLs {
+		if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+			return true
+		}
+	}
+	return false
+}
+
+// callFrame is a message on the call socket, in either direction.
+//
+// Clients send "offer" and "answer" with SDP and "candidate" with Candidate,
+// which are passed on to the other side with From set, and "leave" to hang
+// up. On joining the server sends "joined" with the ICE servers to use and
+// the Peers already in the call, and later "peer-joined" and "peer-left" as
+// the other side comes and goes. Bad requests get "error" frames.
+type callFrame struct {
+	Type       string          `json:"type"`
+	From       string          `json:"from,omitempty"`
+	SDP        string          `json:"sdp,omitempty"`
+	Candidate  json.RawMessage `json:"candidate,omitempty"`
+	IceServers []iceServer     `json:"iceServers,omitempty"`
+	Peers      []string        `json:"peers,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// callRoom is the video call of one consultation on this server. Each side
+// has at most one connection; StartedAt is set while both are connected.
+type callRoom struct {
+	peers     map[string]*roomClient
+	startedAt time.Time
+}
+
+var callRooms = struct {
+	sync.Mutex
+	rooms map[int]*callRoom
+}{rooms: map[int]*callRoom{}}
+
+// joinCall adds client to the call of a consultation. It returns the
+// connection client replaces, from the same side on another device, and the
+// other side's connection, if any.
+func joinCall(requestID int, client *roomClient) (*roomClient, *roomClient) {
+	callRooms.Lock()
+	defer callRooms.Unlock()
+
+	room := callRooms.rooms[requestID]
+	if room == nil {
+		room = &callRoom{peers: map[string]*roomClient{}}
+		callRooms.rooms[requestID] = room
+	}
+
+	replaced := room.peers[client.party]
+	room.peers[client.party] = client
+
+	var peer *roomClient
+	for party, other := range room.peers {
+		if party != client.party {
+			peer = other
+		}
+	}
+	if peer != nil && room.startedAt.IsZero() {
+		room.startedAt = time.Now()
+	}
+	return replaced, peer
+}
+
+// leaveCall removes client from the call of a consultation. It returns the
+// other side's connection, if any, and the stretch of call that leaving
+// ended, if both sides were connected. ok is false if client had already
+// been replaced by a newer connection from the same side.
+func leaveCall(requestID int, client *roomClient) (peer *roomClient, session *models.CallSession, ok bool) {
+	callRooms.Lock()
+	defer callRooms.Unlock()
+
+	room := callRooms.rooms[requestID]
+	if room == nil || room.peers[client.party] != client {
+		return nil, nil, false
+	}
+	delete(room.peers, client.party)
+
+	for _, other := range room.peers {
+		peer = other
+	}
+
+	if !room.startedAt.IsZero() {
+		now := time.Now()
+		session = &models.CallSession{
+			StartedAt:       room.startedAt,
+			EndedAt:         now,
+			DurationSeconds: int(now.Sub(room.startedAt) / time.Second),
+		}
+		room.startedAt = time.Time{}
+	}
+
+	if len(room.peers) == 0 {
+		delete(callRooms.rooms, requestID)
+	}
+	return peer, session, true
+}
+
+// recordCallEvent logs a join or leave onto the consultation, along with the
+// stretch of call it ended, if any.
+func recordCallEvent(requestID int, party, event string, session *models.CallSession) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	push := bson.M{"callEvents": models.CallEvent{Party: party, Event: event, At: time.Now()}}
+	update := bson.M{"$push": push}
+	if session != nil {
+		push["calls"] = session
+		update["$inc"] = bson.M{"callSeconds": session.DurationSeconds}
+	}
+
+	if _, err := database.GetCollection("consultationrequests").UpdateOne(ctx, bson.M{"requestID": requestID}, update); err != nil {
+		log.Printf("Failed to record call %s for consultation request %d: %s", event, requestID, err)
+	}
+}
+
+// UpgradeConsultationCall godoc
+// @Summary Join a consultation video call
+// @Description Open the WebRTC signaling socket of a video consultation. The server only relays offers, answers and ICE
+// @Description candidates between the user and the professional; media goes directly between them. The room is open
+// @Description from 10 minutes before the consultation until 30 minutes after its booked end while it is scheduled or
+// @Description in progress. Browsers may pass the JWT as the token query parameter. Frames are JSON objects with a
+// @Description type: "offer" and "answer" (sdp), "candidate" (candidate) and "leave". Joins, leaves and the time both
+// @Description sides were connected are logged onto the consultation.
+// @Tags consultationrequests
+// @Param id path int true "Request ID"
+// @Param token query string false "JWT, when it cannot be sent in the Authorization header"
+// @Success 101
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 426 {object} map[string]string
+// @Router /consultationrequests/{id}/call [get]
+func UpgradeConsultationCall(c *fiber.Ctx) error {
+	request, party, status, err := admitToRoom(c)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+	if !strings.EqualFold(request.CommunicationType, models.CommunicationVideo) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "This is not a video consultation"})
+	}
+
+	c.Locals("callRequest", request)
+	c.Locals("callParty", party)
+	return c.Next()
+}
+
+// ConsultationCall serves a consultation call connection once
+// UpgradeConsultationCall has let it in.
+var ConsultationCall = websocket.New(serveConsultationCall)
+
+func serveConsultationCall(conn *websocket.Conn) {
+	request, _ := conn.Locals("callRequest").(models.ConsultationRequests)
+	party, _ := conn.Locals("callParty").(string)
+	client := &roomClient{conn: conn, party: party}
+
+	stop := keepRoomAlive(client, request, callReadLimit)
+	defer stop()
+
+	replaced, peer := joinCall(request.RequestID, client)
+	if replaced != nil {
+		replaced.close("Joined the call from another device")
+	}
+	recordCallEvent(request.RequestID, party, models.CallJoined, nil)
+
+	defer func() {
+		peer, session, ok := leaveCall(request.RequestID, client)
+		if !ok {
+			return
+		}
+		if peer != nil {
+			peer.send(callFrame{Type: "peer-left", From: party})
+		}
+		recordCallEvent(request.RequestID, party, models.CallLeft, session)
+	}()
+
+	_, closes := roomWindow(request)
+	welcome := callFrame{
+		Type:       "joined",
+		IceServers: callICEServers(fmt.Sprintf("consultation-%d-%s", request.RequestID, party), closes),
+	}
+	if peer != nil {
+		welcome.Peers = []string{peer.party}
+		peer.send(callFrame{Type: "peer-joined", From: party})
+	}
+	if err := client.send(welcome); err != nil {
+		return
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Call connection for consultation request %d closed: %s", request.RequestID, err)
+			}
+			return
+		}
+
+		var frame callFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			client.send(callFrame{Type: "error", Error: "Invalid frame"})
+			continue
+		}
+		if frame.Type == "leave" {
+			return
+		}
+
+		if err := relayCallFrame(client, request.RequestID, frame); err != nil {
+			if err := client.send(callFrame{Type: "error", Error: err.Error()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// relayCallFrame passes a signaling frame from client on to the other side of the call.
+func relayCallFrame(client *roomClient, requestID int, frame callFrame) error {
+	relayed := callFrame{Type: frame.Type, From: client.party}
+	switch frame.Type {
+	case "offer", "answer":
+		if frame.SDP == "" {
+			return errors.New("SDP is required")
+		}
+		relayed.SDP = frame.SDP
+	case "candidate":
+		if len(frame.Candidate) == 0 {
+			return errors.New("Candidate is required")
+		}
+		relayed.Candidate = frame.Candidate
+	default:
+		return errors.New("Unknown frame type " + frame.Type)
+	}
+
+	callRooms.Lock()
+	var peer *roomClient
+	if room := callRooms.rooms[requestID]; room != nil && room.peers[client.party] == client {
+		for party, other := range room.peers {
+			if party != client.party {
+				peer = other
+			}
+		}
+	}
+	callRooms.Unlock()
+
+	if peer == nil {
+		return errors.New("The other side has not joined the call yet")
+	}
+	return peer.send(relayed)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startCallServer serves the call route on a local port and returns its base URL.
+func startCallServer(t *testing.T) string {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/api/consultationrequests/:id/call", UpgradeConsultationCall, ConsultationCall)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	return "ws://" + ln.Addr().String() + "/api"
+}
+
+// dialCall joins the call of a consultation with token, either in the
+// Authorization header or, as browsers send it, in the token query parameter.
+func dialCall(t *testing.T, base string, requestID int, token string, inQuery bool) *websocket.Conn {
+	t.Helper()
+
+	url := fmt.Sprintf("%s/consultationrequests/%d/call", base, requestID)
+	header := http.Header{}
+	if inQuery {
+		url += "?token=" + token
+	} else {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		if resp != nil {
+			t.Fatalf("Failed to join the call: %s (%s)", err, resp.Status)
+		}
+		t.Fatalf("Failed to join the call: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readCallFrame(t *testing.T, conn *websocket.Conn) callFrame {
+	t.Helper()
+
+	var frame callFrame
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("Failed to read a frame: %s", err)
+	}
+	return frame
+}
+
+func sendCallFrame(t *testing.T, conn *websocket.Conn, frame string) {
+	t.Helper()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+		t.Fatalf("Failed to send %s: %s", frame, err)
+	}
+}
+
+func TestConsultationCall(t *testing.T) {
+	connectTestDB(t)
+	t.Setenv("SECRET", "call-test-secret")
+	t.Setenv("ICE_SERVERS", `[{"urls":["stun:stun.example.com:3478"]},{"urls":["turn:turn.example.com:3478"]}]`)
+	t.Setenv("TURN_SECRET", "turn-test-secret")
+
+	userID := primitive.NewObjectID()
+	email := "call-test-" + userID.Hex() + "@example.com"
+	insertTestDocument(t, "users", bson.M{"_id": userID, "email": email, "firstname": "Call", "lastname": "Tester"})
+
+	profID := nextTestID(t, "profID")
+	insertTestDocument(t, "professionals", bson.M{"profID": profID, "emailAddress": "prof-" + email, "firstName": "Video", "lastName": "Doctor"})
+
+	requestID := nextTestID(t, "requestID")
+	insertTestDocument(t, "consultationrequests", models.ConsultationRequests{
+		RequestID:            requestID,
+		UserID:               userID.Hex(),
+		ProfID:               profID,
+		CommunicationType:    models.CommunicationVideo,
+		ConsultationDateTime: time.Now(),
+		Status:               models.ConsultationScheduled,
+		DurationMinutes:      30,
+		CreatedAt:            time.Now(),
+	})
+
+	userToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("call-test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profToken, err := GenerateProfessionalToken(profID, "prof-"+email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := startCallServer(t)
+
+	// The user joins first and is alone in the call
+	userConn := dialCall(t, base, requestID, userToken, true)
+	joined := readCallFrame(t, userConn)
+	if joined.Type != "joined" || len(joined.Peers) != 0 {
+		t.Fatalf("user got %+v, want joined with no peers", joined)
+	}
+	if len(joined.IceServers) != 2 {
+		t.Fatalf("user got ICE servers %+v, want the two configured", joined.IceServers)
+	}
+	if stun := joined.IceServers[0]; stun.Username != "" || stun.Credential != "" {
+		t.Errorf("STUN server got credentials %+v", stun)
+	}
+	turn := joined.IceServers[1]
+	wantName := fmt.Sprintf("consultation-%d-%s", requestID, partyUser)
+	if !strings.HasSuffix(turn.Username, ":"+wantName) || turn.Credential == "" {
+		t.Errorf("TURN server got username %q and credential %q, want TURN REST credentials for %s", turn.Username, turn.Credential, wantName)
+	}
+
+	// The professional joins and each side learns of the other
+	profConn := dialCall(t, base, requestID, profToken, false)
+	joined = readCallFrame(t, profConn)
+	if joined.Type != "joined" || len(joined.Peers) != 1 || joined.Peers[0] != partyUser {
+		t.Fatalf("professional got %+v, want joined with the user as peer", joined)
+	}
+	if len(joined.IceServers) != 2 || !strings.HasSuffix(joined.IceServers[1].Username, fmt.Sprintf(":consultation-%d-%s", requestID, partyProfessional)) {
+		t.Errorf("professional got ICE servers %+v", joined.IceServers)
+	}
+	if frame := readCallFrame(t, userConn); frame.Type != "peer-joined" || frame.From != partyProfessional {
+		t.Fatalf("user got %+v, want peer-joined from the professional", frame)
+	}
+
+	// Offers, answers and candidates are passed on to the other side
+	sendCallFrame(t, userConn, `{"type":"offer","sdp":"v=0 offer"}`)
+	if frame := readCallFrame(t, profConn); frame.Type != "offer" || frame.From != partyUser || frame.SDP != "v=0 offer" {
+		t.Errorf("professional got %+v, want the user's offer", frame)
+	}
+
+	sendCallFrame(t, profConn, `{"type":"answer","sdp":"v=0 answer"}`)
+	if frame := readCallFrame(t, userConn); frame.Type != "answer" || frame.From != partyProfessional || frame.SDP != "v=0 answer" {
+		t.Errorf("user got %+v, want the professional's answer", frame)
+	}
+
+	candidate := `{"candidate":"candidate:1 1 udp 2122260223 192.0.2.1 54400 typ host","sdpMid":"0","sdpMLineIndex":0}`
+	sendCallFrame(t, userConn, `{"type":"candidate","candidate":`+candidate+`}`)
+	frame := readCallFrame(t, profConn)
+	if frame.Type != "candidate" || frame.From != partyUser {
+		t.Errorf("professional got %+v, want the user's candidate", frame)
+	}
+	var got, want interface{}
+	json.Unmarshal(frame.Candidate, &got)
+	json.Unmarshal([]byte(candidate), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("professional got candidate %s, want %s", frame.Candidate, candidate)
+	}
+
+	// Stay connected long enough for the call to last a whole second
+	time.Sleep(1100 * time.Millisecond)
+
+	sendCallFrame(t, userConn, `{"type":"leave"}`)
+	if frame := readCallFrame(t, profConn); frame.Type != "peer-left" || frame.From != partyUser {
+		t.Fatalf("professional got %+v, want peer-left from the user", frame)
+	}
+
+	// The call is recorded after peer-left is sent, so wait for it
+	var request models.ConsultationRequests
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := database.GetCollection("consultationrequests").FindOne(ctx, bson.M{"requestID": requestID}).Decode(&request)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(request.Calls) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if len(request.Calls) != 1 {
+		t.Fatalf("got %d call sessions, want 1", len(request.Calls))
+	}
+	session := request.Calls[0]
+	if session.DurationSeconds < 1 || !session.EndedAt.After(session.StartedAt) {
+		t.Errorf("got call session %+v, want one lasting at least a second", session)
+	}
+	if request.CallSeconds != session.DurationSeconds {
+		t.Errorf("got callSeconds %d, want %d", request.CallSeconds, session.DurationSeconds)
+	}
+
+	var events []string
+	for _, event := range request.CallEvents {
+		events = append(events, event.Party+" "+event.Event)
+	}
+	wantEvents := []string{"user joined", "professional joined", "user left"}
+	if strings.Join(events, ", ") != strings.Join(wantEvents, ", ") {
+		t.Errorf("got call events %v, want %v", events, wantEvents)
+	}
+}
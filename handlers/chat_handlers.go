@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chatFrame is a message on the chat socket, in either direction.
+//
+// Clients send "message" with Body, "typing" with Typing, "read" with
+// MessageID to mark everything from the other side up to that message as
+// read, and "history" with an optional Before and Limit to page back through
+// older messages. The server sends "message", "typing", "read" and "history"
+// frames for the same events, and "error" frames for bad requests.
+type chatFrame struct {
+	Type      string               `json:"type"`
+	Body      string               `json:"body,omitempty"`
+	Typing    bool                 `json:"typing,omitempty"`
+	MessageID string               `json:"messageID,omitempty"`
+	Before    string               `json:"before,omitempty"`
+	Limit     int                  `json:"limit,omitempty"`
+	Sender    string               `json:"sender,omitempty"`
+	ReadAt    *time.Time           `json:"readAt,omitempty"`
+	Message   *models.ChatMessage  `json:"message,omitempty"`
+	Messages  []models.ChatMessage `json:"messages,omitempty"`
+	Error     string               `json:"error,omitempty"`
+}
+
+// chatRooms tracks the open chat connections of each consultation on this
+// server. Messages are stored either way and show up in the history.
+var chatRooms = struct {
+	sync.Mutex
+	rooms map[int]map[*roomClient]bool
+}{rooms: map[int]map[*roomClient]bool{}}
+
+func joinChatRoom(requestID int, client *roomClient) {
+	chatRooms.Lock()
+	defer chatRooms.Unlock()
+	if chatRooms.rooms[requestID] == nil {
+		chatRooms.rooms[requestID] = map[*roomClient]bool{}
+	}
+	chatRooms.rooms[requestID][client] = true
+}
+
+func leaveChatRoom(requestID int, client *roomClient) {
+	chatRooms.Lock()
+	defer chatRooms.Unlock()
+	delete(chatRooms.rooms[requestID], client)
+	if len(chatRooms.rooms[requestID]) == 0 {
+		delete(chatRooms.rooms, requestID)
+	}
+}
+
+// broadcastChat sends frame to every connection in the room except skip, which may be nil.
+func broadcastChat(requestID int, skip *roomClient, frame chatFrame) {
+	chatRooms.Lock()
+	clients := make([]*roomClient, 0, len(chatRooms.rooms[requestID]))
+	for client := range chatRooms.rooms[requestID] {
+		if client != skip {
+			clients = append(clients, client)
+		}
+	}
+	chatRooms.Unlock()
+
+	for _, client := range clients {
+		if err := client.send(frame); err != nil {
+			// The client's own read loop notices the broken connection and leaves
+			log.Printf("Failed to send chat %s frame for consultation request %d: %s", frame.Type, requestID, err)
+		}
+	}
+}
+
+// loadChatMessages returns up to limit messages of a consultation sent before
+// the message before (or the newest when before is zero), oldest first.
+func loadChatMessages(ctx context.Context, requestID int, before primitive.ObjectID, limit int) ([]models.ChatMessage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	filter := bson.M{"requestID": requestID}
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := database.GetCollection("chatMessages").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.ChatMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	// Fetched newest first for the limit; hand them back in reading order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	for i := range messages {
+		if err := database.Decrypt(ctx, &messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// UpgradeConsultationChat godoc
+// @Summary Join a consultation chat
+// @Description Open the WebSocket chat room of a consultation. Only the user and professional on the request can join,
+// @Description and only from 10 minutes before the consultation until 30 minutes after its booked end while it is
+// @Description scheduled or in progress. Browsers, which cannot set headers on a WebSocket, may pass the JWT as the
+// @Description token query parameter. Frames are JSON objects with a type: "message" (body), "typing" (typing),
+// @Description "read" (messageID) and "history" (before, limit).
+// @Tags consultationrequests
+// @Param id path int true "Request ID"
+// @Param token query string false "JWT, when it cannot be sent in the Authorization header"
+// @Success 101
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 426 {object} map[string]string
+// @Router /consultationrequests/{id}/chat [get]
+func UpgradeConsultationChat(c *fiber.Ctx) error {
+	request, party, status, err := admitToRoom(c)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	c.Locals("chatRequest", request)
+	c.Locals("chatParty", party)
+	return c.Next()
+}
+
+// ConsultationChat serves a consultation chat connection once
+// UpgradeConsultationChat has let it in.
+var ConsultationChat = websocket.New(serveConsultationChat)
+
+func serveConsultationChat(conn *websocket.Conn) {
+	request, _ := conn.Locals("chatRequest").(models.ConsultationRequests)
+	party, _ := conn.Locals("chatParty").(string)
+	client := &roomClient{conn: conn, party: party}
+
+	joinChatRoom(request.RequestID, client)
+	defer leaveChatRoom(request.RequestID, client)
+
+	stop := keepRoomAlive(client, request, 4*models.MaxChatMessageLength)
+	defer stop()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Chat connection for consultation request %d closed: %s", request.RequestID, err)
+			}
+			return
+		}
+
+		var frame chatFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			client.send(chatFrame{Type: "error", Error: "Invalid frame"})
+			continue
+		}
+
+		if err := handleChatFrame(client, request.RequestID, frame); err != nil {
+			if err := client.send(chatFrame{Type: "error", Error: err.Error()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleChatFrame acts on one frame from client. Errors are reported back to the client.
+func handleChatFrame(client *roomClient, requestID int, frame chatFrame) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch frame.Type {
+	case "message":
+		body := strings.TrimSpace(frame.Body)
+		if body == "" {
+			return errors.New("Message cannot be empty")
+		}
+		if err := checkLength("Message", body, models.MaxChatMessageLength); err != nil {
+			return err
+		}
+
+		// Check again, as the consultation may have been cancelled or moved since joining
+		var request models.ConsultationRequests
+		if err := database.GetCollection("consultationrequests").FindOne(ctx, bson.M{"requestID": requestID}).Decode(&request); err != nil {
+			return errors.New("Consultation request not found")
+		}
+		if err := checkRoomOpen(request, time.Now()); err != nil {
+			return err
+		}
+
+		message := models.ChatMessage{
+			ID:        primitive.NewObjectID(),
+			RequestID: requestID,
+			UserID:    request.UserID,
+			ProfID:    request.ProfID,
+			Sender:    client.party,
+			Body:      body,
+			SentAt:    time.Now(),
+		}
+		stored := message
+		err := database.Encrypt(ctx, &stored)
+		if errors.Is(err, database.ErrDataKeyDestroyed) {
+			return errPatientDeleted
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := database.GetCollection("chatMessages").InsertOne(ctx, stored); err != nil {
+			return err
+		}
+
+		// The sender gets it back too, confirming the ID and time it was stored with
+		broadcastChat(requestID, nil, chatFrame{Type: "message", Message: &message})
+
+	case "typing":
+		broadcastChat(requestID, client, chatFrame{Type: "typing", Sender: client.party, Typing: frame.Typing})
+
+	case "read":
+		id, err := primitive.ObjectIDFromHex(frame.MessageID)
+		if err != nil {
+			return errors.New("Invalid message ID")
+		}
+
+		// Read receipts cover everything the other side sent up to that message
+		now := time.Now()
+		filter := bson.M{
+			"requestID": requestID,
+			"_id":       bson.M{"$lte": id},
+			"sender":    bson.M{"$ne": client.party},
+			"readAt":    bson.M{"$exists": false},
+		}
+		result, err := database.GetCollection("chatMessages").UpdateMany(ctx, filter, bson.M{"$set": bson.M{"readAt": now}})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			broadcastChat(requestID, client, chatFrame{Type: "read", Sender: client.party, MessageID: id.Hex(), ReadAt: &now})
+		}
+
+	case "history":
+		var before primitive.ObjectID
+		if frame.Before != "" {
+			id, err := primitive.ObjectIDFromHex(frame.Before)
+			if err != nil {
+				return errors.New("Invalid message ID")
+			}
+			before = id
+		}
+
+		messages, err := loadChatMessages(ctx, requestID, before, frame.Limit)
+		if err != nil {
+			return err
+		}
+		return client.send(chatFrame{Type: "history", Messages: messages})
+
+	default:
+		return errors.New("Unknown frame type " + frame.Type)
+	}
+	return nil
+}
+
+// GetChatMessages godoc
+// @Summary Get consultation chat history
+// @Description Page back through a consultation's chat, oldest first within the page. Pass the ID of the first message
+// @Description received as before to get the page before it. Only the user and professional on the request can read it.
+// @Tags consultationrequests
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Request ID"
+// @Param before query string false "Only messages sent before this message ID"
+// @Param limit query int false "Maximum number of messages (default 50, max 100)"
+// @Success 200 {array} models.ChatMessage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /consultationrequests/{id}/messages [get]
+func GetChatMessages(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var before primitive.ObjectID
+	if c.Query("before") != "" {
+		before, err = primitive.ObjectIDFromHex(c.Query("before"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid message ID"})
+		}
+	}
+
+	messages, err := loadChatMessages(ctx, request.RequestID, before, c.QueryInt("limit", 50))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(messages)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// cohortMonthLayout formats ForumBoard.CohortMonth.
+const cohortMonthLayout = "2006-01"
+
+// pregnancyWeeks is the length of a full-term pregnancy, used to turn
+// WeeksAlong into a due date.
+const pregnancyWeeks = 40
+
+// cohortTopic names a due-date club for month, before or after the babies arrive.
+func cohortTopic(month time.Time, born bool) string {
+	if born {
+		return "Babies born in " + month.Format("January 2006")
+	}
+	return "Due in " + month.Format("January 2006")
+}
+
+// cohortMonthPassed reports whether a YYYY-MM cohort month is over.
+func cohortMonthPassed(cohortMonth string, now time.Time) bool {
+	return cohortMonth < now.UTC().Format(cohortMonthLayout)
+}
+
+// findCohortBoard loads the due-date club for the month of dueDate, creating it
+// the first time someone is due that month.
+func findCohortBoard(ctx context.Context, dueDate time.Time) (models.ForumBoard, error) {
+	cohortMonth := dueDate.UTC().Format(cohortMonthLayout)
+	month, _ := time.Parse(cohortMonthLayout, cohortMonth)
+	born := cohortMonthPassed(cohortMonth, time.Now())
+	collection := database.GetCollection("boards")
+
+	var board models.ForumBoard
+	err := collection.FindOne(ctx, bson.M{"cohortMonth": cohortMonth}).Decode(&board)
+	if err != mongo.ErrNoDocuments {
+		return board, err
+	}
+
+	// Upsert so two people joining a new club at once still end up in the same
+	// one; whoever loses the race just leaves a counter value unused
+	boardID, err := database.NextID(ctx, "boardID")
+	if err != nil {
+		return board, err
+	}
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"boardID":     boardID,
+			"topic":       cohortTopic(month, born),
+			"description": "A place for everyone due in " + month.Format("January 2006") + " to share the journey.",
+			"visibility":  models.BoardMembersOnly,
+			"cohortMonth": cohortMonth,
+			"born":        born,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	err = collection.FindOneAndUpdate(ctx, bson.M{"cohortMonth": cohortMonth}, update, opts).Decode(&board)
+	return board, err
+}
+
+// saveDueDate records a user's due date and moves them into its due-date club.
+func saveDueDate(ctx context.Context, userID string, dueDate time.Time) (models.ForumBoard, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return models.ForumBoard{}, err
+	}
+	if _, err := database.GetCollection("users").UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"dueDate": dueDate}}); err != nil {
+		return models.ForumBoard{}, err
+	}
+	return joinCohortBoard(ctx, userID, dueDate)
+}
+
+// joinCohortBoard moves a user into the due-date club for dueDate, leaving any
+// club they were in for a different month.
+func joinCohortBoard(ctx context.Context, userID string, dueDate time.Time) (models.ForumBoard, error) {
+	board, err := findCohortBoard(ctx, dueDate)
+	if err != nil {
+		return board, err
+	}
+
+	filter := bson.M{"cohortMonth": bson.M{"$exists": true}, "boardID": bson.M{"$ne": board.BoardID}}
+	oldBoardIDs, err := database.GetCollection("boards").Distinct(ctx, "boardID", filter)
+	if err != nil {
+		return board, err
+	}
+	if len(oldBoardIDs) > 0 {
+		leave := bson.M{"userID": userID, "boardID": bson.M{"$in": oldBoardIDs}}
+		if _, err := database.GetCollection("boardMembers").DeleteMany(ctx, leave); err != nil {
+			return board, err
+		}
+	}
+
+	// Keep an existing role, so a club manager stays one when re-joining
+	if _, ok := findMembership(ctx, board.BoardID, models.User{ID: userID}, models.HealthCareProfessional{}); ok {
+		return board, nil
+	}
+	_, err = addBoardMember(ctx, models.BoardMember{
+		BoardID: board.BoardID,
+		UserID:  userID,
+		Role:    models.BoardRoleMember,
+	})
+	return board, err
+}
+
+// graduateCohortBoards turns every due-date club whose month has passed into
+// a "babies born in" board.
+func graduateCohortBoards(ctx context.Context) error {
+	collection := database.GetCollection("boards")
+
+	filter := bson.M{
+		"cohortMonth": bson.M{"$lt": time.Now().UTC().Format(cohortMonthLayout)},
+		"born":        bson.M{"$ne": true},
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var boards []models.ForumBoard
+	if err := cursor.All(ctx, &boards); err != nil {
+		return err
+	}
+
+	for _, board := range boards {
+		month, err := time.Parse(cohortMonthLayout, board.CohortMonth)
+		if err != nil {
+			continue
+		}
+		update := bson.M{"$set": bson.M{"born": true, "topic": cohortTopic(month, true)}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"boardID": board.BoardID}, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchCohortBoards graduates due-date clubs as their months pass. It runs
+// for the life of the server, so start it with go.
+func WatchCohortBoards() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := graduateCohortBoards(ctx); err != nil {
+			log.Printf("Failed to graduate due-date clubs: %s", err)
+		}
+		cancel()
+
+		time.Sleep(time.Hour)
+	}
+}
+
+// SetDueDate godoc
+// @Summary Set the due date
+// @Description Set the authenticated user's due date, either directly as dueDate (YYYY-MM-DD) or from weeksAlong
+// @Description as on their health record. The user joins the due-date club for that month and leaves any previous one.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param dueDate body object true "Due date payload, e.g. {\"dueDate\": \"2027-03-14\"} or {\"weeksAlong\": 12}"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/due-date [put]
+func SetDueDate(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		DueDate    string `json:"dueDate"`
+		WeeksAlong *int   `json:"weeksAlong"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var dueDate time.Time
+	switch {
+	case requestData.DueDate != "":
+		dueDate, err = time.Parse("2006-01-02", requestData.DueDate)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Due date must be in YYYY-MM-DD form"})
+		}
+	case requestData.WeeksAlong != nil:
+		weeks := *requestData.WeeksAlong
+		if weeks < 0 || weeks > pregnancyWeeks+2 {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Weeks along must be between 0 and 42"})
+		}
+		dueDate = today.AddDate(0, 0, (pregnancyWeeks-weeks)*7)
+	default:
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Due date or weeks along is required"})
+	}
+
+	// Allow recent births so new parents land in their "babies born in" board
+	if dueDate.Before(today.AddDate(-1, 0, 0)) || dueDate.After(today.AddDate(0, 0, (pregnancyWeeks+2)*7)) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Due date must be within the last year or the next 42 weeks"})
+	}
+
+	board, err := saveDueDate(ctx, user.ID, dueDate)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]interface{}{
+		"dueDate": dueDate,
+		"board":   board,
+	})
+}
@@ -4,26 +4,37 @@ import (
 	"context"
 	"gofiber-mongodb/models"
 	"gofiber-mongodb/server/database"
+	"gofiber-mongodb/server/markdown"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // CreateComment godoc
 // @Summary Create a new comment
-// @Description Create a new comment on a post
+// @Description Create a new comment on a post as the authenticated user or professional.
+// @Description Comments by verified professionals carry a server-set badge.
 // @Tags comments
 // @Accept  json
 // @Produce  json
 // @Param comment body models.Comment true "Comment Payload"
 // @Success 200 {object} models.Comment
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /comments [post]
 func CreateComment(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	collection := database.GetCollection("comments")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -33,14 +44,129 @@ func CreateComment(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
 	}
 
-	comment.CommentID = int(primitive.NewObjectID().Timestamp().Unix())
+	if strings.TrimSpace(comment.Content) == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Content is required"})
+	}
+	if err := checkLength("Content", comment.Content, models.MaxCommentContentLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var post models.Post
+	err = database.GetCollection("posts").FindOne(ctx, bson.M{"postID": comment.PostID}).Decode(&post)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+
+	board, err := findBoard(ctx, post.BoardID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+	if !canAccessBoard(ctx, board, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	if comment.Anonymous {
+		if prof.ProfID != 0 {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Professionals cannot comment anonymously"})
+		}
+		if !board.AllowAnonymous {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "This board does not allow anonymous comments"})
+		}
+	}
+
+	attachments, err := claimAttachments(ctx, comment.Attachments, user.ID, prof.ProfID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	comment.Attachments = hexIDs(attachments)
+
+	// Authorship and badges are never taken from the request body
+	commentID, err := database.NextID(ctx, "commentID")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	comment.CommentID = commentID
+	comment.UserID = user.ID
+	comment.ProfID = prof.ProfID
+	comment.Badge = professionalBadge(prof)
+	comment.Pseudonym = ""
+	comment.ContentHTML = markdown.Render(comment.Content)
 	comment.CreationDateTime = time.Now()
+	comment.EditDateTime = time.Time{}
+	comment.Edited = false
+
+	if comment.Mentions, err = resolveMentions(ctx, comment.Content); err != nil {
+		log.Printf("Failed to resolve mentions in new comment: %s", err)
+	}
+
+	actorID, authorName := user.ID, user.FirstName
+	if comment.Anonymous {
+		// The real author is kept out of the comment document entirely
+		if err := recordAnonymousAuthor(ctx, comment.PostID, comment.CommentID, user.ID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		comment.UserID = ""
+		comment.Pseudonym = threadPseudonym(comment.PostID, user.ID)
+		actorID, authorName = "", comment.Pseudonym
+	}
 
-	_, err := collection.InsertOne(ctx, comment)
+	_, err = collection.InsertOne(ctx, comment)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
 	}
 
+	if err := linkAttachments(ctx, attachments, comment.PostID, comment.CommentID); err != nil {
+		log.Printf("Failed to link attachments to comment %d: %s", comment.CommentID, err)
+	}
+
+	if err := updatePostActivity(ctx, post.PostID, 1); err != nil {
+		log.Printf("Failed to update activity on post %d: %s", post.PostID, err)
+	}
+
+	if comment.Badge != nil {
+		authorName = comment.Badge.Name + " (verified professional)"
+
+		update := bson.M{
+			"$set": bson.M{"hasProfessionalAnswer": true},
+		}
+		if _, err := database.GetCollection("posts").UpdateOne(ctx, bson.M{"postID": post.PostID}, update); err != nil {
+			log.Printf("Failed to flag post %d as professionally answered: %s", post.PostID, err)
+		}
+	} else if prof.ProfID != 0 {
+		authorName = prof.FirstName
+	}
+
+	// Commenting on a thread subscribes you to it
+	if user.ID != "" {
+		if err := subscribe(ctx, models.Subscription{UserID: user.ID, PostID: comment.PostID}); err != nil {
+			log.Printf("Failed to subscribe %s to post %d: %s", user.ID, comment.PostID, err)
+		}
+	}
+
+	comment.SupportResources = screenForCrisis(ctx, models.ModerationFlag{
+		TargetType: "comment",
+		PostID:     comment.PostID,
+		CommentID:  comment.CommentID,
+		UserID:     comment.UserID,
+	}, comment.Content)
+
+	go notifySubscribers(board, bson.M{"postID": comment.PostID}, user.ID, models.Notification{
+		ActorID:   actorID,
+		Type:      models.NotificationNewComment,
+		BoardID:   post.BoardID,
+		PostID:    comment.PostID,
+		CommentID: comment.CommentID,
+		Message:   authorName + " replied to a thread you follow: " + excerpt(comment.Content),
+	})
+
+	go notifyMentions(board, comment.Mentions, user.ID, prof.ProfID, models.Notification{
+		ActorID:   actorID,
+		BoardID:   post.BoardID,
+		PostID:    comment.PostID,
+		CommentID: comment.CommentID,
+		Message:   authorName + " mentioned you in a comment: " + excerpt(comment.Content),
+	})
+
 	return c.Status(http.StatusOK).JSON(comment)
 }
 
@@ -50,8 +176,10 @@ func CreateComment(c *fiber.Ctx) error {
 // @Tags comments
 // @Accept  json
 // @Produce  json
-// @Param id path string true "Comment ID"
+// @Param id path int true "Comment ID"
 // @Success 200 {object} models.Comment
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /comments/{id} [get]
@@ -60,74 +188,228 @@ func GetComment(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	id, _ := primitive.ObjectIDFromHex(c.Params("id"))
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid comment ID"})
+	}
+
 	var comment models.Comment
-	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&comment)
+	err = collection.FindOne(ctx, bson.M{"commentID": id}).Decode(&comment)
 	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Comment not found"})
 	}
 
+	user, prof := optionalCaller(c)
+	if !canAccessComment(ctx, comment, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
 	return c.Status(http.StatusOK).JSON(comment)
 }
 
 // UpdateComment godoc
 // @Summary Update a comment
-// @Description Update a comment by ID
+// @Description Edit the content of a comment. Only the author may edit, and the previous content is kept as a revision.
 // @Tags comments
 // @Accept  json
 // @Produce  json
-// @Param id path string true "Comment ID"
-// @Param comment body models.Comment true "Comment Payload"
+// @Param id path int true "Comment ID"
+// @Param comment body models.Comment true "Comment Payload (only content is used)"
 // @Success 200 {object} models.Comment
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /comments/{id} [put]
 func UpdateComment(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	collection := database.GetCollection("comments")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	id, _ := primitive.ObjectIDFromHex(c.Params("id"))
-	var comment models.Comment
-	if err := c.BodyParser(&comment); err != nil {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid comment ID"})
+	}
+
+	var requestData struct {
+		Content string `json:"content"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
 	}
 
+	if strings.TrimSpace(requestData.Content) == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Content is required"})
+	}
+	if err := checkLength("Content", requestData.Content, models.MaxCommentContentLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var comment models.Comment
+	if err := collection.FindOne(ctx, bson.M{"commentID": id}).Decode(&comment); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Comment not found"})
+	}
+
+	if !isCommentAuthor(ctx, comment, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the author can edit this comment"})
+	}
+
+	board, err := postBoard(ctx, comment.PostID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+	if !canAccessBoard(ctx, board, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	if requestData.Content == comment.Content {
+		return c.Status(http.StatusOK).JSON(comment)
+	}
+
+	revision := models.Revision{
+		PostID:    comment.PostID,
+		CommentID: comment.CommentID,
+		Content:   comment.Content,
+		WrittenAt: comment.CreationDateTime,
+	}
+	if comment.Edited {
+		revision.WrittenAt = comment.EditDateTime
+	}
+
+	mentions, err := resolveMentions(ctx, requestData.Content)
+	if err != nil {
+		log.Printf("Failed to resolve mentions in comment %d: %s", id, err)
+		mentions = comment.Mentions
+	}
+
+	now := time.Now()
+	contentHTML := markdown.Render(requestData.Content)
 	update := bson.M{
-		"$set": comment,
+		"$set": bson.M{
+			"content":      requestData.Content,
+			"contentHTML":  contentHTML,
+			"mentions":     mentions,
+			"editDateTime": now,
+			"edited":       true,
+		},
 	}
 
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	// Matching on the old content makes a concurrent edit fail instead of losing a revision
+	result, err := collection.UpdateOne(ctx, bson.M{"commentID": id, "content": comment.Content}, update)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
 	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Comment was edited concurrently, please retry"})
+	}
+
+	if err := saveRevision(ctx, revision, now); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	added := newMentions(mentions, comment.Mentions)
+
+	comment.Content = requestData.Content
+	comment.ContentHTML = contentHTML
+	comment.Mentions = mentions
+	comment.EditDateTime = now
+	comment.Edited = true
+
+	actorID, authorName := user.ID, user.FirstName
+	switch {
+	case comment.Anonymous:
+		actorID, authorName = "", comment.Pseudonym
+	case prof.ProfID != 0:
+		authorName = prof.FirstName
+	}
+	go notifyMentions(board, added, user.ID, prof.ProfID, models.Notification{
+		ActorID:   actorID,
+		BoardID:   board.BoardID,
+		PostID:    comment.PostID,
+		CommentID: comment.CommentID,
+		Message:   authorName + " mentioned you in a comment: " + excerpt(comment.Content),
+	})
+
+	comment.SupportResources = screenForCrisis(ctx, models.ModerationFlag{
+		TargetType: "comment",
+		PostID:     comment.PostID,
+		CommentID:  comment.CommentID,
+		UserID:     comment.UserID,
+	}, comment.Content)
 
 	return c.Status(http.StatusOK).JSON(comment)
 }
 
 // DeleteComment godoc
 // @Summary Delete a comment
-// @Description Delete a comment by ID
+// @Description Delete a comment by ID. Only the author or a moderator may delete.
 // @Tags comments
 // @Accept  json
 // @Produce  json
-// @Param id path string true "Comment ID"
+// @Param id path int true "Comment ID"
 // @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /comments/{id} [delete]
 func DeleteComment(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	collection := database.GetCollection("comments")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	id, _ := primitive.ObjectIDFromHex(c.Params("id"))
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid comment ID"})
+	}
 
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	var comment models.Comment
+	if err := collection.FindOne(ctx, bson.M{"commentID": id}).Decode(&comment); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Comment not found"})
+	}
+
+	if !isModerator(user) && !isCommentAuthor(ctx, comment, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the author or a moderator can delete this comment"})
+	}
+	if !canAccessComment(ctx, comment, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	_, err = collection.DeleteOne(ctx, bson.M{"commentID": id})
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
 	}
 
+	if err := updatePostActivity(ctx, comment.PostID, -1); err != nil {
+		log.Printf("Failed to update activity on post %d: %s", comment.PostID, err)
+	}
+
+	if err := deleteAttachments(ctx, bson.M{"commentID": id}); err != nil {
+		log.Printf("Failed to delete attachments of comment %d: %s", id, err)
+	}
+
 	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Comment deleted"})
 }
+
+// isCommentAuthor reports whether the caller, a user or a professional, wrote comment.
+func isCommentAuthor(ctx context.Context, comment models.Comment, user models.User, prof models.HealthCareProfessional) bool {
+	if prof.ProfID != 0 {
+		return comment.ProfID == prof.ProfID
+	}
+
+	authorID, err := commentAuthorID(ctx, comment)
+	return err == nil && authorID != "" && authorID == user.ID
+}
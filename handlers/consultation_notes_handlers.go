@@ -2,128 +2,425 @@ package handlers
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"gofiber-mongodb/models"
 	"gofiber-mongodb/server/database"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// signNoteVersion computes the signature of version, chained to the
+// signature of the version before it.
+func signNoteVersion(noteID primitive.ObjectID, version models.ConsultationNoteVersion, previous string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	fmt.Fprintf(mac, "%s\x00%d\x00%s\x00%s\x00%s\x00%d\x00%d\x00%s",
+		noteID.Hex(), version.Version, version.Notes, version.Visibility, version.Reason,
+		version.AuthorProfID, version.SignedAt.UnixMilli(), previous)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newNoteVersion builds and signs the next version of note.
+func newNoteVersion(note models.ConsultationNotes, text, visibility, reason string, profID int) models.ConsultationNoteVersion {
+	previous := ""
+	if n := len(note.Versions); n > 0 {
+		previous = note.Versions[n-1].Signature
+	}
+
+	version := models.ConsultationNoteVersion{
+		Version:      len(note.Versions) + 1,
+		Notes:        text,
+		Visibility:   visibility,
+		Reason:       reason,
+		AuthorProfID: profID,
+		// MongoDB keeps milliseconds, so sign what will be read back
+		SignedAt: time.Now().Truncate(time.Millisecond),
+	}
+	version.Signature = signNoteVersion(note.ID, version, previous)
+	return version
+}
+
+// verifyNote marks which of note's versions still match their signatures.
+// Once a version fails, every later one fails too.
+func verifyNote(note *models.ConsultationNotes) {
+	previous := ""
+	intact := true
+	for i := range note.Versions {
+		version := &note.Versions[i]
+		expected := signNoteVersion(note.ID, *version, previous)
+		intact = intact && hmac.Equal([]byte(expected), []byte(version.Signature))
+		version.Intact = intact
+		previous = version.Signature
+	}
+}
+
+// openNote decrypts note and verifies its versions, then, for the patient,
+// leaves out any versions written while the note was professional-only. If
+// the patient's key has been destroyed the note is marked erased instead.
+func openNote(ctx context.Context, note *models.ConsultationNotes, prof models.HealthCareProfessional) error {
+	err := database.Decrypt(ctx, note)
+	if errors.Is(err, database.ErrDataKeyDestroyed) {
+		note.Erased = true
+		for i := range note.Versions {
+			note.Versions[i].Notes = ""
+			note.Versions[i].Reason = ""
+		}
+	} else if err != nil {
+		return err
+	} else {
+		verifyNote(note)
+	}
+
+	if prof.ProfID != 0 {
+		return nil
+	}
+
+	shown := []models.ConsultationNoteVersion{}
+	for _, version := range note.Versions {
+		if version.Visibility == models.NoteShared {
+			shown = append(shown, version)
+		}
+	}
+	note.Versions = shown
+	return nil
+}
+
+// errPatientDeleted is returned when writing a note or message for a patient
+// whose account, and with it their encryption key, has been deleted.
+var errPatientDeleted = errors.New("The patient has deleted their account")
+
+// encryptedNoteVersions returns note's versions encrypted for storage,
+// leaving note itself readable.
+func encryptedNoteVersions(ctx context.Context, note models.ConsultationNotes) ([]models.ConsultationNoteVersion, error) {
+	note.Versions = append([]models.ConsultationNoteVersion(nil), note.Versions...)
+	err := database.Encrypt(ctx, &note)
+	return note.Versions, err
+}
+
+// validateNoteInput checks the text and visibility of a note version.
+func validateNoteInput(text, visibility string) error {
+	if strings.TrimSpace(text) == "" {
+		return errors.New("Notes are required")
+	}
+	if err := checkLength("Notes", text, models.MaxConsultationNoteLength); err != nil {
+		return err
+	}
+	if visibility != models.NoteShared && visibility != models.NoteProfessionalOnly {
+		return fmt.Errorf("Visibility must be %q or %q", models.NoteShared, models.NoteProfessionalOnly)
+	}
+	return nil
+}
+
+// findConsultationNote loads the note in the route from request, hiding
+// professional-only notes from the patient. On failure it returns the HTTP
+// status to respond with.
+func findConsultationNote(c *fiber.Ctx, ctx context.Context, request models.ConsultationRequests, prof models.HealthCareProfessional) (models.ConsultationNotes, int, error) {
+	var note models.ConsultationNotes
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("noteID"))
+	if err != nil {
+		return note, http.StatusBadRequest, errors.New("Invalid note ID")
+	}
+
+	filter := bson.M{"_id": objID, "requestID": request.RequestID}
+	if prof.ProfID == 0 {
+		filter["visibility"] = models.NoteShared
+	}
+	if err := database.GetCollection("consultationnotes").FindOne(ctx, filter).Decode(&note); err != nil {
+		return note, http.StatusNotFound, errors.New("Consultation note not found")
+	}
+	note.UserID = request.UserID
+
+	return note, http.StatusOK, nil
+}
+
 // CreateConsultationNote godoc
-// @Summary Create a new consultation note
-// @Description Create a new consultation note for a request
+// @Summary Write a consultation note
+// @Description Write a clinical note on a consultation as its professional. The note is signed as its first version and
+// @Description can only be changed by amendment. Shared notes are shown to the patient; professional_only notes are not.
 // @Tags consultationnotes
 // @Accept  json
 // @Produce  json
-// @Param note body models.ConsultationNotes true "Consultation Note Payload"
+// @Param id path int true "Request ID"
+// @Param note body object true "Note payload, e.g. {\"notes\": \"...\", \"visibility\": \"shared\"}"
 // @Success 200 {object} models.ConsultationNotes
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 410 {object} map[string]string
 // @Failure 500 {object} map[string]string
-// @Router /consultationnotes [post]
+// @Router /consultationrequests/{id}/notes [post]
 func CreateConsultationNote(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	collection := database.GetCollection("consultationnotes")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var note models.ConsultationNotes
-	if err := c.BodyParser(&note); err != nil {
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+	if prof.ProfID == 0 {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the professional can write notes"})
+	}
+	if request.Status == models.ConsultationPending || request.Status == models.ConsultationDeclined {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Notes can only be written once a consultation is accepted"})
+	}
+
+	var requestData struct {
+		Notes      string `json:"notes"`
+		Visibility string `json:"visibility"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
 	}
+	if err := validateNoteInput(requestData.Notes, requestData.Visibility); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	note := models.ConsultationNotes{
+		ID:           primitive.NewObjectID(),
+		RequestID:    request.RequestID,
+		UserID:       request.UserID,
+		AuthorProfID: prof.ProfID,
+		Visibility:   requestData.Visibility,
+	}
+	version := newNoteVersion(note, requestData.Notes, requestData.Visibility, "", prof.ProfID)
+	note.Version = version.Version
+	note.Versions = []models.ConsultationNoteVersion{version}
+	note.CreatedAt = version.SignedAt
+	note.UpdatedAt = version.SignedAt
+	note.Versions[0].Intact = true
 
-	_, err := collection.InsertOne(ctx, note)
+	stored := note
+	stored.Versions, err = encryptedNoteVersions(ctx, note)
+	if errors.Is(err, database.ErrDataKeyDestroyed) {
+		return c.Status(http.StatusGone).JSON(map[string]string{"error": errPatientDeleted.Error()})
+	}
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
 	}
+	if _, err := collection.InsertOne(ctx, stored); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if note.Visibility == models.NoteShared {
+		notifyConsultationParty(ctx, request, partyProfessional, "Your professional added a note to your consultation")
+	}
 
 	return c.Status(http.StatusOK).JSON(note)
 }
 
-// GetConsultationNote godoc
-// @Summary Get a consultation note by Request ID
-// @Description Get a consultation note by Request ID
+// GetConsultationNotes godoc
+// @Summary List a consultation's notes
+// @Description List the notes on a consultation, oldest first, with every signed version. The patient only sees shared notes.
 // @Tags consultationnotes
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Request ID"
-// @Success 200 {object} models.ConsultationNotes
+// @Success 200 {array} models.ConsultationNotes
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
-// @Router /consultationnotes/{id} [get]
-func GetConsultationNote(c *fiber.Ctx) error {
+// @Router /consultationrequests/{id}/notes [get]
+func GetConsultationNotes(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	collection := database.GetCollection("consultationnotes")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	id := c.Params("id")
-	var note models.ConsultationNotes
-	err := collection.FindOne(ctx, bson.M{"requestID": id}).Decode(&note)
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Consultation note not found"})
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
 	}
 
-	return c.Status(http.StatusOK).JSON(note)
+	filter := bson.M{"requestID": request.RequestID}
+	if prof.ProfID == 0 {
+		filter["visibility"] = models.NoteShared
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	notes := []models.ConsultationNotes{}
+	if err := cursor.All(ctx, &notes); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	for i := range notes {
+		if err := openNote(ctx, &notes[i], prof); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(notes)
 }
 
-// UpdateConsultationNote godoc
-// @Summary Update a consultation note
-// @Description Update a consultation note by Request ID
+// GetConsultationNote godoc
+// @Summary Get a consultation note
+// @Description Get one note on a consultation with every signed version. The patient only sees shared notes.
 // @Tags consultationnotes
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Request ID"
-// @Param note body models.ConsultationNotes true "Consultation Note Payload"
+// @Param noteID path string true "Note ID"
 // @Success 200 {object} models.ConsultationNotes
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /consultationnotes/{id} [put]
-func UpdateConsultationNote(c *fiber.Ctx) error {
-	collection := database.GetCollection("consultationnotes")
+// @Router /consultationrequests/{id}/notes/{noteID} [get]
+func GetConsultationNote(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	id := c.Params("id")
-	var note models.ConsultationNotes
-	if err := c.BodyParser(&note); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
-	}
-
-	update := bson.M{
-		"$set": note,
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
 	}
 
-	_, err := collection.UpdateOne(ctx, bson.M{"requestID": id}, update)
+	note, status, err := findConsultationNote(c, ctx, request, prof)
 	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+	if err := openNote(ctx, &note, prof); err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
 	}
 
 	return c.Status(http.StatusOK).JSON(note)
 }
 
-// DeleteConsultationNote godoc
-// @Summary Delete a consultation note
-// @Description Delete a consultation note by Request ID
+// AmendConsultationNote godoc
+// @Summary Amend a consultation note
+// @Description Sign a new version of a note, with the reason for the change. Earlier versions are kept unchanged. The
+// @Description visibility can be changed by an amendment and defaults to the current one. Only the note's author can amend it.
 // @Tags consultationnotes
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Request ID"
-// @Success 200 {object} map[string]string
+// @Param noteID path string true "Note ID"
+// @Param amendment body object true "Amendment payload, e.g. {\"notes\": \"...\", \"reason\": \"Corrected dosage\", \"visibility\": \"shared\"}"
+// @Success 200 {object} models.ConsultationNotes
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 410 {object} map[string]string
 // @Failure 500 {object} map[string]string
-// @Router /consultationnotes/{id} [delete]
-func DeleteConsultationNote(c *fiber.Ctx) error {
+// @Router /consultationrequests/{id}/notes/{noteID}/amendments [post]
+func AmendConsultationNote(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	collection := database.GetCollection("consultationnotes")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	id := c.Params("id")
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
 
-	_, err := collection.DeleteOne(ctx, bson.M{"requestID": id})
+	note, status, err := findConsultationNote(c, ctx, request, prof)
 	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+	if note.AuthorProfID != prof.ProfID {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the note's author can amend it"})
+	}
+	if err := openNote(ctx, &note, prof); err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
 	}
+	if note.Erased {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "This note has been erased"})
+	}
+
+	var requestData struct {
+		Notes      string `json:"notes"`
+		Reason     string `json:"reason"`
+		Visibility string `json:"visibility"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if requestData.Visibility == "" {
+		requestData.Visibility = note.Visibility
+	}
+	if err := validateNoteInput(requestData.Notes, requestData.Visibility); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	reason := strings.TrimSpace(requestData.Reason)
+	if reason == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "A reason for the amendment is required"})
+	}
+	if err := checkLength("Reason", reason, maxReasonLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
 
-	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Consultation note deleted"})
+	version := newNoteVersion(note, requestData.Notes, requestData.Visibility, reason, prof.ProfID)
+	sealed, err := encryptedNoteVersions(ctx, models.ConsultationNotes{UserID: note.UserID, Versions: []models.ConsultationNoteVersion{version}})
+	if errors.Is(err, database.ErrDataKeyDestroyed) {
+		return c.Status(http.StatusGone).JSON(map[string]string{"error": errPatientDeleted.Error()})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"version":    version.Version,
+			"visibility": version.Visibility,
+			"updatedAt":  version.SignedAt,
+		},
+		"$push": bson.M{"versions": sealed[0]},
+	}
+
+	// Matching on the old version keeps two amendments from both chaining to it
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": note.ID, "version": note.Version}, update)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Note was amended concurrently, please retry"})
+	}
+
+	note.Version = version.Version
+	note.Visibility = version.Visibility
+	note.UpdatedAt = version.SignedAt
+	note.Versions = append(note.Versions, version)
+	verifyNote(&note)
+
+	if note.Visibility == models.NoteShared {
+		notifyConsultationParty(ctx, request, partyProfessional, "Your professional amended a note on your consultation")
+	}
+
+	return c.Status(http.StatusOK).JSON(note)
 }
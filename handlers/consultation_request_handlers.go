@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The parties to a consultation request, used to say who may make a status change.
+const (
+	partyUser         = "user"
+	partyProfessional = "professional"
+	partyEither       = "either"
+)
+
+// maxReasonLength bounds the short explanation that can accompany a status
+// change, a note amendment or time off.
+const maxReasonLength = 500
+
+// consultationTransitions lists, for each status, the statuses it can move to
+// and which party may make that move. Statuses missing here are final.
+var consultationTransitions = map[string]map[string]string{
+	models.ConsultationPending: {
+		models.ConsultationAccepted:  partyProfessional,
+		models.ConsultationDeclined:  partyProfessional,
+		models.ConsultationCancelled: partyUser,
+	},
+	models.ConsultationAccepted: {
+		models.ConsultationScheduled: partyEither,
+		models.ConsultationCancelled: partyEither,
+	},
+	models.ConsultationScheduled: {
+		// Scheduling again moves the consultation to a new time
+		models.ConsultationScheduled:  partyEither,
+		models.ConsultationInProgress: partyProfessional,
+		models.ConsultationCancelled:  partyEither,
+		models.ConsultationNoShow:     partyProfessional,
+	},
+	models.ConsultationInProgress: {
+		models.ConsultationCompleted: partyProfessional,
+	},
+}
+
+// cancelUserConsultations cancels every consultation of a user who is
+// deleting their account, freeing the professional's booked slots and
+// dropping the reminders. Consultations under way are cancelled too, as there
+// is no patient left to finish them with.
+func cancelUserConsultations(ctx context.Context, user models.User) error {
+	collection := database.GetCollection("consultationrequests")
+
+	open := make([]string, 0, len(consultationTransitions))
+	for status := range consultationTransitions {
+		open = append(open, status)
+	}
+	cursor, err := collection.Find(ctx, bson.M{"userID": user.ID, "status": bson.M{"$in": open}})
+	if err != nil {
+		return err
+	}
+	var requests []models.ConsultationRequests
+	if err := cursor.All(ctx, &requests); err != nil {
+		return err
+	}
+
+	for _, request := range requests {
+		change := models.ConsultationStatusChange{
+			Status:    models.ConsultationCancelled,
+			UserID:    user.ID,
+			Note:      "Account deleted",
+			ChangedAt: time.Now(),
+		}
+		update := bson.M{
+			"$set":  bson.M{"status": models.ConsultationCancelled},
+			"$push": bson.M{"statusHistory": change},
+			"$inc":  bson.M{"sequence": 1},
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"requestID": request.RequestID, "status": request.Status}, update); err != nil {
+			return err
+		}
+		if err := releaseBookings(ctx, request.RequestID, primitive.NilObjectID); err != nil {
+			return err
+		}
+		if err := cancelConsultationReminders(ctx, request.RequestID); err != nil {
+			return err
+		}
+
+		request.Status = models.ConsultationCancelled
+		notifyConsultationParty(ctx, request, partyUser, "A consultation was cancelled because the patient deleted their account")
+	}
+	return nil
+}
+
+// consultationParty reports which side of request the caller is on, or ""
+// if they are not part of it.
+func consultationParty(request models.ConsultationRequests, user models.User, prof models.HealthCareProfessional) string {
+	switch {
+	case prof.ProfID != 0 && request.ProfID == prof.ProfID:
+		return partyProfessional
+	case user.ID != "" && request.UserID == user.ID:
+		return partyUser
+	}
+	return ""
+}
+
+// findConsultationRequest loads the consultation request in the route and
+// checks that the caller is one of its parties. On failure it returns the
+// HTTP status to respond with.
+func findConsultationRequest(c *fiber.Ctx, ctx context.Context, user models.User, prof models.HealthCareProfessional) (models.ConsultationRequests, int, error) {
+	var request models.ConsultationRequests
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return request, http.StatusBadRequest, errors.New("Invalid request ID")
+	}
+
+	if err := database.GetCollection("consultationrequests").FindOne(ctx, bson.M{"requestID": id}).Decode(&request); err != nil {
+		return request, http.StatusNotFound, errors.New("Consultation request not found")
+	}
+
+	// Outsiders get the same answer as for a missing request
+	if consultationParty(request, user, prof) == "" {
+		return request, http.StatusNotFound, errors.New("Consultation request not found")
+	}
+
+	return request, http.StatusOK, nil
+}
+
+// notifyConsultationParty tells the other side of request about a change made by party.
+func notifyConsultationParty(ctx context.Context, request models.ConsultationRequests, party, message string) {
+	n := models.Notification{
+		Type:      models.NotificationConsultation,
+		RequestID: request.RequestID,
+		Message:   message,
+	}
+
+	var err error
+	if party == partyProfessional {
+		err = notifyUsers(ctx, []string{request.UserID}, "", n)
+	} else {
+		err = notifyProfessionals(ctx, []int{request.ProfID}, n)
+	}
+	if err != nil {
+		log.Printf("Failed to notify about consultation request %d: %s", request.RequestID, err)
+	}
+}
+
+// CreateConsultationRequest godoc
+// @Summary Request a consultation
+// @Description Ask a healthcare professional for a consultation as the authenticated user. The request starts pending.
+// @Tags consultationrequests
+// @Accept  json
+// @Produce  json
+// @Param request body object true "Consultation request payload, e.g. {\"profID\": 123, \"communicationType\": \"video\", \"description\": \"...\", \"preferredGender\": \"female\", \"consultationDateTime\": \"2026-03-14T10:00:00Z\"}"
+// @Success 200 {object} models.ConsultationRequests
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /consultationrequests [post]
+func CreateConsultationRequest(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("consultationrequests")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		ProfID               int       `json:"profID"`
+		CommunicationType    string    `json:"communicationType"`
+		Description          string    `json:"description"`
+		PreferredGender      string    `json:"preferredGender"`
+		ConsultationDateTime time.Time `json:"consultationDateTime"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	request := models.ConsultationRequests{
+		ProfID:               requestData.ProfID,
+		CommunicationType:    requestData.CommunicationType,
+		Description:          requestData.Description,
+		PreferredGender:      requestData.PreferredGender,
+		ConsultationDateTime: requestData.ConsultationDateTime,
+	}
+	if request.ProfID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Professional ID is required"})
+	}
+	request.CommunicationType = strings.TrimSpace(request.CommunicationType)
+	if request.CommunicationType == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Communication type is required"})
+	}
+	if err := checkLength("Description", request.Description, models.MaxConsultationDescriptionLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if !request.ConsultationDateTime.IsZero() && !request.ConsultationDateTime.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Consultation time must be in the future"})
+	}
+
+	var prof models.HealthCareProfessional
+	if err := database.GetCollection("professionals").FindOne(ctx, bson.M{"profID": request.ProfID}).Decode(&prof); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Professional not found"})
+	}
+	if !prof.IsConsultant {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "This professional does not take consultations"})
+	}
+
+	requestID, err := database.NextID(ctx, "requestID")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	now := time.Now()
+	request.RequestID = requestID
+	request.UserID = user.ID
+	request.Status = models.ConsultationPending
+	request.CreatedAt = now
+	request.StatusHistory = []models.ConsultationStatusChange{{
+		Status:    models.ConsultationPending,
+		UserID:    user.ID,
+		ChangedAt: now,
+	}}
+
+	if _, err := collection.InsertOne(ctx, request); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	notifyConsultationParty(ctx, request, partyUser, user.FirstName+" requested a consultation")
+
+	return c.Status(http.StatusOK).JSON(request)
+}
+
+// GetConsultationRequests godoc
+// @Summary List consultation requests
+// @Description List the consultation requests the authenticated user made, or a professional received, newest first
+// @Tags consultationrequests
+// @Accept  json
+// @Produce  json
+// @Param status query string false "Only return requests with this status"
+// @Param limit query int false "Maximum number of requests (default 50, max 100)"
+// @Success 200 {array} models.ConsultationRequests
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /consultationrequests [get]
+func GetConsultationRequests(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("consultationrequests")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := memberFilter(user, prof)
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	requests := []models.ConsultationRequests{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(requests)
+}
+
+// GetConsultationRequest godoc
+// @Summary Get a consultation request
+// @Description Get a consultation request with its status history. Only the user and professional on the request can see it.
+// @Tags consultationrequests
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Request ID"
+// @Success 200 {object} models.ConsultationRequests
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /consultationrequests/{id} [get]
+func GetConsultationRequest(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(request)
+}
+
+// UpdateConsultationStatus godoc
+// @Summary Change the status of a consultation request
+// @Description Move a consultation request along: pending to accepted or declined, accepted to scheduled, scheduled to
+// @Description in_progress, in_progress to completed, or to cancelled or no_show. The professional accepts, declines,
+// @Description starts, completes and records no-shows; the user can cancel a pending request; either side can schedule
+// @Description or cancel once accepted. Scheduling books the slot starting at consultationDateTime on the professional's
+// @Description calendar, for length minutes (default their slot length); declining, cancelling or a no-show frees it.
+// @Description Scheduling a scheduled request again moves it to the new slot. Both sides are reminded 24 hours and 1 hour
+// @Description before the consultation on their preferred channels.
+// @Tags consultationrequests
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Request ID"
+// @Param change body object true "Status change payload, e.g. {\"status\": \"scheduled\", \"consultationDateTime\": \"2026-03-14T10:00:00Z\", \"length\": 30, \"note\": \"...\"}"
+// @Success 200 {object} models.ConsultationRequests
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /consultationrequests/{id}/status [put]
+func UpdateConsultationStatus(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("consultationrequests")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Status               string    `json:"status"`
+		ConsultationDateTime time.Time `json:"consultationDateTime"`
+		Length               int       `json:"length"`
+		Note                 string    `json:"note"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	note := strings.TrimSpace(requestData.Note)
+	if err := checkLength("Note", note, maxReasonLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	allowed, ok := consultationTransitions[request.Status][requestData.Status]
+	if !ok {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": fmt.Sprintf("Cannot move a %s request to %q", request.Status, requestData.Status)})
+	}
+	party := consultationParty(request, user, prof)
+	if allowed != partyEither && allowed != party {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the " + allowed + " can make this change"})
+	}
+
+	now := time.Now()
+	set := bson.M{"status": requestData.Status}
+	if requestData.Status == models.ConsultationScheduled {
+		when := requestData.ConsultationDateTime
+		if when.IsZero() {
+			when = request.ConsultationDateTime
+		}
+		if !when.After(now) {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Scheduling needs a consultation time in the future"})
+		}
+		set["consultationDateTime"] = when
+		request.ConsultationDateTime = when
+	}
+
+	var booking models.Booking
+	if requestData.Status == models.ConsultationScheduled {
+		booking, status, err = bookSlot(ctx, request, request.ConsultationDateTime, requestData.Length)
+		if err != nil {
+			return c.Status(status).JSON(map[string]string{"error": err.Error()})
+		}
+		request.DurationMinutes = int(booking.End.Sub(booking.Start) / time.Minute)
+		set["durationMinutes"] = request.DurationMinutes
+	}
+
+	change := models.ConsultationStatusChange{
+		Status:    requestData.Status,
+		UserID:    user.ID,
+		ProfID:    prof.ProfID,
+		Note:      note,
+		ChangedAt: now,
+	}
+	update := bson.M{
+		"$set":  set,
+		"$push": bson.M{"statusHistory": change},
+		"$inc":  bson.M{"sequence": 1},
+	}
+
+	// Matching on the old status makes a concurrent change fail instead of skipping a step
+	result, err := collection.UpdateOne(ctx, bson.M{"requestID": request.RequestID, "status": request.Status}, update)
+	if err != nil || result.MatchedCount == 0 {
+		if !booking.ID.IsZero() {
+			if _, err := database.GetCollection("bookings").UpdateOne(ctx, bson.M{"_id": booking.ID}, bson.M{"$set": bson.M{"status": models.BookingReleased}}); err != nil {
+				log.Printf("Failed to release booking %s: %s", booking.ID.Hex(), err)
+			}
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Consultation request was changed concurrently, please retry"})
+	}
+
+	switch requestData.Status {
+	case models.ConsultationScheduled:
+		// A reschedule leaves the old slot booked until now
+		if err := releaseBookings(ctx, request.RequestID, booking.ID); err != nil {
+			log.Printf("Failed to release bookings for consultation request %d: %s", request.RequestID, err)
+		}
+		if err := scheduleConsultationReminders(ctx, request); err != nil {
+			log.Printf("Failed to schedule reminders for consultation request %d: %s", request.RequestID, err)
+		}
+	case models.ConsultationDeclined, models.ConsultationCancelled, models.ConsultationNoShow:
+		if err := releaseBookings(ctx, request.RequestID, primitive.NilObjectID); err != nil {
+			log.Printf("Failed to release bookings for consultation request %d: %s", request.RequestID, err)
+		}
+	}
+	if requestData.Status != models.ConsultationScheduled {
+		if err := cancelConsultationReminders(ctx, request.RequestID); err != nil {
+			log.Printf("Failed to cancel reminders for consultation request %d: %s", request.RequestID, err)
+		}
+	}
+
+	request.Status = requestData.Status
+	request.Sequence++
+	request.StatusHistory = append(request.StatusHistory, change)
+
+	message := "Your consultation request is now " + strings.ReplaceAll(request.Status, "_", " ")
+	notifyConsultationParty(ctx, request, party, message)
+
+	return c.Status(http.StatusOK).JSON(request)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"gofiber-mongodb/models"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// A consultation room is a WebSocket shared by the two sides of a scheduled
+// consultation, for its chat or its video call. Rooms are tracked in memory,
+// so both sides must reach the same server for live events.
+
+const (
+	// roomEarlyJoin is how long before the consultation its rooms open.
+	roomEarlyJoin = 10 * time.Minute
+	// roomOverrun is how long after the booked end the rooms stay open.
+	roomOverrun = 30 * time.Minute
+	// roomDefaultMinutes is the consultation length assumed when none was booked.
+	roomDefaultMinutes = 60
+	// roomPingInterval is how often an idle connection is checked.
+	roomPingInterval = 30 * time.Second
+	// roomWriteTimeout bounds each write to a connection.
+	roomWriteTimeout = 10 * time.Second
+)
+
+// roomWindow returns when the rooms of request open and close.
+func roomWindow(request models.ConsultationRequests) (time.Time, time.Time) {
+	minutes := request.DurationMinutes
+	if minutes == 0 {
+		minutes = roomDefaultMinutes
+	}
+	start := request.ConsultationDateTime
+	return start.Add(-roomEarlyJoin), start.Add(time.Duration(minutes)*time.Minute + roomOverrun)
+}
+
+// checkRoomOpen reports why the rooms of request cannot be used at now, if they cannot.
+func checkRoomOpen(request models.ConsultationRequests, now time.Time) error {
+	if request.Status != models.ConsultationScheduled && request.Status != models.ConsultationInProgress {
+		return errors.New("The consultation room is only open for scheduled consultations")
+	}
+	opens, closes := roomWindow(request)
+	if now.Before(opens) {
+		return errors.New("The consultation room opens 10 minutes before the consultation")
+	}
+	if !now.Before(closes) {
+		return errors.New("The consultation window has ended")
+	}
+	return nil
+}
+
+// admitToRoom checks a WebSocket upgrade into a consultation room: the caller
+// must be one of its parties and the room must be open. Browsers cannot set
+// headers on a WebSocket, so the JWT may come as the token query parameter
+// instead. On failure it returns the HTTP status to respond with.
+func admitToRoom(c *fiber.Ctx) (models.ConsultationRequests, string, int, error) {
+	var request models.ConsultationRequests
+
+	if !websocket.IsWebSocketUpgrade(c) {
+		return request, "", http.StatusUpgradeRequired, errors.New("WebSocket upgrade required")
+	}
+
+	if c.Get("Authorization") == "" && c.Query("token") != "" {
+		c.Request().Header.Set("Authorization", "Bearer "+c.Query("token"))
+	}
+
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return request, "", http.StatusUnauthorized, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, status, err := findConsultationRequest(c, ctx, user, prof)
+	if err != nil {
+		return request, "", status, err
+	}
+	if err := checkRoomOpen(request, time.Now()); err != nil {
+		return request, "", http.StatusForbidden, err
+	}
+
+	return request, consultationParty(request, user, prof), http.StatusOK, nil
+}
+
+// roomClient is one open room connection. Writes are serialised, as the
+// connection allows only one writer at a time.
+type roomClient struct {
+	conn  *websocket.Conn
+	party string
+	mu    sync.Mutex
+}
+
+// send writes v to the connection as JSON.
+func (c *roomClient) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(roomWriteTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteJSON(v)
+}
+
+// close ends the connection with a normal close and reason.
+func (c *roomClient) close(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(roomWriteTimeout))
+	c.conn.Close()
+}
+
+// keepRoomAlive pings client so dead connections are noticed, and closes it
+// when the consultation window ends. Call the returned function once the
+// connection is done with.
+func keepRoomAlive(client *roomClient, request models.ConsultationRequests, readLimit int64) func() {
+	conn := client.conn
+
+	_, closes := roomWindow(request)
+	closer := time.AfterFunc(time.Until(closes), func() {
+		client.close("The consultation window has ended")
+	})
+
+	conn.SetReadLimit(readLimit)
+	conn.SetReadDeadline(time.Now().Add(2 * roomPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * roomPingInterval))
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(roomPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				client.mu.Lock()
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(roomWriteTimeout))
+				client.mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		closer.Stop()
+		close(done)
+	}
+}
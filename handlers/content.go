@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// checkLength rejects text longer than limit characters.
+func checkLength(field, text string, limit int) error {
+	if utf8.RuneCountInString(text) > limit {
+		return fmt.Errorf("%s must be at most %d characters", field, limit)
+	}
+	return nil
+}
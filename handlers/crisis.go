@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/crisis"
+	"gofiber-mongodb/server/database"
+	"log"
+	"time"
+)
+
+// screenForCrisis scans text just written by a user. When crisis rules match it
+// logs the detection, queues a priority flag for moderators and returns the
+// support resources to show the writer. target identifies the content; its
+// text is never stored with the detection or the flag.
+func screenForCrisis(ctx context.Context, target models.ModerationFlag, texts ...string) []models.SupportResource {
+	engine := crisis.Default()
+
+	matches := engine.Scan(texts...)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	var ruleIDs, categories []string
+	seen := map[string]bool{}
+	priority := models.FlagPriorityHigh
+	for _, match := range matches {
+		ruleIDs = append(ruleIDs, match.RuleID)
+		if !seen[match.Category] {
+			seen[match.Category] = true
+			categories = append(categories, match.Category)
+		}
+		priority = max(priority, match.Priority)
+	}
+
+	now := time.Now()
+	detection := models.CrisisDetection{
+		TargetType: target.TargetType,
+		PostID:     target.PostID,
+		CommentID:  target.CommentID,
+		JournalID:  target.JournalID,
+		UserID:     target.UserID,
+		RuleIDs:    ruleIDs,
+		Categories: categories,
+		CreatedAt:  now,
+	}
+	if _, err := database.GetCollection("crisisDetections").InsertOne(ctx, detection); err != nil {
+		log.Printf("Failed to log crisis detection on %s: %s", target.TargetType, err)
+	}
+
+	target.Reason = models.FlagReasonCrisis
+	target.Categories = categories
+	target.Priority = min(priority, models.FlagPriorityUrgent)
+	target.Status = models.FlagStatusOpen
+	target.CreatedAt = now
+	if _, err := database.GetCollection("moderationQueue").InsertOne(ctx, target); err != nil {
+		log.Printf("Failed to queue crisis flag on %s: %s", target.TargetType, err)
+	}
+
+	return engine.Resources(matches)
+}
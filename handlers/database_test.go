@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/server/database"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var testDB struct {
+	once sync.Once
+	err  error
+}
+
+// connectTestDB points the database package at the MongoDB in
+// TEST_MONGODB_URI, skipping the test when it is not set or cannot be
+// reached. Use a throwaway server: the handlers write to the same database
+// the app does, and tests only remove the documents they created.
+func connectTestDB(t *testing.T) {
+	t.Helper()
+
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+
+	testDB.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		if err != nil {
+			testDB.err = err
+			return
+		}
+		if err := client.Ping(ctx, nil); err != nil {
+			testDB.err = err
+			return
+		}
+		database.MongoClient = client
+		database.EnsureIndexes()
+	})
+	if testDB.err != nil {
+		t.Skipf("MongoDB is not available: %s", testDB.err)
+	}
+}
+
+// insertTestDocument adds doc to a collection and removes it when the test ends.
+func insertTestDocument(t *testing.T, collection string, doc interface{}) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := database.GetCollection(collection).InsertOne(ctx, doc)
+	if err != nil {
+		t.Fatalf("Failed to insert into %s: %s", collection, err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		database.GetCollection(collection).DeleteOne(ctx, bson.M{"_id": result.InsertedID})
+	})
+}
+
+// nextTestID returns a fresh integer ID from the named counter.
+func nextTestID(t *testing.T, name string) int {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := database.NextID(ctx, name)
+	if err != nil {
+		t.Fatalf("Failed to allocate %s: %s", name, err)
+	}
+	return id
+}
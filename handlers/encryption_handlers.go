@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DeleteAccount godoc
+// @Summary Delete your account
+// @Description Delete the authenticated user's account after checking their password. Their encryption key is destroyed
+// @Description first, so their journal, health record, consultation notes and chats become unreadable everywhere, backups
+// @Description included. Open consultations are cancelled. Forum posts and comments are kept.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param confirmation body object true "Confirmation payload, e.g. {\"password\": \"...\"}"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /user [delete]
+func DeleteAccount(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(requestData.Password)); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Incorrect password"})
+	}
+
+	// Shred the key before anything else, so a failure part way still leaves the data unreadable
+	if err := database.DestroyDataKeys(ctx, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := cancelUserConsultations(ctx, user); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	for _, name := range []string{"journals", "healthrecords", "calendarFeeds", "notificationPreferences", "chatMessages", "userAddresses"} {
+		if _, err := database.GetCollection(name).DeleteMany(ctx, bson.M{"userID": user.ID}); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	objID, err := primitive.ObjectIDFromHex(user.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if _, err := database.GetCollection("users").DeleteOne(ctx, bson.M{"_id": objID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Account deleted"})
+}
+
+// RotateMasterKey godoc
+// @Summary Rotate the master encryption key
+// @Description Make a new master key current and rewrap every user's data key under it. Admins only.
+// @Tags encryption
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/keys/rotate [post]
+func RotateMasterKey(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if user.Role != models.RoleAdmin {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Admin access required"})
+	}
+
+	// Rewrapping touches every data key, so allow it longer than a normal request
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	masterKeyID, rewrapped, err := database.RotateMasterKey(ctx)
+	if err != nil {
+		// Keys not yet rewrapped stay readable under the old master key, so rotating again finishes the job
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": fmt.Sprintf("Rotation stopped after %d keys: %s", rewrapped, err)})
+	}
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditRotateMasterKey,
+		TargetType: "masterKey",
+		TargetName: masterKeyID,
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]interface{}{
+		"masterKeyID": masterKeyID,
+		"rewrapped":   rewrapped,
+	})
+}
+
+// RotateUserDataKey godoc
+// @Summary Rotate a user's data key
+// @Description Start a new data key for a user. New writes use it and existing data stays readable. Admins only.
+// @Tags encryption
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/keys/users/{id}/rotate [post]
+func RotateUserDataKey(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if user.Role != models.RoleAdmin {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Admin access required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "User not found"})
+	}
+	count, err := database.GetCollection("users").CountDocuments(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if count == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "User not found"})
+	}
+
+	version, err := database.RotateDataKey(ctx, objID.Hex())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditRotateDataKey,
+		TargetType: "user",
+		TargetName: objID.Hex(),
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]interface{}{
+		"userID":  objID.Hex(),
+		"version": version,
+	})
+}
+
+// journalTextFields are the stored names of a journal's encrypted fields, in
+// the order HealthJournal.EncryptedFields lists them.
+var journalTextFields = []string{
+	"feeling", "gratitudes", "selfCare", "thoughts",
+	"feelingHTML", "gratitudesHTML", "selfCareHTML", "thoughtsHTML",
+}
+
+// backfillResult counts the documents an encryption backfill rewrote.
+type backfillResult struct {
+	Journals          int `json:"journals"`
+	HealthRecords     int `json:"healthRecords"`
+	ConsultationNotes int `json:"consultationNotes"`
+	// Erased counts documents of deleted users. Their plaintext is deleted or
+	// erased, as there is no key left to encrypt it with.
+	Erased int `json:"erased"`
+	// Skipped counts journals, health records and consultations from before
+	// sign-in, and notes whose consultation is gone, which have no user to
+	// encrypt them for.
+	Skipped int `json:"skipped"`
+}
+
+// backfillJournals encrypts journal entries written before encryption was added.
+func backfillJournals(ctx context.Context, result *backfillResult) error {
+	collection := database.GetCollection("journals")
+
+	plaintext := make([]bson.M, len(journalTextFields))
+	for i, name := range journalTextFields {
+		plaintext[i] = bson.M{name: database.Unencrypted()}
+	}
+
+	// Entries from before sign-in were keyed by a number no user has
+	skipped, err := collection.CountDocuments(ctx, bson.M{"$or": plaintext, "userID": bson.M{"$not": bson.M{"$type": "string"}}})
+	if err != nil {
+		return err
+	}
+	result.Skipped += int(skipped)
+
+	cursor, err := collection.Find(ctx, bson.M{"$or": plaintext, "userID": bson.M{"$type": "string"}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var journal models.HealthJournal
+		if err := cursor.Decode(&journal); err != nil {
+			return err
+		}
+
+		// Matching on the plaintext leaves alone an entry edited meanwhile, which the edit encrypted
+		filter := bson.M{"journalID": journal.JournalID}
+		for i, field := range journal.EncryptedFields() {
+			if *field != "" {
+				filter[journalTextFields[i]] = *field
+			}
+		}
+
+		err := database.Encrypt(ctx, &journal)
+		if errors.Is(err, database.ErrDataKeyDestroyed) {
+			// Deleting the account deletes the journal, so this one was left behind
+			if _, err := collection.DeleteOne(ctx, filter); err != nil {
+				return err
+			}
+			result.Erased++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		set := bson.M{}
+		for i, field := range journal.EncryptedFields() {
+			if *field != "" {
+				set[journalTextFields[i]] = *field
+			}
+		}
+		if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		result.Journals++
+	}
+	return cursor.Err()
+}
+
+// backfillHealthRecords moves health record measurements stored in the clear
+// into their encrypted Values and removes the plaintext fields.
+func backfillHealthRecords(ctx context.Context, result *backfillResult) error {
+	collection := database.GetCollection("healthrecords")
+
+	cursor, err := collection.Find(ctx, bson.M{"values": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID             primitive.ObjectID `bson:"_id"`
+			UserID         interface{}        `bson:"userID"`
+			Age            int                `bson:"age"`
+			Height         int                `bson:"height"`
+			Weight         int                `bson:"weight"`
+			PregnancyPhase string             `bson:"pregnancyPhase"`
+			WeeksAlong     int                `bson:"weeksAlong"`
+			UpdatedAt      time.Time          `bson:"updatedAt"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return err
+		}
+
+		// Records from before sign-in were keyed by a number no user has
+		userID, ok := legacy.UserID.(string)
+		if !ok {
+			result.Skipped++
+			continue
+		}
+
+		filter := bson.M{"_id": legacy.ID, "values": bson.M{"$exists": false}}
+		record := models.HealthRecord{
+			UserID:         userID,
+			Age:            legacy.Age,
+			Height:         legacy.Height,
+			Weight:         legacy.Weight,
+			PregnancyPhase: legacy.PregnancyPhase,
+			WeeksAlong:     legacy.WeeksAlong,
+			UpdatedAt:      legacy.UpdatedAt,
+		}
+		err := sealHealthRecord(ctx, &record)
+		if errors.Is(err, database.ErrDataKeyDestroyed) {
+			// Deleting the account deletes the health record, so this one was left behind
+			if _, err := collection.DeleteOne(ctx, filter); err != nil {
+				return err
+			}
+			result.Erased++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		update := bson.M{
+			"$set": bson.M{"values": record.Values},
+			"$unset": bson.M{
+				"age":            "",
+				"height":         "",
+				"weight":         "",
+				"pregnancyPhase": "",
+				"weeksAlong":     "",
+			},
+		}
+		if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+		result.HealthRecords++
+	}
+	return cursor.Err()
+}
+
+// backfillConsultationNotes encrypts note versions written before encryption
+// was added, and turns notes from before versioning, which kept their text in
+// a single plaintext field, into signed notes. Those become professional-only,
+// as nothing says the patient was meant to see them.
+func backfillConsultationNotes(ctx context.Context, result *backfillResult) error {
+	collection := database.GetCollection("consultationnotes")
+
+	plaintext := bson.M{"$or": []bson.M{
+		{"notes": bson.M{"$exists": true}},
+		{"versions": bson.M{"$elemMatch": bson.M{"$or": []bson.M{
+			{"notes": database.Unencrypted()},
+			{"reason": database.Unencrypted()},
+		}}}},
+	}}
+	cursor, err := collection.Find(ctx, plaintext)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var stored struct {
+			models.ConsultationNotes `bson:",inline"`
+			LegacyNotes              *string `bson:"notes"`
+		}
+		if err := cursor.Decode(&stored); err != nil {
+			return err
+		}
+		note := stored.ConsultationNotes
+
+		// Matching on the version leaves alone a note amended meanwhile
+		filter := bson.M{"_id": note.ID, "version": note.Version}
+		update := bson.M{}
+		if stored.LegacyNotes != nil {
+			var request struct {
+				UserID interface{} `bson:"userID"`
+				ProfID int         `bson:"profID"`
+			}
+			err := database.GetCollection("consultationrequests").FindOne(ctx, bson.M{"requestID": note.RequestID}).Decode(&request)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				result.Skipped++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			// Requests from before sign-in were keyed by a number no user has
+			userID, ok := request.UserID.(string)
+			if !ok {
+				result.Skipped++
+				continue
+			}
+
+			note.UserID = userID
+			note.AuthorProfID = request.ProfID
+			note.Visibility = models.NoteProfessionalOnly
+			version := newNoteVersion(note, *stored.LegacyNotes, models.NoteProfessionalOnly, "", request.ProfID)
+			note.Version = version.Version
+			note.Versions = []models.ConsultationNoteVersion{version}
+			note.CreatedAt = version.SignedAt
+			note.UpdatedAt = version.SignedAt
+
+			filter = bson.M{"_id": note.ID, "notes": bson.M{"$exists": true}}
+			update["$unset"] = bson.M{"notes": ""}
+		}
+
+		err := database.Encrypt(ctx, &note)
+		if errors.Is(err, database.ErrDataKeyDestroyed) {
+			// The note belongs to the consultation, so keep it but make its text unreadable
+			database.Erase(&note)
+			result.Erased++
+		} else if err != nil {
+			return err
+		} else {
+			result.ConsultationNotes++
+		}
+
+		update["$set"] = bson.M{
+			"userID":       note.UserID,
+			"authorProfID": note.AuthorProfID,
+			"visibility":   note.Visibility,
+			"version":      note.Version,
+			"versions":     note.Versions,
+			"createdAt":    note.CreatedAt,
+			"updatedAt":    note.UpdatedAt,
+		}
+		if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// BackfillEncryption godoc
+// @Summary Encrypt data stored in the clear
+// @Description Encrypt journals, health records and consultation notes written before encryption was added, and remove
+// @Description their plaintext fields. Data of deleted users is deleted or erased instead. Safe to run again, for example
+// @Description after a failure, as only plaintext is touched. Admins only.
+// @Tags encryption
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/encryption/backfill [post]
+func BackfillEncryption(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if user.Role != models.RoleAdmin {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Admin access required"})
+	}
+
+	// Every document written in the clear is rewritten, so allow it longer than a normal request
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var result backfillResult
+	for _, backfill := range []func(context.Context, *backfillResult) error{
+		backfillJournals,
+		backfillHealthRecords,
+		backfillConsultationNotes,
+	} {
+		if err := backfill(ctx, &result); err != nil {
+			// Finished documents are no longer plaintext, so running it again picks up where this stopped
+			done := result.Journals + result.HealthRecords + result.ConsultationNotes + result.Erased
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": fmt.Sprintf("Backfill stopped after %d documents: %s", done, err)})
+		}
+	}
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditBackfillEncryption,
+		TargetType: "encryption",
+		TargetName: fmt.Sprintf("%d journals, %d health records, %d notes", result.Journals, result.HealthRecords, result.ConsultationNotes),
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	return c.Status(http.StatusOK).JSON(result)
+}
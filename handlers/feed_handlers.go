@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// hotScore ranks a post by its replies, decaying with age: every 12.5 hours a
+// newer post needs ten times fewer replies to outrank an older one. The score
+// only depends on the creation time, so it is stored and sorted on directly.
+func hotScore(replies int, created time.Time) float64 {
+	return math.Log10(float64(max(replies, 1))) + float64(created.Unix())/45000
+}
+
+// updatePostActivity adjusts a post's reply count by delta and refreshes its
+// feed ranking. New replies also bump the post in the "active" feed.
+func updatePostActivity(ctx context.Context, postID, delta int) error {
+	collection := database.GetCollection("posts")
+
+	update := bson.M{"$inc": bson.M{"numOfReplies": delta}}
+	if delta > 0 {
+		update["$set"] = bson.M{"lastActivityAt": time.Now()}
+	}
+
+	var post models.Post
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"postID": postID}, update, opts).Decode(&post); err != nil {
+		return err
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"postID": postID}, bson.M{
+		"$set": bson.M{"hotScore": hotScore(post.NumOfReplies, post.CreationDateTime)},
+	})
+	return err
+}
+
+// feedSort describes how one feed mode orders posts.
+type feedSort struct {
+	field string
+	// key returns the value of field for post, as stored in a cursor
+	key func(post models.Post) float64
+	// value converts a cursor key back to the type stored in the database
+	value func(key float64) interface{}
+}
+
+func timeKey(t time.Time) float64       { return float64(t.UnixMilli()) }
+func timeValue(key float64) interface{} { return time.UnixMilli(int64(key)) }
+
+var feedSorts = map[string]feedSort{
+	"new": {
+		field: "creationDateTime",
+		key:   func(post models.Post) float64 { return timeKey(post.CreationDateTime) },
+		value: timeValue,
+	},
+	"active": {
+		field: "lastActivityAt",
+		key:   func(post models.Post) float64 { return timeKey(post.LastActivityAt) },
+		value: timeValue,
+	},
+	"top": {
+		field: "numOfReplies",
+		key:   func(post models.Post) float64 { return float64(post.NumOfReplies) },
+		value: func(key float64) interface{} { return int(key) },
+	},
+	"hot": {
+		field: "hotScore",
+		key:   func(post models.Post) float64 { return post.HotScore },
+		value: func(key float64) interface{} { return key },
+	},
+}
+
+// topWindows are the time windows the "top" feed can rank over.
+var topWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// feedCursor marks the last post of a page. Posts are ordered by the sort
+// field and then by post ID, so the pair identifies a position exactly.
+type feedCursor struct {
+	Key    float64 `json:"k"`
+	PostID int     `json:"p"`
+}
+
+// feedPage is one page of a feed.
+type feedPage struct {
+	Posts      []models.Post `json:"posts"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+func encodeCursor(cursor feedCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (feedCursor, error) {
+	var cursor feedCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errors.New("Invalid cursor")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, errors.New("Invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+// excludeBlockedAuthors narrows filter to posts not written by anyone userID
+// has blocked. Only the author shown on a post counts, so anonymous posts stay
+// in: leaving them out would tell the reader who wrote them.
+func excludeBlockedAuthors(ctx context.Context, filter bson.M, userID string) error {
+	blocked, err := blockedUserIDs(ctx, userID)
+	if err != nil || len(blocked) == 0 {
+		return err
+	}
+
+	filter["userID"] = bson.M{"$nin": blocked}
+	return nil
+}
+
+// loadFeed serves one page of posts matching filter, ranked by the "sort"
+// query parameter and paged with the "cursor" query parameter. userID is the
+// signed-in reader, if any, and decides which poll results they see. pinned
+// posts lead the first page whatever the sort.
+func loadFeed(c *fiber.Ctx, ctx context.Context, filter bson.M, userID string, pinned []models.Post) error {
+	mode := c.Query("sort", "hot")
+	sort, ok := feedSorts[mode]
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Sort must be one of hot, new, active or top"})
+	}
+
+	if mode == "top" {
+		window, ok := topWindows[c.Query("t", "week")]
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Time window must be one of day, week, month, year or all"})
+		}
+		if window > 0 {
+			filter["creationDateTime"] = bson.M{"$gte": time.Now().Add(-window)}
+		}
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		cursor, err := decodeCursor(s)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+
+		value := sort.value(cursor.Key)
+		filter["$or"] = []bson.M{
+			{sort.field: bson.M{"$lt": value}},
+			{sort.field: value, "postID": bson.M{"$lt": cursor.PostID}},
+		}
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	// Fetch one extra post to learn whether there is another page
+	opts := options.Find().
+		SetSort(bson.D{{Key: sort.field, Value: -1}, {Key: "postID", Value: -1}}).
+		SetLimit(int64(limit + 1))
+	cursor, err := database.GetCollection("posts").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	page := feedPage{Posts: []models.Post{}}
+	if err := cursor.All(ctx, &page.Posts); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if len(page.Posts) > limit {
+		page.Posts = page.Posts[:limit]
+		last := page.Posts[limit-1]
+		page.NextCursor = encodeCursor(feedCursor{Key: sort.key(last), PostID: last.PostID})
+	}
+
+	if c.Query("cursor") == "" && len(pinned) > 0 {
+		page.Posts = append(pinned, page.Posts...)
+	}
+	if err := showPolls(ctx, page.Posts, userID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(page)
+}
+
+// GetBoardFeed godoc
+// @Summary Get a forum board's feed
+// @Description Page through a board's posts ranked as hot, new, active (latest comment) or top within a time window.
+// @Description Pinned posts come first on the first page whatever the sort.
+// @Description Signed-in users do not see posts from people they have blocked.
+// @Tags feeds
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param sort query string false "hot (default), new, active or top"
+// @Param t query string false "Window for top: day, week (default), month, year or all"
+// @Param cursor query string false "nextCursor from the previous page"
+// @Param limit query int false "Maximum number of posts (default 50, max 100)"
+// @Success 200 {object} feedPage
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/feed [get]
+func GetBoardFeed(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	board, err := findBoard(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+	user, prof := optionalCaller(c)
+	if !canAccessBoard(ctx, board, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	filter := bson.M{"boardID": id}
+	if user.ID != "" {
+		if err := excludeBlockedAuthors(ctx, filter, user.ID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	// Pinned posts are fetched on their own and kept out of the ranked pages
+	var pinned []models.Post
+	if c.Query("cursor") == "" {
+		pinnedFilter := bson.M{"pinned": true}
+		for key, value := range filter {
+			pinnedFilter[key] = value
+		}
+		opts := options.Find().SetSort(bson.D{{Key: "pinnedAt", Value: -1}})
+		cursor, err := database.GetCollection("posts").Find(ctx, pinnedFilter, opts)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		if err := cursor.All(ctx, &pinned); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+	filter["pinned"] = bson.M{"$ne": true}
+
+	return loadFeed(c, ctx, filter, user.ID, pinned)
+}
+
+// GetHomeFeed godoc
+// @Summary Get the home feed
+// @Description Page through posts from every board the authenticated user subscribes to, or from all boards if they have none.
+// @Description Ranking and paging work as for board feeds, and posts from blocked users are left out.
+// @Tags feeds
+// @Accept  json
+// @Produce  json
+// @Param sort query string false "hot (default), new, active or top"
+// @Param t query string false "Window for top: day, week (default), month, year or all"
+// @Param cursor query string false "nextCursor from the previous page"
+// @Param limit query int false "Maximum number of posts (default 50, max 100)"
+// @Success 200 {object} feedPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /feed [get]
+func GetHomeFeed(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	subFilter := bson.M{"userID": user.ID, "boardID": bson.M{"$exists": true}}
+	boardIDs, err := database.GetCollection("subscriptions").Distinct(ctx, "boardID", subFilter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	filter := bson.M{}
+	if len(boardIDs) > 0 {
+		filter["boardID"] = bson.M{"$in": boardIDs}
+	}
+	if err := excludeBlockedAuthors(ctx, filter, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if err := excludeHiddenBoards(ctx, filter, user, models.HealthCareProfessional{}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return loadFeed(c, ctx, filter, user.ID, nil)
+}
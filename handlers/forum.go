@@ -5,6 +5,7 @@ import (
     "net/http"
     "time"
     "gofiber-mongodb/server/database"
+    "gofiber-mongodb/server/markdown"
     "gofiber-mongodb/models"
     "github.com/gofiber/fiber/v2"
     "go.mongodb.org/mongo-driver/bson"
@@ -32,7 +33,15 @@ func CreateForum(c *fiber.Ctx) error {
         return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
     }
 
+    if err := checkLength("Title", forum.Title, models.MaxForumTitleLength); err != nil {
+        return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+    }
+    if err := checkLength("Content", forum.Content, models.MaxForumContentLength); err != nil {
+        return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+    }
+
     forum.ID = primitive.NewObjectID().Hex()
+    forum.ContentHTML = markdown.Render(forum.Content)
     forum.CreatedAt = time.Now()
 
     _, err := collection.InsertOne(ctx, forum)
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxPregnancyPhaseLength bounds the pregnancy phase label.
+const maxPregnancyPhaseLength = 50
+
+// healthRecordValues is the encrypted part of a health record.
+type healthRecordValues struct {
+	Age            int    `json:"age"`
+	Height         int    `json:"height"`
+	Weight         int    `json:"weight"`
+	PregnancyPhase string `json:"pregnancyPhase"`
+	WeeksAlong     int    `json:"weeksAlong"`
+}
+
+// sealHealthRecord packs record's measurements into its encrypted Values.
+func sealHealthRecord(ctx context.Context, record *models.HealthRecord) error {
+	data, err := json.Marshal(healthRecordValues{
+		Age:            record.Age,
+		Height:         record.Height,
+		Weight:         record.Weight,
+		PregnancyPhase: record.PregnancyPhase,
+		WeeksAlong:     record.WeeksAlong,
+	})
+	if err != nil {
+		return err
+	}
+	record.Values = string(data)
+	return database.Encrypt(ctx, record)
+}
+
+// openHealthRecord decrypts record's Values back into its measurements.
+func openHealthRecord(ctx context.Context, record *models.HealthRecord) error {
+	if err := database.Decrypt(ctx, record); err != nil {
+		return err
+	}
+
+	var values healthRecordValues
+	if err := json.Unmarshal([]byte(record.Values), &values); err != nil {
+		return err
+	}
+	record.Age = values.Age
+	record.Height = values.Height
+	record.Weight = values.Weight
+	record.PregnancyPhase = values.PregnancyPhase
+	record.WeeksAlong = values.WeeksAlong
+	record.Values = ""
+	return nil
+}
+
+// GetHealthRecord godoc
+// @Summary Get your health record
+// @Description Get the authenticated user's health record
+// @Tags healthrecords
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} models.HealthRecord
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /healthrecord [get]
+func GetHealthRecord(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("healthrecords")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var record models.HealthRecord
+	err = collection.FindOne(ctx, bson.M{"userID": user.ID}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Health record not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := openHealthRecord(ctx, &record); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(record)
+}
+
+// UpdateHealthRecord godoc
+// @Summary Save your health record
+// @Description Create or replace the authenticated user's health record. The measurements are stored encrypted. Changing weeksAlong also sets the due date and joins its due-date club, unless a due date is already set.
+// @Tags healthrecords
+// @Accept  json
+// @Produce  json
+// @Param record body models.HealthRecord true "Health record payload"
+// @Success 200 {object} models.HealthRecord
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /healthrecord [put]
+func UpdateHealthRecord(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("healthrecords")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var record models.HealthRecord
+	if err := c.BodyParser(&record); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if record.Age < 0 || record.Height < 0 || record.Weight < 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Age, height and weight cannot be negative"})
+	}
+	if record.WeeksAlong < 0 || record.WeeksAlong > pregnancyWeeks+2 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Weeks along is out of range"})
+	}
+	record.PregnancyPhase = strings.TrimSpace(record.PregnancyPhase)
+	if err := checkLength("Pregnancy phase", record.PregnancyPhase, maxPregnancyPhaseLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	// The stored record tells whether weeks along has changed
+	var previous models.HealthRecord
+	err = collection.FindOne(ctx, bson.M{"userID": user.ID}).Decode(&previous)
+	if err == nil {
+		err = openHealthRecord(ctx, &previous)
+	}
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	record.UserID = user.ID
+	record.UpdatedAt = time.Now()
+
+	stored := record
+	if err := sealHealthRecord(ctx, &stored); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := collection.ReplaceOne(ctx, bson.M{"userID": user.ID}, stored, opts); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	// Weeks along stands in for a due date, as on PUT /users/due-date, but only
+	// for users without one: recomputing it on every save would drift with time,
+	// override an exact date and put people back in a club they left
+	if record.WeeksAlong > 0 && record.WeeksAlong != previous.WeeksAlong && user.DueDate.IsZero() {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		if _, err := saveDueDate(ctx, user.ID, today.AddDate(0, 0, (pregnancyWeeks-record.WeeksAlong)*7)); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(record)
+}
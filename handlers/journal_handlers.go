@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"gofiber-mongodb/server/markdown"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// prepareJournalEntry checks the text fields of entry and renders their HTML.
+func prepareJournalEntry(entry *models.HealthJournal) error {
+	fields := []struct {
+		name string
+		text string
+		html *string
+	}{
+		{"Feeling", entry.Feeling, &entry.FeelingHTML},
+		{"Gratitudes", entry.Gratitudes, &entry.GratitudesHTML},
+		{"Self care", entry.SelfCare, &entry.SelfCareHTML},
+		{"Thoughts", entry.Thoughts, &entry.ThoughtsHTML},
+	}
+
+	for _, field := range fields {
+		if err := checkLength(field.name, field.text, models.MaxJournalFieldLength); err != nil {
+			return err
+		}
+
+		*field.html = ""
+		if field.text != "" {
+			*field.html = markdown.Render(field.text)
+		}
+	}
+
+	return nil
+}
+
+// screenJournalEntry runs crisis detection over the text fields of entry.
+func screenJournalEntry(ctx context.Context, entry models.HealthJournal) []models.SupportResource {
+	return screenForCrisis(ctx, models.ModerationFlag{
+		TargetType: "journal",
+		JournalID:  entry.JournalID,
+		UserID:     entry.UserID,
+	}, entry.Feeling, entry.Gratitudes, entry.SelfCare, entry.Thoughts)
+}
+
+// CreateJournalEntry godoc
+// @Summary Create a health journal entry
+// @Description Create a health journal entry for the authenticated user
+// @Tags journals
+// @Accept  json
+// @Produce  json
+// @Param entry body models.HealthJournal true "Journal Entry Payload"
+// @Success 200 {object} models.HealthJournal
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /journals [post]
+func CreateJournalEntry(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("journals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var entry models.HealthJournal
+	if err := c.BodyParser(&entry); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := prepareJournalEntry(&entry); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	journalID, err := database.NextID(ctx, "journalID")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	entry.JournalID = journalID
+	entry.UserID = user.ID
+	if entry.EntryDate.IsZero() {
+		entry.EntryDate = time.Now()
+	}
+
+	stored := entry
+	if err := database.Encrypt(ctx, &stored); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	_, err = collection.InsertOne(ctx, stored)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	entry.SupportResources = screenJournalEntry(ctx, entry)
+
+	return c.Status(http.StatusOK).JSON(entry)
+}
+
+// GetJournalEntries godoc
+// @Summary List health journal entries
+// @Description List the authenticated user's health journal entries, newest first
+// @Tags journals
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.HealthJournal
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /journals [get]
+func GetJournalEntries(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("journals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "entryDate", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"userID": user.ID}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	entries := []models.HealthJournal{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	for i := range entries {
+		if err := database.Decrypt(ctx, &entries[i]); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(entries)
+}
+
+// GetJournalEntry godoc
+// @Summary Get a health journal entry
+// @Description Get one of the authenticated user's health journal entries by ID
+// @Tags journals
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Journal ID"
+// @Success 200 {object} models.HealthJournal
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /journals/{id} [get]
+func GetJournalEntry(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("journals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid journal ID"})
+	}
+
+	var entry models.HealthJournal
+	err = collection.FindOne(ctx, bson.M{"journalID": id, "userID": user.ID}).Decode(&entry)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Journal entry not found"})
+	}
+
+	if err := database.Decrypt(ctx, &entry); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(entry)
+}
+
+// UpdateJournalEntry godoc
+// @Summary Update a health journal entry
+// @Description Update the text and rating of one of the authenticated user's journal entries
+// @Tags journals
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Journal ID"
+// @Param entry body models.HealthJournal true "Journal Entry Payload"
+// @Success 200 {object} models.HealthJournal
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /journals/{id} [put]
+func UpdateJournalEntry(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("journals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid journal ID"})
+	}
+
+	var entry models.HealthJournal
+	if err := c.BodyParser(&entry); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := prepareJournalEntry(&entry); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	sealed := entry
+	sealed.UserID = user.ID
+	if err := database.Encrypt(ctx, &sealed); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"feeling":        sealed.Feeling,
+			"gratitudes":     sealed.Gratitudes,
+			"selfCare":       sealed.SelfCare,
+			"thoughts":       sealed.Thoughts,
+			"dailyRating":    sealed.DailyRating,
+			"feelingHTML":    sealed.FeelingHTML,
+			"gratitudesHTML": sealed.GratitudesHTML,
+			"selfCareHTML":   sealed.SelfCareHTML,
+			"thoughtsHTML":   sealed.ThoughtsHTML,
+		},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(ctx, bson.M{"journalID": id, "userID": user.ID}, update, opts).Decode(&entry)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Journal entry not found"})
+	}
+	if err := database.Decrypt(ctx, &entry); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	entry.SupportResources = screenJournalEntry(ctx, entry)
+
+	return c.Status(http.StatusOK).JSON(entry)
+}
+
+// DeleteJournalEntry godoc
+// @Summary Delete a health journal entry
+// @Description Delete one of the authenticated user's health journal entries
+// @Tags journals
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Journal ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /journals/{id} [delete]
+func DeleteJournalEntry(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("journals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid journal ID"})
+	}
+
+	result, err := collection.DeleteOne(ctx, bson.M{"journalID": id, "userID": user.ID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Journal entry not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Journal entry deleted"})
+}
@@ -0,0 +1,503 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Consulting profile limits.
+const (
+	maxProfessionalSkills       = 20
+	maxSkillLength              = 50
+	maxCommunicationTypes       = 5
+	maxCommunicationTypeLength  = 30
+	maxProfessionalGenderLength = 30
+)
+
+// Match limits. Free slots are looked for matchAvailabilityDays ahead.
+const (
+	defaultMatchLimit     = 10
+	maxMatchLimit         = 50
+	matchAvailabilityDays = 14
+	// minSkillPrefixLength is the shortest word that matches longer words it starts.
+	minSkillPrefixLength = 4
+)
+
+// Points each match factor is worth.
+const (
+	skillPoints             = 20
+	maxSkillPoints          = 40
+	genderPoints            = 15
+	sameSuburbPoints        = 15
+	sameStatePoints         = 8
+	availableSoonPoints     = 10
+	communicationPoints     = 10
+	communicationMissPoints = -10
+	maxRatingPoints         = 10
+	verifiedPoints          = 5
+)
+
+// cleanList trims, lower-cases if lower is set, and de-duplicates values,
+// rejecting lists that are too long or hold values that are too long.
+func cleanList(field string, values []string, lower bool, maxItems, maxLength int) ([]string, error) {
+	seen := map[string]bool{}
+	cleaned := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if lower {
+			value = strings.ToLower(value)
+		}
+		key := strings.ToLower(value)
+		if value == "" || seen[key] {
+			continue
+		}
+		if err := checkLength(field, value, maxLength); err != nil {
+			return nil, err
+		}
+		seen[key] = true
+		cleaned = append(cleaned, value)
+	}
+	if len(cleaned) > maxItems {
+		return nil, fmt.Errorf("At most %d %s can be given", maxItems, strings.ToLower(field)+"s")
+	}
+	return cleaned, nil
+}
+
+// UpdateConsultingProfile godoc
+// @Summary Set a professional's consulting profile
+// @Description Replace the gender, communication types (e.g. "video", "phone", "in_person") and skills the authenticated
+// @Description professional is matched to consultation requests by
+// @Tags professionals
+// @Accept  json
+// @Produce  json
+// @Param profile body object true "Profile payload, e.g. {\"gender\": \"female\", \"communicationTypes\": [\"video\"], \"skills\": [\"Lactation\"]}"
+// @Success 200 {object} models.ProfessionalMatch
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/consulting [put]
+func UpdateConsultingProfile(c *fiber.Ctx) error {
+	prof, err := currentProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("professionals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Gender             string   `json:"gender"`
+		CommunicationTypes []string `json:"communicationTypes"`
+		Skills             []string `json:"skills"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	gender := strings.ToLower(strings.TrimSpace(requestData.Gender))
+	if err := checkLength("Gender", gender, maxProfessionalGenderLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	types, err := cleanList("Communication type", requestData.CommunicationTypes, true, maxCommunicationTypes, maxCommunicationTypeLength)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	skills, err := cleanList("Skill", requestData.Skills, false, maxProfessionalSkills, maxSkillLength)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	update := bson.M{
+		"$set": bson.M{"gender": gender, "communicationTypes": types},
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"profID": prof.ProfID}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	skillCollection := database.GetCollection("professionalSkills")
+	if _, err := skillCollection.DeleteMany(ctx, bson.M{"profID": prof.ProfID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if len(skills) > 0 {
+		docs := make([]interface{}, len(skills))
+		for i, skill := range skills {
+			docs[i] = models.ProfessionalSkills{ProfID: prof.ProfID, Skill: skill}
+		}
+		if _, err := skillCollection.InsertMany(ctx, docs); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	prof.Gender = gender
+	prof.CommunicationTypes = types
+	return c.Status(http.StatusOK).JSON(models.ProfessionalMatch{
+		ProfID:             prof.ProfID,
+		Name:               prof.FirstName + " " + prof.LastName,
+		Handle:             prof.Handle,
+		Badge:              professionalBadge(prof),
+		Gender:             prof.Gender,
+		Skills:             skills,
+		CommunicationTypes: prof.CommunicationTypes,
+		Reasons:            []models.MatchReason{},
+	})
+}
+
+// matchWords splits text into lower-case words worth matching skills against.
+func matchWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) >= 3 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// wordsMatch reports whether two words are the same or, once long enough,
+// one starts with the other, so "breastfeed" matches "breastfeeding".
+func wordsMatch(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) < minSkillPrefixLength || len(b) < minSkillPrefixLength {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// skillMatches reports whether every word of skill appears among words.
+func skillMatches(skill string, words []string) bool {
+	skillWords := matchWords(skill)
+	if len(skillWords) == 0 {
+		return false
+	}
+	for _, skillWord := range skillWords {
+		found := false
+		for _, word := range words {
+			if wordsMatch(skillWord, word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCriteria is what a consultation is being matched on.
+type matchCriteria struct {
+	Words             []string
+	Category          string
+	PreferredGender   string
+	CommunicationType string
+	Suburb            string
+	State             string
+}
+
+// scoreProfessional works out how well prof suits criteria. It returns the
+// match with its score and reasons filled in.
+func scoreProfessional(prof models.HealthCareProfessional, skills []string, address models.ProfessionalAddress, nextSlot *time.Time, criteria matchCriteria) models.ProfessionalMatch {
+	match := models.ProfessionalMatch{
+		ProfID:             prof.ProfID,
+		Name:               prof.FirstName + " " + prof.LastName,
+		Handle:             prof.Handle,
+		Badge:              professionalBadge(prof),
+		Gender:             prof.Gender,
+		Suburb:             address.Suburb,
+		State:              address.State,
+		Skills:             skills,
+		CommunicationTypes: prof.CommunicationTypes,
+		RatingAverage:      prof.RatingAverage,
+		RatingCount:        prof.RatingCount,
+		NextSlot:           nextSlot,
+		Reasons:            []models.MatchReason{},
+	}
+	if match.Skills == nil {
+		match.Skills = []string{}
+	}
+
+	add := func(factor string, points int, message string) {
+		match.Score += points
+		match.Reasons = append(match.Reasons, models.MatchReason{Factor: factor, Points: points, Message: message})
+	}
+
+	skillTotal := 0
+	for _, skill := range skills {
+		if skillTotal >= maxSkillPoints {
+			break
+		}
+		if strings.EqualFold(skill, criteria.Category) || skillMatches(skill, criteria.Words) {
+			points := skillPoints
+			if skillTotal+points > maxSkillPoints {
+				points = maxSkillPoints - skillTotal
+			}
+			skillTotal += points
+			add(models.MatchSkill, points, "Skilled in "+skill)
+		}
+	}
+
+	if criteria.PreferredGender != "" && strings.EqualFold(prof.Gender, criteria.PreferredGender) {
+		add(models.MatchGender, genderPoints, "Matches your preferred gender")
+	}
+
+	if criteria.State != "" && strings.EqualFold(address.State, criteria.State) {
+		if criteria.Suburb != "" && strings.EqualFold(address.Suburb, criteria.Suburb) {
+			add(models.MatchProximity, sameSuburbPoints, "Based in "+address.Suburb)
+		} else {
+			add(models.MatchProximity, sameStatePoints, "Based in "+address.State)
+		}
+	}
+
+	if nextSlot != nil {
+		add(models.MatchAvailability, availableSoonPoints, "Next free slot "+nextSlot.Format("Mon 2 Jan 15:04 MST"))
+	}
+
+	if criteria.CommunicationType != "" && len(prof.CommunicationTypes) > 0 {
+		offered := false
+		for _, t := range prof.CommunicationTypes {
+			if strings.EqualFold(t, criteria.CommunicationType) {
+				offered = true
+				break
+			}
+		}
+		if offered {
+			add(models.MatchCommunication, communicationPoints, "Offers "+criteria.CommunicationType+" consultations")
+		} else {
+			add(models.MatchCommunication, communicationMissPoints, "Does not offer "+criteria.CommunicationType+" consultations")
+		}
+	}
+
+	if prof.RatingCount > 0 {
+		points := int(math.Round(prof.RatingAverage / 5 * maxRatingPoints))
+		add(models.MatchRating, points, fmt.Sprintf("Rated %.1f from %d reviews", prof.RatingAverage, prof.RatingCount))
+	}
+
+	if prof.IsVerified {
+		add(models.MatchVerified, verifiedPoints, "Verified professional")
+	}
+
+	return match
+}
+
+// nextFreeSlots finds each professional's first free slot in the coming
+// days. Professionals without a published schedule or a free slot are left
+// out. The calendars, exceptions and bookings of all of them are loaded in one
+// query each, so the cost does not grow with the number of consultants.
+func nextFreeSlots(ctx context.Context, profIDs []int) (map[int]*time.Time, error) {
+	inProfs := bson.M{"$in": profIDs}
+	cursor, err := database.GetCollection("availability").Find(ctx, bson.M{"profID": inProfs})
+	if err != nil {
+		return nil, err
+	}
+	var calendars []models.Availability
+	if err := cursor.All(ctx, &calendars); err != nil {
+		return nil, err
+	}
+	if len(calendars) == 0 {
+		return map[int]*time.Time{}, nil
+	}
+
+	now := time.Now()
+	to := now.AddDate(0, 0, matchAvailabilityDays)
+
+	filter := bson.M{"profID": inProfs, "start": bson.M{"$lt": to}, "end": bson.M{"$gt": now}}
+	cursor, err = database.GetCollection("availabilityExceptions").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var exceptionDocs []models.AvailabilityException
+	if err := cursor.All(ctx, &exceptionDocs); err != nil {
+		return nil, err
+	}
+	exceptions := map[int][]models.AvailabilityException{}
+	for _, exception := range exceptionDocs {
+		exceptions[exception.ProfID] = append(exceptions[exception.ProfID], exception)
+	}
+
+	// Widen the booking window by the largest buffer; slots are checked against
+	// each professional's own buffer below
+	buffer := time.Duration(0)
+	for _, availability := range calendars {
+		buffer = max(buffer, time.Duration(availability.BufferMinutes)*time.Minute)
+	}
+	filter = bson.M{
+		"profID": inProfs,
+		"status": models.BookingActive,
+		"start":  bson.M{"$lt": to.Add(buffer)},
+		"end":    bson.M{"$gt": now.Add(-buffer)},
+	}
+	cursor, err = database.GetCollection("bookings").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var bookingDocs []models.Booking
+	if err := cursor.All(ctx, &bookingDocs); err != nil {
+		return nil, err
+	}
+	bookings := map[int][]models.Booking{}
+	for _, booking := range bookingDocs {
+		bookings[booking.ProfID] = append(bookings[booking.ProfID], booking)
+	}
+
+	next := map[int]*time.Time{}
+	for _, availability := range calendars {
+		open, err := openIntervals(availability, exceptions[availability.ProfID], now, to)
+		if err != nil {
+			// One broken calendar should not stop the others being ranked
+			log.Printf("Failed to list slots for professional %d: %s", availability.ProfID, err)
+			continue
+		}
+		slots := freeSlots(availability, open, bookings[availability.ProfID], availability.SlotMinutes)
+		if len(slots) > 0 {
+			start := slots[0].Start
+			next[availability.ProfID] = &start
+		}
+	}
+	return next, nil
+}
+
+// GetProfessionalMatches godoc
+// @Summary Recommend consultants
+// @Description Rank consultants for a consultation by skill match to the description or category, preferred gender,
+// @Description distance (same suburb, then same state), a free slot in the next two weeks, communication type, rating
+// @Description and verification. Pass requestID to match one of the authenticated user's consultation requests; any other
+// @Description parameters given override its fields. The location defaults to the address saved with PUT /users/address.
+// @Tags consultationrequests
+// @Accept  json
+// @Produce  json
+// @Param requestID query int false "Consultation request to match"
+// @Param description query string false "What the consultation is about"
+// @Param category query string false "Skill the consultation needs"
+// @Param preferredGender query string false "Preferred professional gender"
+// @Param communicationType query string false "How to consult, e.g. video"
+// @Param suburb query string false "Suburb to search near"
+// @Param state query string false "State to search in"
+// @Param limit query int false "Maximum matches (default 10, max 50)"
+// @Success 200 {array} models.ProfessionalMatch
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/matches [get]
+func GetProfessionalMatches(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var request models.ConsultationRequests
+	if requestID := c.QueryInt("requestID"); requestID != 0 {
+		filter := bson.M{"requestID": requestID, "userID": user.ID}
+		if err := database.GetCollection("consultationrequests").FindOne(ctx, filter).Decode(&request); err != nil {
+			return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Consultation request not found"})
+		}
+	}
+
+	var address models.UserAddress
+	if err := database.GetCollection("userAddresses").FindOne(ctx, bson.M{"userID": user.ID}).Decode(&address); err != nil {
+		address = models.UserAddress{}
+	}
+
+	category := strings.TrimSpace(c.Query("category"))
+	criteria := matchCriteria{
+		Words:             matchWords(c.Query("description", request.Description) + " " + category),
+		Category:          category,
+		PreferredGender:   strings.TrimSpace(c.Query("preferredGender", request.PreferredGender)),
+		CommunicationType: strings.TrimSpace(c.Query("communicationType", request.CommunicationType)),
+		Suburb:            strings.TrimSpace(c.Query("suburb", address.Suburb)),
+		State:             strings.TrimSpace(c.Query("state", address.State)),
+	}
+
+	limit := c.QueryInt("limit", defaultMatchLimit)
+	if limit <= 0 {
+		limit = defaultMatchLimit
+	}
+	if limit > maxMatchLimit {
+		limit = maxMatchLimit
+	}
+
+	cursor, err := database.GetCollection("professionals").Find(ctx, bson.M{"isConsultant": true})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	var profs []models.HealthCareProfessional
+	if err := cursor.All(ctx, &profs); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if len(profs) == 0 {
+		return c.Status(http.StatusOK).JSON([]models.ProfessionalMatch{})
+	}
+
+	profIDs := make([]int, len(profs))
+	for i, prof := range profs {
+		profIDs[i] = prof.ProfID
+	}
+	inProfs := bson.M{"profID": bson.M{"$in": profIDs}}
+
+	cursor, err = database.GetCollection("professionalSkills").Find(ctx, inProfs)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	var skillDocs []models.ProfessionalSkills
+	if err := cursor.All(ctx, &skillDocs); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	skills := map[int][]string{}
+	for _, doc := range skillDocs {
+		skills[doc.ProfID] = append(skills[doc.ProfID], doc.Skill)
+	}
+
+	cursor, err = database.GetCollection("professionalAddresses").Find(ctx, inProfs)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	var addressDocs []models.ProfessionalAddress
+	if err := cursor.All(ctx, &addressDocs); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	addresses := map[int]models.ProfessionalAddress{}
+	for _, doc := range addressDocs {
+		addresses[doc.ProfID] = doc
+	}
+
+	nextSlots, err := nextFreeSlots(ctx, profIDs)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	matches := make([]models.ProfessionalMatch, len(profs))
+	for i, prof := range profs {
+		matches[i] = scoreProfessional(prof, skills[prof.ProfID], addresses[prof.ProfID], nextSlots[prof.ProfID], criteria)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ProfID < matches[j].ProfID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return c.Status(http.StatusOK).JSON(matches)
+}
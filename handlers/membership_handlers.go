@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// addBoardMember makes a user or professional a member of a board, or changes
+// the role of an existing member.
+func addBoardMember(ctx context.Context, member models.BoardMember) (models.BoardMember, error) {
+	filter := bson.M{"boardID": member.BoardID}
+	if member.ProfID != 0 {
+		filter["profID"] = member.ProfID
+	} else {
+		filter["userID"] = member.UserID
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"role": member.Role},
+		"$setOnInsert": bson.M{"createdAt": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var saved models.BoardMember
+	err := database.GetCollection("boardMembers").FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved)
+	return saved, err
+}
+
+// boardForManager loads the board in the route and checks that the caller
+// manages it. On failure it returns the HTTP status to respond with.
+func boardForManager(c *fiber.Ctx, ctx context.Context) (models.ForumBoard, models.User, int, error) {
+	var board models.ForumBoard
+
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return board, user, http.StatusUnauthorized, err
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return board, user, http.StatusBadRequest, errors.New("Invalid board ID")
+	}
+
+	board, err = findBoard(ctx, id)
+	if err != nil {
+		return board, user, http.StatusNotFound, errors.New("Board not found")
+	}
+
+	if !canManageBoard(ctx, board, user, prof) {
+		return board, user, http.StatusForbidden, errors.New("Only board managers can do this")
+	}
+
+	return board, user, http.StatusOK, nil
+}
+
+// JoinBoard godoc
+// @Summary Join a forum board
+// @Description Join a members-only board straight away, or ask to join an invite-only board.
+// @Description Public boards need no membership and professionals-only boards are open to every professional.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param request body object false "Optional note for an invite-only board, e.g. {\"message\": \"...\"}"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/join [post]
+func JoinBoard(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	board, err := findBoard(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+
+	if _, ok := findMembership(ctx, id, user, prof); ok {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "You are already a member of this board"})
+	}
+
+	switch board.Visibility {
+	case models.BoardMembersOnly:
+		member, err := addBoardMember(ctx, models.BoardMember{
+			BoardID: id,
+			UserID:  user.ID,
+			ProfID:  prof.ProfID,
+			Role:    models.BoardRoleMember,
+		})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		return c.Status(http.StatusOK).JSON(map[string]interface{}{"member": member})
+
+	case models.BoardInviteOnly:
+		var requestData struct {
+			Message string `json:"message"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&requestData); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+			}
+		}
+		message := strings.TrimSpace(requestData.Message)
+		if err := checkLength("Message", message, models.MaxJoinRequestMessageLength); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+
+		filter := memberFilter(user, prof)
+		filter["boardID"] = id
+		filter["status"] = models.JoinRequestPending
+		update := bson.M{
+			"$set":         bson.M{"message": message},
+			"$setOnInsert": bson.M{"createdAt": time.Now()},
+		}
+		opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+		var request models.JoinRequest
+		if err := database.GetCollection("joinRequests").FindOneAndUpdate(ctx, filter, update, opts).Decode(&request); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		return c.Status(http.StatusOK).JSON(map[string]interface{}{"joinRequest": request})
+
+	default:
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "This board does not need membership"})
+	}
+}
+
+// LeaveBoard godoc
+// @Summary Leave a forum board
+// @Description Give up membership of a restricted board
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/join [delete]
+func LeaveBoard(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("boardMembers")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	filter := memberFilter(user, prof)
+	filter["boardID"] = id
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "You are not a member of this board"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Left board"})
+}
+
+// GetBoardMembers godoc
+// @Summary List board members
+// @Description List the members of a restricted board. Board managers and moderators only.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Success 200 {array} models.BoardMember
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/members [get]
+func GetBoardMembers(c *fiber.Ctx) error {
+	collection := database.GetCollection("boardMembers")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	board, _, status, err := boardForManager(c, ctx)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"boardID": board.BoardID}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	members := []models.BoardMember{}
+	if err := cursor.All(ctx, &members); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(members)
+}
+
+// AddBoardMember godoc
+// @Summary Add a board member
+// @Description Invite a user (userID) or professional (profID) onto a restricted board. Board managers and moderators only;
+// @Description only moderators can make someone a board manager.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param member body models.BoardMember true "Member payload: userID or profID, optional role"
+// @Success 200 {object} models.BoardMember
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/members [post]
+func AddBoardMember(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	board, user, status, err := boardForManager(c, ctx)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var member models.BoardMember
+	if err := c.BodyParser(&member); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	switch member.Role {
+	case "":
+		member.Role = models.BoardRoleMember
+	case models.BoardRoleMember:
+	case models.BoardRoleManager:
+		if !isModerator(user) {
+			return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only moderators can appoint board managers"})
+		}
+	default:
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid role"})
+	}
+
+	switch {
+	case member.ProfID != 0:
+		member.UserID = ""
+		count, err := database.GetCollection("professionals").CountDocuments(ctx, bson.M{"profID": member.ProfID})
+		if err != nil || count == 0 {
+			return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Professional not found"})
+		}
+	case member.UserID != "":
+		objID, err := primitive.ObjectIDFromHex(member.UserID)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid user ID"})
+		}
+		count, err := database.GetCollection("users").CountDocuments(ctx, bson.M{"_id": objID})
+		if err != nil || count == 0 {
+			return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "User not found"})
+		}
+	default:
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "User ID or professional ID is required"})
+	}
+
+	member.BoardID = board.BoardID
+	member, err = addBoardMember(ctx, member)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(member)
+}
+
+// RemoveBoardMember godoc
+// @Summary Remove a board member
+// @Description Remove someone from a restricted board. Board managers and moderators only.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param memberID path string true "Membership ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/members/{memberID} [delete]
+func RemoveBoardMember(c *fiber.Ctx) error {
+	collection := database.GetCollection("boardMembers")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	board, user, status, err := boardForManager(c, ctx)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Params("memberID"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid member ID"})
+	}
+
+	var member models.BoardMember
+	if err := collection.FindOne(ctx, bson.M{"_id": memberID, "boardID": board.BoardID}).Decode(&member); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Member not found"})
+	}
+
+	// Managers answer to moderators, not to each other
+	if member.Role == models.BoardRoleManager && !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only moderators can remove board managers"})
+	}
+
+	if _, err := collection.DeleteOne(ctx, bson.M{"_id": memberID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Member removed"})
+}
+
+// GetJoinRequests godoc
+// @Summary List join requests
+// @Description List requests to join an invite-only board, oldest first. Board managers and moderators only.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param status query string false "Request status (default pending)"
+// @Success 200 {array} models.JoinRequest
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/join-requests [get]
+func GetJoinRequests(c *fiber.Ctx) error {
+	collection := database.GetCollection("joinRequests")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	board, _, status, err := boardForManager(c, ctx)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	filter := bson.M{"boardID": board.BoardID, "status": c.Query("status", models.JoinRequestPending)}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	requests := []models.JoinRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(requests)
+}
+
+// DecideJoinRequest godoc
+// @Summary Approve or reject a join request
+// @Description Answer a pending request to join an invite-only board. Approving adds the requester as a member.
+// @Description Board managers and moderators only.
+// @Tags boards
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param requestID path string true "Join request ID"
+// @Param decision body object true "Decision payload, e.g. {\"approve\": true}"
+// @Success 200 {object} models.JoinRequest
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/join-requests/{requestID} [put]
+func DecideJoinRequest(c *fiber.Ctx) error {
+	collection := database.GetCollection("joinRequests")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	board, user, status, err := boardForManager(c, ctx)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	requestID, err := primitive.ObjectIDFromHex(c.Params("requestID"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid join request ID"})
+	}
+
+	var requestData struct {
+		Approve bool `json:"approve"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	decision := models.JoinRequestRejected
+	if requestData.Approve {
+		decision = models.JoinRequestApproved
+	}
+
+	// Only a pending request can be decided, so two managers cannot both answer it
+	filter := bson.M{"_id": requestID, "boardID": board.BoardID, "status": models.JoinRequestPending}
+	update := bson.M{
+		"$set": bson.M{
+			"status":    decision,
+			"decidedBy": user.ID,
+			"decidedAt": time.Now(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var request models.JoinRequest
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&request); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Pending join request not found"})
+	}
+
+	message := "Your request to join " + board.Topic + " was declined"
+	if requestData.Approve {
+		_, err := addBoardMember(ctx, models.BoardMember{
+			BoardID: board.BoardID,
+			UserID:  request.UserID,
+			ProfID:  request.ProfID,
+			Role:    models.BoardRoleMember,
+		})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		message = "Your request to join " + board.Topic + " was approved"
+	}
+
+	n := models.Notification{
+		Type:    models.NotificationJoinRequestDecided,
+		BoardID: board.BoardID,
+		Message: message,
+	}
+	if request.ProfID != 0 {
+		err = notifyProfessionals(ctx, []int{request.ProfID}, n)
+	} else {
+		err = notifyUsers(ctx, []string{request.UserID}, "", n)
+	}
+	if err != nil {
+		log.Printf("Failed to notify about join request %s: %s", request.ID.Hex(), err)
+	}
+
+	return c.Status(http.StatusOK).JSON(request)
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	handleFormat = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+	// A mention must not follow a word character, so email addresses are not mentions
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_]{3,30})\b`)
+
+	handleInvalid = regexp.MustCompile(`[^a-z0-9_]+`)
+)
+
+// errHandleTaken is returned when a handle already belongs to someone else.
+var errHandleTaken = errors.New("Handle is already taken")
+
+// checkHandle validates a public handle and makes sure no other user or
+// professional has it. Handles share one namespace so a mention is never
+// ambiguous. The caller's own IDs are passed so keeping a handle is allowed.
+func checkHandle(ctx context.Context, handle, userID string, profID int) error {
+	if !handleFormat.MatchString(handle) {
+		return errors.New("Handle must be 3 to 30 lowercase letters, digits or underscores")
+	}
+
+	var user models.User
+	err := database.GetCollection("users").FindOne(ctx, bson.M{"handle": handle}).Decode(&user)
+	if err == nil && (userID == "" || user.ID != userID) {
+		return errHandleTaken
+	}
+
+	var prof models.HealthCareProfessional
+	err = database.GetCollection("professionals").FindOne(ctx, bson.M{"handle": handle}).Decode(&prof)
+	if err == nil && (profID == 0 || prof.ProfID != profID) {
+		return errHandleTaken
+	}
+
+	return nil
+}
+
+// generateHandle picks a free handle based on a person's name, e.g. "jane_smith42".
+func generateHandle(ctx context.Context, firstName, lastName string) (string, error) {
+	base := strings.ToLower(strings.TrimSpace(firstName + "_" + lastName))
+	base = strings.Trim(handleInvalid.ReplaceAllString(base, ""), "_")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 {
+		base = "member"
+	}
+
+	if checkHandle(ctx, base, "", 0) == nil {
+		return base, nil
+	}
+	for i := 0; i < 10; i++ {
+		handle := fmt.Sprintf("%s%d", base, 10+rand.Intn(9990))
+		if checkHandle(ctx, handle, "", 0) == nil {
+			return handle, nil
+		}
+	}
+
+	return "", errors.New("Could not find a free handle")
+}
+
+// parseMentions returns the distinct handles mentioned in text, lowercased.
+func parseMentions(text string) []string {
+	var handles []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		handle := strings.ToLower(m[1])
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+		if len(handles) == models.MaxMentions {
+			break
+		}
+	}
+	return handles
+}
+
+// resolveMentions looks up the users and professionals mentioned in text.
+// Handles that match nobody are dropped.
+func resolveMentions(ctx context.Context, text string) ([]models.Mention, error) {
+	handles := parseMentions(text)
+	if len(handles) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{"handle": bson.M{"$in": handles}}
+	byHandle := map[string]models.Mention{}
+
+	cursor, err := database.GetCollection("users").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		byHandle[user.Handle] = models.Mention{Handle: user.Handle, UserID: user.ID}
+	}
+
+	cursor, err = database.GetCollection("professionals").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var profs []models.HealthCareProfessional
+	if err := cursor.All(ctx, &profs); err != nil {
+		return nil, err
+	}
+	for _, prof := range profs {
+		byHandle[prof.Handle] = models.Mention{Handle: prof.Handle, ProfID: prof.ProfID}
+	}
+
+	// Keep the order the handles appear in
+	var mentions []models.Mention
+	for _, handle := range handles {
+		if mention, ok := byHandle[handle]; ok {
+			mentions = append(mentions, mention)
+		}
+	}
+	return mentions, nil
+}
+
+// newMentions returns the mentions in current that were not already in previous,
+// so editing a post does not notify the same people twice.
+func newMentions(current, previous []models.Mention) []models.Mention {
+	seen := map[string]bool{}
+	for _, mention := range previous {
+		seen[mention.Handle] = true
+	}
+
+	var added []models.Mention
+	for _, mention := range current {
+		if !seen[mention.Handle] {
+			added = append(added, mention)
+		}
+	}
+	return added
+}
+
+// notifyMentions notifies everyone in mentions, except the author, users
+// who have blocked the author and anyone who cannot read board. authorUserID is the real author even when the
+// content is anonymous; it is only used for filtering, never shown.
+// It runs detached from the request, so callers should start it with go.
+func notifyMentions(board models.ForumBoard, mentions []models.Mention, authorUserID string, authorProfID int, n models.Notification) {
+	if len(mentions) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var userIDs []string
+	var profIDs []int
+	for _, mention := range mentions {
+		if mention.UserID != "" {
+			userIDs = append(userIDs, mention.UserID)
+		} else if mention.ProfID != 0 && mention.ProfID != authorProfID {
+			profIDs = append(profIDs, mention.ProfID)
+		}
+	}
+
+	if authorUserID != "" && len(userIDs) > 0 {
+		blockFilter := bson.M{"userID": bson.M{"$in": userIDs}, "blockedUserID": authorUserID}
+		values, err := database.GetCollection("blocks").Distinct(ctx, "userID", blockFilter)
+		if err != nil {
+			log.Printf("Failed to load blocks for mentions: %s", err)
+			return
+		}
+
+		blockedBy := map[string]bool{}
+		for _, value := range values {
+			if userID, ok := value.(string); ok {
+				blockedBy[userID] = true
+			}
+		}
+
+		kept := userIDs[:0]
+		for _, userID := range userIDs {
+			if !blockedBy[userID] {
+				kept = append(kept, userID)
+			}
+		}
+		userIDs = kept
+	}
+
+	userIDs, profIDs, err := boardAudience(ctx, board, userIDs, profIDs)
+	if err != nil {
+		log.Printf("Failed to load the audience of board %d: %s", board.BoardID, err)
+		return
+	}
+
+	n.Type = models.NotificationMention
+	if err := notifyUsers(ctx, userIDs, authorUserID, n); err != nil {
+		log.Printf("Failed to deliver mention notifications: %s", err)
+	}
+	if err := notifyProfessionals(ctx, profIDs, n); err != nil {
+		log.Printf("Failed to deliver mention notifications to professionals: %s", err)
+	}
+}
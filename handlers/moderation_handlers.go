@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// writeAuditLog records a privileged staff action.
+func writeAuditLog(ctx context.Context, entry models.AuditLog) error {
+	entry.CreatedAt = time.Now()
+	_, err := database.GetCollection("auditLogs").InsertOne(ctx, entry)
+	return err
+}
+
+// RevealAnonymousAuthor godoc
+// @Summary Reveal the author of anonymous content
+// @Description Look up who wrote an anonymous post or comment. Moderators only; every lookup is audited and requires a reason.
+// @Tags moderation
+// @Accept  json
+// @Produce  json
+// @Param lookup body object true "Lookup payload: postID, optional commentID and reason"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /moderation/anonymous-author [post]
+func RevealAnonymousAuthor(c *fiber.Ctx) error {
+	moderator, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(moderator) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		PostID    int    `json:"postID"`
+		CommentID int    `json:"commentID"`
+		Reason    string `json:"reason"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if requestData.PostID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Post ID is required"})
+	}
+	if strings.TrimSpace(requestData.Reason) == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "A reason is required for this lookup"})
+	}
+
+	userID, err := anonymousAuthorID(ctx, requestData.PostID, requestData.CommentID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Anonymous content not found"})
+	}
+
+	entry := models.AuditLog{
+		ActorID:    moderator.ID,
+		Action:     models.AuditRevealAnonymousAuthor,
+		TargetType: "post",
+		TargetID:   requestData.PostID,
+		Reason:     requestData.Reason,
+	}
+	if requestData.CommentID != 0 {
+		entry.TargetType = "comment"
+		entry.TargetID = requestData.CommentID
+	}
+
+	// The lookup must not succeed unless it has been recorded
+	if err := writeAuditLog(ctx, entry); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	var author models.User
+	objID, _ := primitive.ObjectIDFromHex(userID)
+	err = database.GetCollection("users").FindOne(ctx, bson.M{"_id": objID}).Decode(&author)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "User not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]interface{}{
+		"userID":    author.ID,
+		"firstname": author.FirstName,
+		"lastname":  author.LastName,
+		"email":     author.Email,
+	})
+}
+
+// GetAuditLogs godoc
+// @Summary List audit logs
+// @Description List privileged staff actions, newest first. Admins only.
+// @Tags moderation
+// @Accept  json
+// @Produce  json
+// @Param action query string false "Filter by action"
+// @Param limit query int false "Maximum number of entries (default 50, max 100)"
+// @Success 200 {array} models.AuditLog
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /moderation/audit-logs [get]
+func GetAuditLogs(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if user.Role != models.RoleAdmin {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Admin access required"})
+	}
+
+	collection := database.GetCollection("auditLogs")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	entries := []models.AuditLog{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(entries)
+}
+
+// canSeeFlag reports whether user may view a moderation flag. Flags on private
+// journal entries are limited to admins.
+func canSeeFlag(user models.User, flag models.ModerationFlag) bool {
+	if flag.TargetType == "journal" {
+		return user.Role == models.RoleAdmin
+	}
+	return isModerator(user)
+}
+
+// GetModerationQueue godoc
+// @Summary List the moderation queue
+// @Description List moderation flags, highest priority and oldest first. Flags on journal entries are only shown to admins.
+// @Tags moderation
+// @Accept  json
+// @Produce  json
+// @Param status query string false "Flag status (default open)"
+// @Param limit query int false "Maximum number of flags (default 50, max 100)"
+// @Success 200 {array} models.ModerationFlag
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /moderation/queue [get]
+func GetModerationQueue(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("moderationQueue")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": c.Query("status", models.FlagStatusOpen)}
+	if user.Role != models.RoleAdmin {
+		filter["targetType"] = bson.M{"$ne": "journal"}
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "createdAt", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	flags := []models.ModerationFlag{}
+	if err := cursor.All(ctx, &flags); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(flags)
+}
+
+// ResolveModerationFlag godoc
+// @Summary Resolve a moderation flag
+// @Description Mark a moderation flag as resolved
+// @Tags moderation
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Flag ID"
+// @Success 200 {object} models.ModerationFlag
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /moderation/queue/{id}/resolve [put]
+func ResolveModerationFlag(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("moderationQueue")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid flag ID"})
+	}
+
+	var flag models.ModerationFlag
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&flag); err != nil || !canSeeFlag(user, flag) {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Flag not found"})
+	}
+
+	flag.Status = models.FlagStatusResolved
+	flag.ResolvedBy = user.ID
+	flag.ResolvedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":     flag.Status,
+			"resolvedBy": flag.ResolvedBy,
+			"resolvedAt": flag.ResolvedAt,
+		},
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(flag)
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notifyUsers delivers a copy of n to each of the given users, skipping skipUserID.
+// The skipped user is passed separately because anonymous actors leave n.ActorID empty.
+func notifyUsers(ctx context.Context, userIDs []string, skipUserID string, n models.Notification) error {
+	now := time.Now()
+	seen := map[string]bool{skipUserID: true}
+
+	var docs []interface{}
+	for _, userID := range userIDs {
+		if userID == "" || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		n.UserID = userID
+		n.Read = false
+		n.CreatedAt = now
+		docs = append(docs, n)
+	}
+
+	if len(docs) == 0 {
+		return nil
+	}
+
+	_, err := database.GetCollection("notifications").InsertMany(ctx, docs)
+	return err
+}
+
+// notifyProfessionals delivers a copy of n to each of the given professionals.
+func notifyProfessionals(ctx context.Context, profIDs []int, n models.Notification) error {
+	now := time.Now()
+	seen := map[int]bool{}
+
+	var docs []interface{}
+	for _, profID := range profIDs {
+		if profID == 0 || seen[profID] {
+			continue
+		}
+		seen[profID] = true
+
+		n.UserID = ""
+		n.ProfID = profID
+		n.Read = false
+		n.CreatedAt = now
+		docs = append(docs, n)
+	}
+
+	if len(docs) == 0 {
+		return nil
+	}
+
+	_, err := database.GetCollection("notifications").InsertMany(ctx, docs)
+	return err
+}
+
+// inboxFilter matches the notifications of the caller, a user or a professional.
+func inboxFilter(c *fiber.Ctx) (bson.M, error) {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return nil, err
+	}
+	if prof.ProfID != 0 {
+		return bson.M{"profID": prof.ProfID}, nil
+	}
+	return bson.M{"userID": user.ID}, nil
+}
+
+// notifySubscribers notifies every user whose subscription matches filter, except skipUserID
+// and anyone who cannot read board. It runs detached from the request, so callers should start it with go.
+func notifySubscribers(board models.ForumBoard, filter bson.M, skipUserID string, n models.Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	values, err := database.GetCollection("subscriptions").Distinct(ctx, "userID", filter)
+	if err != nil {
+		log.Printf("Failed to load subscribers for %v: %s", filter, err)
+		return
+	}
+
+	userIDs := make([]string, 0, len(values))
+	for _, value := range values {
+		if userID, ok := value.(string); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	userIDs, _, err = boardAudience(ctx, board, userIDs, nil)
+	if err != nil {
+		log.Printf("Failed to load the audience of board %d: %s", board.BoardID, err)
+		return
+	}
+
+	if err := notifyUsers(ctx, userIDs, skipUserID, n); err != nil {
+		log.Printf("Failed to deliver %s notifications: %s", n.Type, err)
+	}
+}
+
+// GetNotifications godoc
+// @Summary List notifications
+// @Description List the authenticated user's or professional's notifications, newest first
+// @Tags notifications
+// @Accept  json
+// @Produce  json
+// @Param unread query bool false "Only return unread notifications"
+// @Param limit query int false "Maximum number of notifications (default 50, max 100)"
+// @Success 200 {array} models.Notification
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications [get]
+func GetNotifications(c *fiber.Ctx) error {
+	filter, err := inboxFilter(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("notifications")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if c.QueryBool("unread") {
+		filter["read"] = false
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(notifications)
+}
+
+// GetUnreadNotificationCount godoc
+// @Summary Count unread notifications
+// @Description Get the number of unread notifications for the authenticated user or professional
+// @Tags notifications
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]int64
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/unread-count [get]
+func GetUnreadNotificationCount(c *fiber.Ctx) error {
+	filter, err := inboxFilter(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("notifications")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter["read"] = false
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]int64{"unread": count})
+}
+
+// MarkNotificationRead godoc
+// @Summary Mark a notification as read
+// @Description Mark one of the authenticated user's or professional's notifications as read
+// @Tags notifications
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Notification ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/{id}/read [put]
+func MarkNotificationRead(c *fiber.Ctx) error {
+	filter, err := inboxFilter(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("notifications")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid notification ID"})
+	}
+
+	update := bson.M{
+		"$set": bson.M{"read": true},
+	}
+
+	filter["_id"] = id
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Notification not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead godoc
+// @Summary Mark all notifications as read
+// @Description Mark every unread notification of the authenticated user or professional as read
+// @Tags notifications
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/read-all [put]
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	filter, err := inboxFilter(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("notifications")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"read": true},
+	}
+
+	filter["read"] = false
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]interface{}{
+		"message":       "Notifications marked as read",
+		"modifiedCount": result.ModifiedCount,
+	})
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// preparePoll validates a poll submitted with a new post and resets
+// everything the author does not get to choose.
+func preparePoll(poll *models.Poll) error {
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" {
+		return errors.New("Poll question is required")
+	}
+	if err := checkLength("Poll question", poll.Question, models.MaxPollQuestionLength); err != nil {
+		return err
+	}
+
+	if len(poll.Options) < models.MinPollOptions || len(poll.Options) > models.MaxPollOptions {
+		return fmt.Errorf("Polls need between %d and %d options", models.MinPollOptions, models.MaxPollOptions)
+	}
+	seen := map[string]bool{}
+	for i := range poll.Options {
+		text := strings.TrimSpace(poll.Options[i].Text)
+		if text == "" {
+			return errors.New("Poll options cannot be empty")
+		}
+		if err := checkLength("Poll option", text, models.MaxPollOptionLength); err != nil {
+			return err
+		}
+		if seen[strings.ToLower(text)] {
+			return errors.New("Poll options must be different from each other")
+		}
+		seen[strings.ToLower(text)] = true
+
+		poll.Options[i] = models.PollOption{ID: i + 1, Text: text}
+	}
+
+	if !poll.ClosesAt.IsZero() && !poll.ClosesAt.After(time.Now()) {
+		return errors.New("Poll closing time must be in the future")
+	}
+
+	poll.Closed = false
+	poll.TotalVoters = 0
+	return nil
+}
+
+// pollClosed reports whether voting on poll has ended, either by hand or
+// because its closing time has passed.
+func pollClosed(poll models.Poll, now time.Time) bool {
+	return poll.Closed || (!poll.ClosesAt.IsZero() && !now.Before(poll.ClosesAt))
+}
+
+// showPolls prepares the polls on posts for userID: it marks their vote and
+// hides the counts of open polls they have not voted in. Polls are pointers,
+// so the posts are updated in place.
+func showPolls(ctx context.Context, posts []models.Post, userID string) error {
+	var postIDs []int
+	for _, post := range posts {
+		if post.Poll != nil {
+			postIDs = append(postIDs, post.PostID)
+		}
+	}
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	votes := map[int][]int{}
+	if userID != "" {
+		filter := bson.M{"userID": userID, "postID": bson.M{"$in": postIDs}}
+		cursor, err := database.GetCollection("pollVotes").Find(ctx, filter)
+		if err != nil {
+			return err
+		}
+		var found []models.PollVote
+		if err := cursor.All(ctx, &found); err != nil {
+			return err
+		}
+		for _, vote := range found {
+			votes[vote.PostID] = vote.OptionIDs
+		}
+	}
+
+	now := time.Now()
+	for _, post := range posts {
+		poll := post.Poll
+		if poll == nil {
+			continue
+		}
+
+		poll.Closed = pollClosed(*poll, now)
+		poll.MyVote, poll.Voted = votes[post.PostID]
+		poll.ResultsHidden = !poll.Voted && !poll.Closed
+		if poll.ResultsHidden {
+			for i := range poll.Options {
+				poll.Options[i].Votes = 0
+			}
+		}
+	}
+	return nil
+}
+
+// VotePoll godoc
+// @Summary Vote in a poll
+// @Description Vote in the poll on a post. Each user votes once; single-choice polls take exactly one option.
+// @Description The response shows the results.
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Param vote body object true "Vote payload, e.g. {\"optionIDs\": [2]}"
+// @Success 200 {object} models.Poll
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id}/poll/vote [post]
+func VotePoll(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("posts")
+	votes := database.GetCollection("pollVotes")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var requestData struct {
+		OptionIDs []int `json:"optionIDs"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var post models.Post
+	if err := collection.FindOne(ctx, bson.M{"postID": id}).Decode(&post); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+	if post.Poll == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "This post has no poll"})
+	}
+	if !canAccessPost(ctx, post, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	valid := map[int]bool{}
+	for _, option := range post.Poll.Options {
+		valid[option.ID] = true
+	}
+	chosen := map[int]bool{}
+	for _, optionID := range requestData.OptionIDs {
+		if !valid[optionID] || chosen[optionID] {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid poll option"})
+		}
+		chosen[optionID] = true
+	}
+	if len(chosen) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Choose at least one option"})
+	}
+	if len(chosen) > 1 && !post.Poll.MultipleChoice {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "This poll only takes one choice"})
+	}
+
+	if pollClosed(*post.Poll, time.Now()) {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "This poll is closed"})
+	}
+
+	count, err := votes.CountDocuments(ctx, bson.M{"postID": id, "userID": user.ID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if count > 0 {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "You have already voted in this poll"})
+	}
+
+	// The vote is recorded before it is counted so the unique index settles double votes
+	vote := models.PollVote{
+		PostID:    id,
+		UserID:    user.ID,
+		OptionIDs: requestData.OptionIDs,
+		CreatedAt: time.Now(),
+	}
+	if _, err := votes.InsertOne(ctx, vote); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(http.StatusConflict).JSON(map[string]string{"error": "You have already voted in this poll"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	// Only an open poll is counted, so results stop changing once it closes
+	now := time.Now()
+	filter := bson.M{
+		"postID":      id,
+		"poll.closed": false,
+		"$or": []bson.M{
+			{"poll.closesAt": bson.M{"$exists": false}},
+			{"poll.closesAt": bson.M{"$gt": now}},
+		},
+	}
+	update := bson.M{
+		"$inc": bson.M{
+			"poll.totalVoters":             1,
+			"poll.options.$[chosen].votes": 1,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"chosen.id": bson.M{"$in": requestData.OptionIDs}}}}).
+		SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&post); err != nil {
+		if _, err := votes.DeleteOne(ctx, bson.M{"postID": id, "userID": user.ID}); err != nil {
+			log.Printf("Failed to withdraw uncounted vote on post %d: %s", id, err)
+		}
+		if err == mongo.ErrNoDocuments {
+			return c.Status(http.StatusConflict).JSON(map[string]string{"error": "This poll is closed"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := showPolls(ctx, []models.Post{post}, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(post.Poll)
+}
+
+// ClosePoll godoc
+// @Summary Close a poll
+// @Description Stop voting on the poll on a post and reveal the final results to everyone. Post author and moderators only.
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Success 200 {object} models.Poll
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id}/poll/close [post]
+func ClosePoll(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var post models.Post
+	if err := collection.FindOne(ctx, bson.M{"postID": id}).Decode(&post); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+	if post.Poll == nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "This post has no poll"})
+	}
+
+	if !isModerator(user) {
+		authorID, err := postAuthorID(ctx, post)
+		if err != nil || authorID != user.ID {
+			return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the author or a moderator can close this poll"})
+		}
+	}
+
+	if !pollClosed(*post.Poll, time.Now()) {
+		update := bson.M{"$set": bson.M{"poll.closed": true, "poll.closesAt": time.Now()}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := collection.FindOneAndUpdate(ctx, bson.M{"postID": id}, update, opts).Decode(&post); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	if err := showPolls(ctx, []models.Post{post}, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(post.Poll)
+}
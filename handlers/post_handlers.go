@@ -0,0 +1,613 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"gofiber-mongodb/server/markdown"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreatePost godoc
+// @Summary Create a new post
+// @Description Create a new post on a forum board as the authenticated user.
+// @Description Boards that allow it accept anonymous posts, shown under a per-thread pseudonym.
+// @Description A post can carry a single or multiple choice poll with an optional closing time.
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param post body models.Post true "Post Payload"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts [post]
+func CreatePost(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var post models.Post
+	if err := c.BodyParser(&post); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if post.BoardID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Board ID is required"})
+	}
+
+	if strings.TrimSpace(post.Content) == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Content is required"})
+	}
+	if err := checkLength("Content", post.Content, models.MaxPostContentLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	post.Tags, err = normalizeTags(post.Tags)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if post.Poll != nil {
+		if err := preparePoll(post.Poll); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	board, err := findBoard(ctx, post.BoardID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+	if !canAccessBoard(ctx, board, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	if post.Anonymous && !board.AllowAnonymous {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "This board does not allow anonymous posts"})
+	}
+
+	attachments, err := claimAttachments(ctx, post.Attachments, user.ID, 0)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	post.Attachments = hexIDs(attachments)
+
+	postID, err := database.NextID(ctx, "postID")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	post.PostID = postID
+	post.UserID = user.ID
+	post.ProfID = 0
+	post.Pseudonym = ""
+	post.ContentHTML = markdown.Render(post.Content)
+	post.CreationDateTime = time.Now()
+	post.EditDateTime = time.Time{}
+	post.Edited = false
+	post.NumOfReplies = 0
+	post.LastActivityAt = post.CreationDateTime
+	post.HotScore = hotScore(0, post.CreationDateTime)
+	post.AcceptedCommentID = 0
+	post.HasProfessionalAnswer = false
+	post.Pinned = false
+	post.PinnedAt = time.Time{}
+
+	if post.Mentions, err = resolveMentions(ctx, post.Content); err != nil {
+		log.Printf("Failed to resolve mentions in new post: %s", err)
+	}
+
+	actorID, authorName := user.ID, user.FirstName
+	if post.Anonymous {
+		// The real author is kept out of the post document entirely
+		if err := recordAnonymousAuthor(ctx, post.PostID, 0, user.ID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		post.UserID = ""
+		post.Pseudonym = threadPseudonym(post.PostID, user.ID)
+		actorID, authorName = "", post.Pseudonym
+	}
+
+	_, err = collection.InsertOne(ctx, post)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := linkAttachments(ctx, attachments, post.PostID, 0); err != nil {
+		log.Printf("Failed to link attachments to post %d: %s", post.PostID, err)
+	}
+
+	if err := adjustTagCounts(ctx, post.Tags, nil); err != nil {
+		log.Printf("Failed to count tags on post %d: %s", post.PostID, err)
+	}
+
+	// The author follows their own thread so they hear about replies
+	if err := subscribe(ctx, models.Subscription{UserID: user.ID, PostID: post.PostID}); err != nil {
+		log.Printf("Failed to subscribe %s to post %d: %s", user.ID, post.PostID, err)
+	}
+
+	post.SupportResources = screenForCrisis(ctx, models.ModerationFlag{
+		TargetType: "post",
+		PostID:     post.PostID,
+		UserID:     post.UserID,
+	}, post.Content)
+
+	go notifySubscribers(board, bson.M{"boardID": post.BoardID}, user.ID, models.Notification{
+		ActorID: actorID,
+		Type:    models.NotificationNewPost,
+		BoardID: post.BoardID,
+		PostID:  post.PostID,
+		Message: authorName + " started a new thread: " + excerpt(post.Content),
+	})
+
+	go notifyMentions(board, post.Mentions, user.ID, 0, models.Notification{
+		ActorID: actorID,
+		BoardID: post.BoardID,
+		PostID:  post.PostID,
+		Message: authorName + " mentioned you in a post: " + excerpt(post.Content),
+	})
+
+	if err := showPolls(ctx, []models.Post{post}, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(post)
+}
+
+// GetPost godoc
+// @Summary Get a post by ID
+// @Description Get a post by ID
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id} [get]
+func GetPost(c *fiber.Ctx) error {
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var post models.Post
+	err = collection.FindOne(ctx, bson.M{"postID": id}).Decode(&post)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+
+	user, prof := optionalCaller(c)
+	if !canAccessPost(ctx, post, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	if err := showPolls(ctx, []models.Post{post}, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(post)
+}
+
+// UpdatePost godoc
+// @Summary Update a post
+// @Description Edit the content or tags of a post. Only the author may edit, and the previous content is kept as a revision.
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Param post body models.Post true "Post Payload (only content and tags are used; omit tags to keep them)"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id} [put]
+func UpdatePost(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var requestData struct {
+		Content string    `json:"content"`
+		Tags    *[]string `json:"tags"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var tags []string
+	if requestData.Tags != nil {
+		if tags, err = normalizeTags(*requestData.Tags); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	if strings.TrimSpace(requestData.Content) == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Content is required"})
+	}
+	if err := checkLength("Content", requestData.Content, models.MaxPostContentLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var post models.Post
+	if err := collection.FindOne(ctx, bson.M{"postID": id}).Decode(&post); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+
+	authorID, err := postAuthorID(ctx, post)
+	if err != nil || authorID != user.ID {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the author can edit this post"})
+	}
+
+	board, err := findBoard(ctx, post.BoardID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+	if !canAccessBoard(ctx, board, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	set := bson.M{}
+
+	// Tags are not part of the revision history, so they only need saving when they change
+	var addedTags, removedTags []string
+	if requestData.Tags != nil {
+		addedTags, removedTags = tagDifference(tags, post.Tags), tagDifference(post.Tags, tags)
+		if len(addedTags) > 0 || len(removedTags) > 0 {
+			set["tags"] = tags
+		}
+	}
+
+	contentChanged := requestData.Content != post.Content
+
+	revision := models.Revision{
+		PostID:    post.PostID,
+		Content:   post.Content,
+		WrittenAt: post.CreationDateTime,
+	}
+	if post.Edited {
+		revision.WrittenAt = post.EditDateTime
+	}
+
+	mentions := post.Mentions
+	contentHTML := post.ContentHTML
+	now := time.Now()
+	if contentChanged {
+		if mentions, err = resolveMentions(ctx, requestData.Content); err != nil {
+			log.Printf("Failed to resolve mentions in post %d: %s", id, err)
+			mentions = post.Mentions
+		}
+		contentHTML = markdown.Render(requestData.Content)
+		set["content"] = requestData.Content
+		set["contentHTML"] = contentHTML
+		set["mentions"] = mentions
+		set["editDateTime"] = now
+		set["edited"] = true
+	}
+
+	if len(set) > 0 {
+		// Matching on the old content makes a concurrent edit fail instead of losing
+		// a revision or counting a tag change twice
+		result, err := collection.UpdateOne(ctx, bson.M{"postID": id, "content": post.Content}, bson.M{"$set": set})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		if result.MatchedCount == 0 {
+			return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Post was edited concurrently, please retry"})
+		}
+	}
+
+	if _, ok := set["tags"]; ok {
+		if err := adjustTagCounts(ctx, addedTags, removedTags); err != nil {
+			log.Printf("Failed to count tags on post %d: %s", id, err)
+		}
+		post.Tags = tags
+	}
+
+	if err := showPolls(ctx, []models.Post{post}, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if !contentChanged {
+		return c.Status(http.StatusOK).JSON(post)
+	}
+
+	if err := saveRevision(ctx, revision, now); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	added := newMentions(mentions, post.Mentions)
+
+	post.Content = requestData.Content
+	post.ContentHTML = contentHTML
+	post.Mentions = mentions
+	post.EditDateTime = now
+	post.Edited = true
+
+	actorID, authorName := user.ID, user.FirstName
+	if post.Anonymous {
+		actorID, authorName = "", post.Pseudonym
+	}
+	go notifyMentions(board, added, user.ID, 0, models.Notification{
+		ActorID: actorID,
+		BoardID: post.BoardID,
+		PostID:  post.PostID,
+		Message: authorName + " mentioned you in a post: " + excerpt(post.Content),
+	})
+
+	post.SupportResources = screenForCrisis(ctx, models.ModerationFlag{
+		TargetType: "post",
+		PostID:     post.PostID,
+		UserID:     post.UserID,
+	}, post.Content)
+
+	return c.Status(http.StatusOK).JSON(post)
+}
+
+// GetBoardPosts godoc
+// @Summary List posts on a forum board
+// @Description List posts on a forum board, pinned posts first and then newest first
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Param professionalAnswered query bool false "Only return threads answered by a verified professional"
+// @Param limit query int false "Maximum number of posts (default 50, max 100)"
+// @Success 200 {array} models.Post
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/posts [get]
+func GetBoardPosts(c *fiber.Ctx) error {
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	board, err := findBoard(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+	user, prof := optionalCaller(c)
+	if !canAccessBoard(ctx, board, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	filter := bson.M{"boardID": id}
+	if c.QueryBool("professionalAnswered") {
+		filter["hasProfessionalAnswer"] = true
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: "creationDateTime", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	posts := []models.Post{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if err := showPolls(ctx, posts, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(posts)
+}
+
+// AcceptAnswer godoc
+// @Summary Mark a comment as the accepted answer
+// @Description Let the post author mark one comment as the accepted answer. A commentID of 0 clears it.
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Param answer body object true "Accepted answer payload, e.g. {\"commentID\": 123}"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id}/accepted-answer [put]
+func AcceptAnswer(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var requestData struct {
+		CommentID int `json:"commentID"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var post models.Post
+	if err := collection.FindOne(ctx, bson.M{"postID": id}).Decode(&post); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+
+	authorID, err := postAuthorID(ctx, post)
+	if err != nil || authorID != user.ID {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the post author can accept an answer"})
+	}
+	if !canAccessPost(ctx, post, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	update := bson.M{"$unset": bson.M{"acceptedCommentID": ""}}
+	if requestData.CommentID != 0 {
+		count, err := database.GetCollection("comments").CountDocuments(ctx, bson.M{"commentID": requestData.CommentID, "postID": id})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		if count == 0 {
+			return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Comment not found on this post"})
+		}
+
+		update = bson.M{"$set": bson.M{"acceptedCommentID": requestData.CommentID}}
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"postID": id}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	post.AcceptedCommentID = requestData.CommentID
+	if err := showPolls(ctx, []models.Post{post}, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	return c.Status(http.StatusOK).JSON(post)
+}
+
+// PinPost godoc
+// @Summary Pin or unpin a post
+// @Description Pin a post to the top of its board, or unpin it. Moderators only.
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Param pin body object true "Pin payload, e.g. {\"pinned\": true}"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id}/pin [put]
+func PinPost(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var requestData struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	var post models.Post
+	if err := collection.FindOne(ctx, bson.M{"postID": id}).Decode(&post); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+
+	if post.Pinned == requestData.Pinned {
+		return c.Status(http.StatusOK).JSON(post)
+	}
+
+	action := models.AuditUnpinPost
+	update := bson.M{"$unset": bson.M{"pinned": "", "pinnedAt": ""}}
+	if requestData.Pinned {
+		count, err := collection.CountDocuments(ctx, bson.M{"boardID": post.BoardID, "pinned": true})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+		if count >= models.MaxPinnedPosts {
+			return c.Status(http.StatusConflict).JSON(map[string]string{"error": fmt.Sprintf("A board can have at most %d pinned posts", models.MaxPinnedPosts)})
+		}
+
+		action = models.AuditPinPost
+		update = bson.M{"$set": bson.M{"pinned": true, "pinnedAt": time.Now()}}
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"postID": id}, update, opts).Decode(&post); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     action,
+		TargetType: "post",
+		TargetID:   post.PostID,
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	if err := showPolls(ctx, []models.Post{post}, user.ID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(post)
+}
+
+// excerpt shortens text for use in notification messages.
+func excerpt(text string) string {
+	const maxLen = 80
+
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
+	}
+	return string(runes[:maxLen]) + "..."
+}
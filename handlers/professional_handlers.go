@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LoginProfessional godoc
+// @Summary Log in as a healthcare professional
+// @Description Authenticate a healthcare professional and return a professional JWT
+// @Tags professionals
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/login [post]
+func LoginProfessional(c *fiber.Ctx) error {
+	var loginRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &loginRequest); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var prof models.HealthCareProfessional
+	err := database.GetCollection("professionals").FindOne(ctx, bson.M{"emailAddress": loginRequest.Email}).Decode(&prof)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Invalid email or password"})
+	}
+
+	var password models.ProfessionalPassword
+	err = database.GetCollection("professionalPasswords").FindOne(ctx, bson.M{"profID": prof.ProfID}).Decode(&password)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Invalid email or password"})
+	}
+
+	// Verify the password using bcrypt
+	err = bcrypt.CompareHashAndPassword([]byte(password.PassHash), []byte(loginRequest.Password))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Invalid email or password"})
+	}
+
+	token, err := GenerateProfessionalToken(prof.ProfID, prof.EmailAddress)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to generate token"})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{
+		"message": "Login successful",
+		"token":   token,
+	})
+}
+
+// GenerateProfessionalToken generates a JWT token for the given professional
+func GenerateProfessionalToken(profID int, email string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email":  email,
+		"profID": profID,
+		"role":   roleProfessional,
+		"exp":    time.Now().Add(time.Hour * 48).Unix(), // Token expiration time
+	})
+
+	return token.SignedString([]byte(os.Getenv("SECRET")))
+}
+
+// professionalBadge builds the verified badge for prof, or nil if they are not verified.
+func professionalBadge(prof models.HealthCareProfessional) *models.ProfessionalBadge {
+	if !prof.IsVerified {
+		return nil
+	}
+
+	return &models.ProfessionalBadge{
+		ProfID:      prof.ProfID,
+		Name:        prof.FirstName + " " + prof.LastName,
+		Credentials: prof.Credentials,
+	}
+}
+
+// UpdateProfessionalHandle godoc
+// @Summary Set a professional's handle
+// @Description Set the public handle the authenticated professional can be @mentioned by
+// @Tags professionals
+// @Accept  json
+// @Produce  json
+// @Param handle body object true "Handle payload, e.g. {\"handle\": \"midwife_kate\"}"
+// @Success 200 {object} models.HealthCareProfessional
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/handle [put]
+func UpdateProfessionalHandle(c *fiber.Ctx) error {
+	prof, err := currentProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("professionals")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Handle string `json:"handle"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	handle := strings.ToLower(strings.TrimSpace(requestData.Handle))
+	if err := checkHandle(ctx, handle, "", prof.ProfID); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	update := bson.M{
+		"$set": bson.M{"handle": handle},
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"profID": prof.ProfID}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	prof.Handle = handle
+	return c.Status(http.StatusOK).JSON(prof)
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"gofiber-mongodb/server/mailer"
+	"gofiber-mongodb/server/scheduler"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// jobConsultationReminder is the scheduler job type for consultation reminders.
+const jobConsultationReminder = "consultation_reminder"
+
+// consultationReminders are how long before a consultation its reminders go out.
+var consultationReminders = []struct {
+	Name   string
+	Before time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"1h", time.Hour},
+}
+
+// reminderData is the data of a reminder job. At is the consultation time the
+// reminder was scheduled for, so a reminder for an old time is dropped.
+type reminderData struct {
+	RequestID int       `bson:"requestID"`
+	Name      string    `bson:"name"`
+	At        time.Time `bson:"at"`
+}
+
+// RunScheduler runs the background jobs, such as consultation reminders, for
+// the life of the server. Start it with go.
+func RunScheduler() {
+	scheduler.Register(jobConsultationReminder, sendConsultationReminder)
+	scheduler.Run()
+}
+
+func reminderKey(requestID int, name string) string {
+	return "consultation-" + strconv.Itoa(requestID) + "-" + name
+}
+
+// scheduleConsultationReminders sets up the reminders for a scheduled
+// consultation, replacing any set for an earlier time. Reminders that would
+// already be due are skipped.
+func scheduleConsultationReminders(ctx context.Context, request models.ConsultationRequests) error {
+	now := time.Now()
+	var stale []string
+	for _, reminder := range consultationReminders {
+		key := reminderKey(request.RequestID, reminder.Name)
+		runAt := request.ConsultationDateTime.Add(-reminder.Before)
+		if !runAt.After(now) {
+			stale = append(stale, key)
+			continue
+		}
+
+		err := scheduler.Schedule(ctx, scheduler.Job{
+			Type:  jobConsultationReminder,
+			Key:   key,
+			RunAt: runAt,
+			Data: bson.M{
+				"requestID": request.RequestID,
+				"name":      reminder.Name,
+				"at":        request.ConsultationDateTime,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return scheduler.Cancel(ctx, stale...)
+}
+
+// cancelConsultationReminders cancels the reminders of a consultation that is no longer scheduled.
+func cancelConsultationReminders(ctx context.Context, requestID int) error {
+	keys := make([]string, 0, len(consultationReminders))
+	for _, reminder := range consultationReminders {
+		keys = append(keys, reminderKey(requestID, reminder.Name))
+	}
+	return scheduler.Cancel(ctx, keys...)
+}
+
+// notificationChannels returns the channels the member matched by filter
+// wants reminders on, in-app only if they have not chosen.
+func notificationChannels(ctx context.Context, filter bson.M) ([]string, error) {
+	var preference models.NotificationPreference
+	err := database.GetCollection("notificationPreferences").FindOne(ctx, filter).Decode(&preference)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return []string{models.ChannelInApp}, nil
+	}
+	return preference.Channels, err
+}
+
+// sendReminder delivers a reminder to a user or professional on each of their
+// channels. The in-app copy is only added once, so a retried job does not
+// repeat it.
+func sendReminder(ctx context.Context, filter bson.M, email string, n models.Notification) error {
+	channels, err := notificationChannels(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		switch channel {
+		case models.ChannelInApp:
+			n.Read = false
+			n.CreatedAt = time.Now()
+			existing := bson.M{"type": n.Type, "requestID": n.RequestID, "message": n.Message}
+			for k, v := range filter {
+				existing[k] = v
+			}
+			opts := options.Update().SetUpsert(true)
+			if _, err := database.GetCollection("notifications").UpdateOne(ctx, existing, bson.M{"$setOnInsert": n}, opts); err != nil {
+				return err
+			}
+		case models.ChannelEmail:
+			if email == "" {
+				continue
+			}
+			if err := mailer.Send(email, "Consultation reminder", n.Message); err != nil {
+				if errors.Is(err, mailer.ErrNotConfigured) {
+					log.Printf("Skipping reminder email for consultation request %d: %s", n.RequestID, err)
+					continue
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sendConsultationReminder runs a reminder job, reminding both sides of the
+// consultation if it is still scheduled for the time the reminder was set for.
+func sendConsultationReminder(ctx context.Context, job scheduler.Job) error {
+	var data reminderData
+	raw, err := bson.Marshal(job.Data)
+	if err != nil {
+		return err
+	}
+	if err := bson.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+
+	var request models.ConsultationRequests
+	err = database.GetCollection("consultationrequests").FindOne(ctx, bson.M{"requestID": data.RequestID}).Decode(&request)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if request.Status != models.ConsultationScheduled || !request.ConsultationDateTime.Equal(data.At) {
+		return nil
+	}
+
+	// A retried or overdue reminder is dropped once the consultation has
+	// started or a later reminder is due, so it never says the wrong time
+	remaining := time.Until(request.ConsultationDateTime)
+	if remaining <= 0 || reminderSuperseded(data.Name, remaining) {
+		return nil
+	}
+
+	var user models.User
+	var prof models.HealthCareProfessional
+	if objID, err := primitive.ObjectIDFromHex(request.UserID); err == nil {
+		if err := database.GetCollection("users").FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+	if err := database.GetCollection("professionals").FindOne(ctx, bson.M{"profID": request.ProfID}).Decode(&prof); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	// Show the time in the professional's time zone when they have set one
+	loc := time.UTC
+	if availability, err := findAvailability(ctx, request.ProfID); err == nil {
+		if l, err := time.LoadLocation(availability.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	when := request.ConsultationDateTime.In(loc).Format("Mon 2 Jan 2006 at 15:04 MST")
+
+	in := timeLeft(remaining)
+
+	n := models.Notification{
+		Type:      models.NotificationConsultationReminder,
+		RequestID: request.RequestID,
+	}
+
+	n.Message = fmt.Sprintf("Reminder: your consultation with %s %s is %s, on %s.", prof.FirstName, prof.LastName, in, when)
+	if err := sendReminder(ctx, bson.M{"userID": request.UserID}, user.Email, n); err != nil {
+		return err
+	}
+
+	n.Message = fmt.Sprintf("Reminder: your consultation with %s %s is %s, on %s.", user.FirstName, user.LastName, in, when)
+	return sendReminder(ctx, bson.M{"profID": request.ProfID}, prof.EmailAddress, n)
+}
+
+// GetNotificationPreferences godoc
+// @Summary Get notification preferences
+// @Description Get the channels the authenticated user or professional receives reminders on. Without saved
+// @Description preferences reminders are in-app only.
+// @Tags notifications
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} models.NotificationPreference
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/preferences [get]
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	filter, err := inboxFilter(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	channels, err := notificationChannels(ctx, filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	preference := models.NotificationPreference{Channels: channels}
+	preference.UserID, _ = filter["userID"].(string)
+	preference.ProfID, _ = filter["profID"].(int)
+
+	return c.Status(http.StatusOK).JSON(preference)
+}
+
+// UpdateNotificationPreferences godoc
+// @Summary Set notification preferences
+// @Description Choose the channels the authenticated user or professional receives reminders on: "in_app" and
+// @Description "email". An empty list turns reminders off.
+// @Tags notifications
+// @Accept  json
+// @Produce  json
+// @Param preferences body models.NotificationPreference true "Preferences payload, e.g. {\"channels\": [\"in_app\", \"email\"]}"
+// @Success 200 {object} models.NotificationPreference
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/preferences [put]
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	filter, err := inboxFilter(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("notificationPreferences")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var preference models.NotificationPreference
+	if err := c.BodyParser(&preference); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	channels := []string{}
+	seen := map[string]bool{}
+	for _, channel := range preference.Channels {
+		if channel != models.ChannelInApp && channel != models.ChannelEmail {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": fmt.Sprintf("Unknown channel %q", channel)})
+		}
+		if !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+
+	preference = models.NotificationPreference{
+		Channels:  channels,
+		UpdatedAt: time.Now(),
+	}
+	preference.UserID, _ = filter["userID"].(string)
+	preference.ProfID, _ = filter["profID"].(int)
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := collection.ReplaceOne(ctx, filter, preference, opts); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(preference)
+}
+
+// reminderSuperseded reports whether a reminder closer to the consultation
+// than the named one is already due.
+func reminderSuperseded(name string, remaining time.Duration) bool {
+	var before time.Duration
+	for _, reminder := range consultationReminders {
+		if reminder.Name == name {
+			before = reminder.Before
+		}
+	}
+	for _, reminder := range consultationReminders {
+		if reminder.Before < before && remaining <= reminder.Before {
+			return true
+		}
+	}
+	return false
+}
+
+// timeLeft says how long until a consultation, such as "in 2 hours", in
+// minutes when it is under an hour away.
+func timeLeft(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		minutes := int(d / time.Minute)
+		if minutes <= 1 {
+			return "in 1 minute"
+		}
+		return fmt.Sprintf("in %d minutes", minutes)
+	}
+	hours := int(d.Round(time.Hour) / time.Hour)
+	if hours == 1 {
+		return "in 1 hour"
+	}
+	return fmt.Sprintf("in %d hours", hours)
+}
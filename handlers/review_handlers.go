@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ratingBreakdown counts a professional's visible reviews by stars.
+func ratingBreakdown(ctx context.Context, profID int) (map[int]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"profID": profID, "hidden": false}}},
+		{{Key: "$group", Value: bson.M{"_id": "$rating", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := database.GetCollection("reviews").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Rating int `bson:"_id"`
+		Count  int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	breakdown := map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}
+	for _, row := range rows {
+		breakdown[row.Rating] = row.Count
+	}
+	return breakdown, nil
+}
+
+// refreshProfessionalRating recounts a professional's rating from their
+// visible reviews. Recounting rather than adjusting keeps it right when
+// reviews are written, hidden and restored at the same time.
+func refreshProfessionalRating(ctx context.Context, profID int) error {
+	breakdown, err := ratingBreakdown(ctx, profID)
+	if err != nil {
+		return err
+	}
+
+	count, total := 0, 0
+	for stars, n := range breakdown {
+		count += n
+		total += stars * n
+	}
+
+	update := bson.M{"$unset": bson.M{"ratingAverage": "", "ratingCount": ""}}
+	if count > 0 {
+		average := math.Round(float64(total)/float64(count)*100) / 100
+		update = bson.M{"$set": bson.M{"ratingAverage": average, "ratingCount": count}}
+	}
+
+	_, err = database.GetCollection("professionals").UpdateOne(ctx, bson.M{"profID": profID}, update)
+	return err
+}
+
+// findReview loads the review in the route. On failure it returns the HTTP
+// status to respond with.
+func findReview(c *fiber.Ctx, ctx context.Context) (models.Review, int, error) {
+	var review models.Review
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return review, http.StatusBadRequest, errors.New("Invalid review ID")
+	}
+	if err := database.GetCollection("reviews").FindOne(ctx, bson.M{"_id": id}).Decode(&review); err != nil {
+		return review, http.StatusNotFound, errors.New("Review not found")
+	}
+	return review, http.StatusOK, nil
+}
+
+// GetProfessionalProfile godoc
+// @Summary Get a professional's profile
+// @Description Get the public profile of a healthcare professional, with their average rating and how many reviews
+// @Description gave each number of stars
+// @Tags professionals
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Professional ID"
+// @Success 200 {object} models.ProfessionalProfile
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/{id} [get]
+func GetProfessionalProfile(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid professional ID"})
+	}
+
+	var prof models.HealthCareProfessional
+	if err := database.GetCollection("professionals").FindOne(ctx, bson.M{"profID": id}).Decode(&prof); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Professional not found"})
+	}
+
+	breakdown, err := ratingBreakdown(ctx, prof.ProfID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(models.ProfessionalProfile{
+		ProfID:             prof.ProfID,
+		Name:               prof.FirstName + " " + prof.LastName,
+		Handle:             prof.Handle,
+		Badge:              professionalBadge(prof),
+		ProfBio:            prof.ProfBio,
+		Gender:             prof.Gender,
+		IsConsultant:       prof.IsConsultant,
+		CommunicationTypes: prof.CommunicationTypes,
+		RatingAverage:      prof.RatingAverage,
+		RatingCount:        prof.RatingCount,
+		RatingBreakdown:    breakdown,
+	})
+}
+
+// CreateReview godoc
+// @Summary Review a consultation
+// @Description Rate the professional from 1 to 5 stars after a completed consultation, with an optional review. Only
+// @Description the user on the request can review it, and only once.
+// @Tags reviews
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Request ID"
+// @Param review body object true "Review payload, e.g. {\"rating\": 5, \"text\": \"...\"}"
+// @Success 200 {object} models.Review
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /consultationrequests/{id}/review [post]
+func CreateReview(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("reviews")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Rating int    `json:"rating"`
+		Text   string `json:"text"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if requestData.Rating < 1 || requestData.Rating > 5 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Rating must be from 1 to 5"})
+	}
+	text := strings.TrimSpace(requestData.Text)
+	if err := checkLength("Review", text, models.MaxReviewLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	request, status, err := findConsultationRequest(c, ctx, user, models.HealthCareProfessional{})
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+	if request.Status != models.ConsultationCompleted {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Only completed consultations can be reviewed"})
+	}
+
+	review := models.Review{
+		RequestID:  request.RequestID,
+		UserID:     user.ID,
+		AuthorName: user.FirstName,
+		ProfID:     request.ProfID,
+		Rating:     requestData.Rating,
+		Text:       text,
+		CreatedAt:  time.Now(),
+	}
+
+	// The unique index on requestID stops a second review, even from two requests at once
+	result, err := collection.InsertOne(ctx, review)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "You have already reviewed this consultation"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	review.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := refreshProfessionalRating(ctx, review.ProfID); err != nil {
+		log.Printf("Failed to refresh the rating of professional %d: %s", review.ProfID, err)
+	}
+
+	n := models.Notification{
+		ActorID:   user.ID,
+		Type:      models.NotificationNewReview,
+		RequestID: request.RequestID,
+		Message:   user.FirstName + " reviewed your consultation",
+	}
+	if err := notifyProfessionals(ctx, []int{review.ProfID}, n); err != nil {
+		log.Printf("Failed to notify professional %d of a review: %s", review.ProfID, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(review)
+}
+
+// GetProfessionalReviews godoc
+// @Summary List a professional's reviews
+// @Description List the reviews of a professional, newest first. Pass the ID of the last review received as before to
+// @Description get the next page. Moderators can include hidden reviews.
+// @Tags reviews
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Professional ID"
+// @Param before query string false "Only reviews older than this review ID"
+// @Param limit query int false "Maximum number of reviews (default 20, max 100)"
+// @Param hidden query bool false "Include hidden reviews (moderators only)"
+// @Success 200 {array} models.Review
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /professionals/{id}/reviews [get]
+func GetProfessionalReviews(c *fiber.Ctx) error {
+	user, _ := optionalCaller(c)
+
+	collection := database.GetCollection("reviews")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid professional ID"})
+	}
+
+	filter := bson.M{"profID": id}
+	if !(c.QueryBool("hidden") && isModerator(user)) {
+		filter["hidden"] = false
+	}
+	if c.Query("before") != "" {
+		before, err := primitive.ObjectIDFromHex(c.Query("before"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid review ID"})
+		}
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	reviews := []models.Review{}
+	if err := cursor.All(ctx, &reviews); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(reviews)
+}
+
+// ReplyToReview godoc
+// @Summary Reply to a review
+// @Description Publicly reply to a review of the authenticated professional, replacing any earlier reply
+// @Tags reviews
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Review ID"
+// @Param reply body object true "Reply payload, e.g. {\"reply\": \"...\"}"
+// @Success 200 {object} models.Review
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /reviews/{id}/reply [put]
+func ReplyToReview(c *fiber.Ctx) error {
+	prof, err := currentProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("reviews")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Reply string `json:"reply"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	reply := strings.TrimSpace(requestData.Reply)
+	if reply == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Reply cannot be empty"})
+	}
+	if err := checkLength("Reply", reply, models.MaxReviewLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	review, status, err := findReview(c, ctx)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+	if review.ProfID != prof.ProfID {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You can only reply to reviews of yourself"})
+	}
+
+	review.Reply = reply
+	review.RepliedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"reply":     review.Reply,
+			"repliedAt": review.RepliedAt,
+		},
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": review.ID}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(review)
+}
+
+// setReviewHidden hides or restores the review in the route on behalf of a moderator.
+func setReviewHidden(c *fiber.Ctx, hidden bool) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("reviews")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Reason string `json:"reason"`
+	}
+	// The reason is optional when restoring, so the body may be empty
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&requestData); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+
+	reason := strings.TrimSpace(requestData.Reason)
+	if hidden && reason == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "A reason is required"})
+	}
+	if err := checkLength("Reason", reason, maxReasonLength); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	review, status, err := findReview(c, ctx)
+	if err != nil {
+		return c.Status(status).JSON(map[string]string{"error": err.Error()})
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": review.ID, "hidden": !hidden}, bson.M{"$set": bson.M{"hidden": hidden}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if result.ModifiedCount == 0 {
+		if hidden {
+			return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Review is already hidden"})
+		}
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "Review is not hidden"})
+	}
+	review.Hidden = hidden
+
+	action := models.AuditUnhideReview
+	if hidden {
+		action = models.AuditHideReview
+	}
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     action,
+		TargetType: "review",
+		TargetID:   review.RequestID,
+		TargetName: review.ID.Hex(),
+		Reason:     reason,
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	if err := refreshProfessionalRating(ctx, review.ProfID); err != nil {
+		log.Printf("Failed to refresh the rating of professional %d: %s", review.ProfID, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(review)
+}
+
+// HideReview godoc
+// @Summary Hide a review
+// @Description Hide an abusive review from listings and from the professional's rating. Moderators only.
+// @Tags moderation
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Review ID"
+// @Param reason body object true "Reason payload, e.g. {\"reason\": \"...\"}"
+// @Success 200 {object} models.Review
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /reviews/{id}/hide [put]
+func HideReview(c *fiber.Ctx) error {
+	return setReviewHidden(c, true)
+}
+
+// UnhideReview godoc
+// @Summary Restore a hidden review
+// @Description Show a hidden review again and count it towards the professional's rating. Moderators only.
+// @Tags moderation
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Review ID"
+// @Param reason body object false "Reason payload, e.g. {\"reason\": \"...\"}"
+// @Success 200 {object} models.Review
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /reviews/{id}/unhide [put]
+func UnhideReview(c *fiber.Ctx) error {
+	return setReviewHidden(c, false)
+}
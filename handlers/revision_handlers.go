@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// revisionEntry is one version of some content, with the changes from the version before it.
+type revisionEntry struct {
+	Content   string          `json:"content"`
+	WrittenAt time.Time       `json:"writtenAt"`
+	Current   bool            `json:"current"`
+	Diff      []models.DiffOp `json:"diff,omitempty"`
+}
+
+// saveRevision stores superseded content once an edit has replaced it.
+func saveRevision(ctx context.Context, revision models.Revision, replacedAt time.Time) error {
+	revision.ReplacedAt = replacedAt
+	_, err := database.GetCollection("revisions").InsertOne(ctx, revision)
+	return err
+}
+
+// revisionHistory loads the stored revisions matching filter and appends the current content.
+func revisionHistory(ctx context.Context, filter bson.M, current string, currentWrittenAt time.Time) ([]revisionEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "replacedAt", Value: 1}})
+	cursor, err := database.GetCollection("revisions").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []models.Revision
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+
+	entries := make([]revisionEntry, 0, len(revisions)+1)
+	for _, revision := range revisions {
+		entries = append(entries, revisionEntry{Content: revision.Content, WrittenAt: revision.WrittenAt})
+	}
+	entries = append(entries, revisionEntry{Content: current, WrittenAt: currentWrittenAt, Current: true})
+
+	for i := 1; i < len(entries); i++ {
+		entries[i].Diff = diffWords(entries[i-1].Content, entries[i].Content)
+	}
+
+	return entries, nil
+}
+
+// GetPostRevisions godoc
+// @Summary Get the edit history of a post
+// @Description List every version of a post, oldest first, with word diffs between versions. Author and moderators only.
+// @Tags posts
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Success 200 {array} revisionEntry
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id}/revisions [get]
+func GetPostRevisions(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var post models.Post
+	if err := database.GetCollection("posts").FindOne(ctx, bson.M{"postID": id}).Decode(&post); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+
+	if !isModerator(user) {
+		authorID, err := postAuthorID(ctx, post)
+		if err != nil || authorID != user.ID {
+			return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the author or a moderator can view the edit history"})
+		}
+	}
+	if !canAccessPost(ctx, post, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	writtenAt := post.CreationDateTime
+	if post.Edited {
+		writtenAt = post.EditDateTime
+	}
+
+	filter := bson.M{"postID": id, "commentID": bson.M{"$exists": false}}
+	entries, err := revisionHistory(ctx, filter, post.Content, writtenAt)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(entries)
+}
+
+// GetCommentRevisions godoc
+// @Summary Get the edit history of a comment
+// @Description List every version of a comment, oldest first, with word diffs between versions. Author and moderators only.
+// @Tags comments
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Comment ID"
+// @Success 200 {array} revisionEntry
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /comments/{id}/revisions [get]
+func GetCommentRevisions(c *fiber.Ctx) error {
+	user, prof, err := currentUserOrProfessional(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid comment ID"})
+	}
+
+	var comment models.Comment
+	if err := database.GetCollection("comments").FindOne(ctx, bson.M{"commentID": id}).Decode(&comment); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Comment not found"})
+	}
+
+	if !isModerator(user) && !isCommentAuthor(ctx, comment, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Only the author or a moderator can view the edit history"})
+	}
+	if !canAccessComment(ctx, comment, user, prof) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	writtenAt := comment.CreationDateTime
+	if comment.Edited {
+		writtenAt = comment.EditDateTime
+	}
+
+	filter := bson.M{"postID": comment.PostID, "commentID": id}
+	entries, err := revisionHistory(ctx, filter, comment.Content, writtenAt)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(entries)
+}
+
+// diffWords computes a word-level diff turning before into after.
+func diffWords(before, after string) []models.DiffOp {
+	// Bound the quadratic table; very long edits fall back to replace-all
+	const maxCells = 1 << 20
+
+	a := strings.Fields(before)
+	b := strings.Fields(after)
+
+	if len(a)*len(b) > maxCells {
+		var ops []models.DiffOp
+		ops = appendDiffOp(ops, models.DiffDelete, a...)
+		return appendDiffOp(ops, models.DiffInsert, b...)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []models.DiffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = appendDiffOp(ops, models.DiffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = appendDiffOp(ops, models.DiffDelete, a[i])
+			i++
+		default:
+			ops = appendDiffOp(ops, models.DiffInsert, b[j])
+			j++
+		}
+	}
+	ops = appendDiffOp(ops, models.DiffDelete, a[i:]...)
+	return appendDiffOp(ops, models.DiffInsert, b[j:]...)
+}
+
+// appendDiffOp adds words to ops, merging them into the last run when the operation matches.
+func appendDiffOp(ops []models.DiffOp, op string, words ...string) []models.DiffOp {
+	if len(words) == 0 {
+		return ops
+	}
+
+	text := strings.Join(words, " ")
+	if n := len(ops); n > 0 && ops[n-1].Op == op {
+		ops[n-1].Text += " " + text
+		return ops
+	}
+	return append(ops, models.DiffOp{Op: op, Text: text})
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// subscribe records a subscription unless the user already has it.
+func subscribe(ctx context.Context, sub models.Subscription) error {
+	collection := database.GetCollection("subscriptions")
+
+	filter := bson.M{"userID": sub.UserID}
+	if sub.PostID != 0 {
+		filter["postID"] = sub.PostID
+	} else {
+		filter["boardID"] = sub.BoardID
+	}
+
+	update := bson.M{
+		"$setOnInsert": bson.M{"createdAt": time.Now()},
+	}
+
+	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// SubscribePost godoc
+// @Summary Subscribe to a post
+// @Description Get notified about new comments on a post
+// @Tags subscriptions
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id}/subscribe [post]
+func SubscribePost(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	var post models.Post
+	if err := database.GetCollection("posts").FindOne(ctx, bson.M{"postID": id}).Decode(&post); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Post not found"})
+	}
+	if !canAccessPost(ctx, post, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	if err := subscribe(ctx, models.Subscription{UserID: user.ID, PostID: id}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Subscribed to post"})
+}
+
+// UnsubscribePost godoc
+// @Summary Unsubscribe from a post
+// @Description Stop notifications about new comments on a post
+// @Tags subscriptions
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Post ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /posts/{id}/subscribe [delete]
+func UnsubscribePost(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("subscriptions")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid post ID"})
+	}
+
+	_, err = collection.DeleteOne(ctx, bson.M{"userID": user.ID, "postID": id})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Unsubscribed from post"})
+}
+
+// SubscribeBoard godoc
+// @Summary Subscribe to a forum board
+// @Description Get notified about new posts on a forum board
+// @Tags subscriptions
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/subscribe [post]
+func SubscribeBoard(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	board, err := findBoard(ctx, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Board not found"})
+	}
+	if !canAccessBoard(ctx, board, user, models.HealthCareProfessional{}) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You do not have access to this board"})
+	}
+
+	if err := subscribe(ctx, models.Subscription{UserID: user.ID, BoardID: id}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Subscribed to board"})
+}
+
+// UnsubscribeBoard godoc
+// @Summary Unsubscribe from a forum board
+// @Description Stop notifications about new posts on a forum board
+// @Tags subscriptions
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Board ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /boards/{id}/subscribe [delete]
+func UnsubscribeBoard(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("subscriptions")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid board ID"})
+	}
+
+	_, err = collection.DeleteOne(ctx, bson.M{"userID": user.ID, "boardID": id})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(map[string]string{"message": "Unsubscribed from board"})
+}
+
+// GetSubscriptions godoc
+// @Summary List subscriptions
+// @Description List the posts and boards the authenticated user is subscribed to
+// @Tags subscriptions
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.Subscription
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions [get]
+func GetSubscriptions(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("subscriptions")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"userID": user.ID}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	subscriptions := []models.Subscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(subscriptions)
+}
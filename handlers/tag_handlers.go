@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	tagSeparators = regexp.MustCompile(`[\s_]+`)
+	tagInvalid    = regexp.MustCompile(`[^a-z0-9-]+`)
+	tagHyphens    = regexp.MustCompile(`-{2,}`)
+)
+
+// normalizeTag turns user input such as "#Second Trimester" into "second-trimester".
+func normalizeTag(raw string) (string, error) {
+	tag := strings.ToLower(strings.TrimSpace(raw))
+	tag = strings.TrimLeft(tag, "#")
+	tag = tagSeparators.ReplaceAllString(tag, "-")
+	tag = tagInvalid.ReplaceAllString(tag, "")
+	tag = tagHyphens.ReplaceAllString(tag, "-")
+	tag = strings.Trim(tag, "-")
+
+	if utf8.RuneCountInString(tag) > models.MaxTagLength {
+		return "", fmt.Errorf("Tags must be at most %d characters", models.MaxTagLength)
+	}
+	return tag, nil
+}
+
+// normalizeTags normalizes and de-duplicates the tags given for a post.
+func normalizeTags(raw []string) ([]string, error) {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, r := range raw {
+		tag, err := normalizeTag(r)
+		if err != nil {
+			return nil, err
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > models.MaxTagsPerPost {
+		return nil, fmt.Errorf("A post can have at most %d tags", models.MaxTagsPerPost)
+	}
+	return tags, nil
+}
+
+// adjustTagCounts keeps tag post counts in step when a post's tags change,
+// creating free-form tags the first time they are used.
+func adjustTagCounts(ctx context.Context, added, removed []string) error {
+	collection := database.GetCollection("tags")
+
+	for _, name := range added {
+		update := bson.M{
+			"$inc":         bson.M{"postCount": 1},
+			"$setOnInsert": bson.M{"curated": false, "createdAt": time.Now()},
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"name": name}, update, options.Update().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range removed {
+		if _, err := collection.UpdateOne(ctx, bson.M{"name": name}, bson.M{"$inc": bson.M{"postCount": -1}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tagDifference returns the tags in a that are not in b.
+func tagDifference(a, b []string) []string {
+	in := map[string]bool{}
+	for _, tag := range b {
+		in[tag] = true
+	}
+
+	var diff []string
+	for _, tag := range a {
+		if !in[tag] {
+			diff = append(diff, tag)
+		}
+	}
+	return diff
+}
+
+// mergeTags moves every post tagged from over to into and removes from.
+// The merged tag stays curated if either tag was.
+func mergeTags(ctx context.Context, from, into models.Tag) (models.Tag, error) {
+	posts := database.GetCollection("posts")
+	tags := database.GetCollection("tags")
+
+	// A field cannot be added to and pulled from in the same update
+	if _, err := posts.UpdateMany(ctx, bson.M{"tags": from.Name}, bson.M{"$addToSet": bson.M{"tags": into.Name}}); err != nil {
+		return into, err
+	}
+	if _, err := posts.UpdateMany(ctx, bson.M{"tags": from.Name}, bson.M{"$pull": bson.M{"tags": from.Name}}); err != nil {
+		return into, err
+	}
+
+	count, err := posts.CountDocuments(ctx, bson.M{"tags": into.Name})
+	if err != nil {
+		return into, err
+	}
+
+	into.Curated = into.Curated || from.Curated
+	into.PostCount = int(count)
+	if into.CreatedAt.IsZero() {
+		into.CreatedAt = from.CreatedAt
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"curated": into.Curated, "postCount": into.PostCount},
+		"$setOnInsert": bson.M{"createdAt": into.CreatedAt},
+	}
+	if _, err := tags.UpdateOne(ctx, bson.M{"name": into.Name}, update, options.Update().SetUpsert(true)); err != nil {
+		return into, err
+	}
+
+	if _, err := tags.DeleteOne(ctx, bson.M{"name": from.Name}); err != nil {
+		return into, err
+	}
+
+	return into, nil
+}
+
+// SearchTags godoc
+// @Summary Autocomplete tags
+// @Description List tags starting with a prefix, curated tags first, then by popularity
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param q query string false "Tag prefix"
+// @Param limit query int false "Maximum number of tags (default 10, max 50)"
+// @Success 200 {array} models.Tag
+// @Failure 500 {object} map[string]string
+// @Router /tags [get]
+func SearchTags(c *fiber.Ctx) error {
+	collection := database.GetCollection("tags")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"postCount": bson.M{"$gt": 0}}
+	prefix, _ := normalizeTag(c.Query("q"))
+	if prefix != "" {
+		filter["name"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+
+	limit := c.QueryInt("limit", 10)
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "curated", Value: -1}, {Key: "postCount", Value: -1}, {Key: "name", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	tags := []models.Tag{}
+	if err := cursor.All(ctx, &tags); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(tags)
+}
+
+// trendingTag is a tag with the number of recent posts using it.
+type trendingTag struct {
+	Name  string `json:"name" bson:"_id"`
+	Posts int    `json:"posts" bson:"posts"`
+}
+
+// GetTrendingTags godoc
+// @Summary List trending tags
+// @Description List the tags used on the most posts over the last 7 days
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Maximum number of tags (default 10, max 50)"
+// @Success 200 {array} trendingTag
+// @Failure 500 {object} map[string]string
+// @Router /tags/trending [get]
+func GetTrendingTags(c *fiber.Ctx) error {
+	collection := database.GetCollection("posts")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	limit := c.QueryInt("limit", 10)
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+
+	match := bson.M{"creationDateTime": bson.M{"$gte": time.Now().AddDate(0, 0, -7)}}
+	user, prof := optionalCaller(c)
+	if err := excludeHiddenBoards(ctx, match, user, prof); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$unwind": "$tags"},
+		{"$group": bson.M{"_id": "$tags", "posts": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{{Key: "posts", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": limit},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	tags := []trendingTag{}
+	if err := cursor.All(ctx, &tags); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(tags)
+}
+
+// GetTagFeed godoc
+// @Summary List posts with a tag
+// @Description Page through posts carrying a tag, ranked and paged like board feeds
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Tag name"
+// @Param sort query string false "hot (default), new, active or top"
+// @Param t query string false "Window for top: day, week (default), month, year or all"
+// @Param cursor query string false "nextCursor from the previous page"
+// @Param limit query int false "Maximum number of posts (default 50, max 100)"
+// @Success 200 {object} feedPage
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tags/{name}/posts [get]
+func GetTagFeed(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name, err := normalizeTag(c.Params("name"))
+	if err != nil || name == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid tag"})
+	}
+
+	filter := bson.M{"tags": name}
+	user, prof := optionalCaller(c)
+	if user.ID != "" {
+		if err := excludeBlockedAuthors(ctx, filter, user.ID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+	if err := excludeHiddenBoards(ctx, filter, user, prof); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return loadFeed(c, ctx, filter, user.ID, nil)
+}
+
+// CreateTag godoc
+// @Summary Create a curated tag
+// @Description Add a curated tag, or mark an existing free-form tag as curated. Moderators only.
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param tag body models.Tag true "Tag payload (only name is used)"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tags [post]
+func CreateTag(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("tags")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	name, err := normalizeTag(requestData.Name)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+	if name == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Name is required"})
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"curated": true},
+		"$setOnInsert": bson.M{"postCount": 0, "createdAt": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var tag models.Tag
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"name": name}, update, opts).Decode(&tag); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(tag)
+}
+
+// MergeTag godoc
+// @Summary Merge one tag into another
+// @Description Retag every post from one tag to another and remove the first tag. Moderators only; the action is audited.
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Tag to merge away"
+// @Param merge body object true "Merge payload, e.g. {\"into\": \"morning-sickness\"}"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tags/{name}/merge [post]
+func MergeTag(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("tags")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Into string `json:"into"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	fromName, _ := normalizeTag(c.Params("name"))
+	intoName, err := normalizeTag(requestData.Into)
+	if err != nil || intoName == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid target tag"})
+	}
+	if fromName == intoName {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "A tag cannot be merged into itself"})
+	}
+
+	var from, into models.Tag
+	if err := collection.FindOne(ctx, bson.M{"name": fromName}).Decode(&from); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Tag not found"})
+	}
+	if err := collection.FindOne(ctx, bson.M{"name": intoName}).Decode(&into); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Target tag not found"})
+	}
+
+	merged, err := mergeTags(ctx, from, into)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditMergeTag,
+		TargetType: "tag",
+		TargetName: from.Name,
+		Reason:     "Merged into " + merged.Name,
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	return c.Status(http.StatusOK).JSON(merged)
+}
+
+// RenameTag godoc
+// @Summary Rename a tag
+// @Description Rename a tag on every post that uses it. Moderators only; the action is audited.
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Current tag name"
+// @Param rename body object true "Rename payload, e.g. {\"name\": \"ivf\"}"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tags/{name} [put]
+func RenameTag(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+	if !isModerator(user) {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "Moderator access required"})
+	}
+
+	collection := database.GetCollection("tags")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	fromName, _ := normalizeTag(c.Params("name"))
+	newName, err := normalizeTag(requestData.Name)
+	if err != nil || newName == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid tag name"})
+	}
+
+	var from models.Tag
+	if err := collection.FindOne(ctx, bson.M{"name": fromName}).Decode(&from); err != nil {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Tag not found"})
+	}
+	if newName == from.Name {
+		return c.Status(http.StatusOK).JSON(from)
+	}
+
+	count, err := collection.CountDocuments(ctx, bson.M{"name": newName})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+	if count > 0 {
+		return c.Status(http.StatusConflict).JSON(map[string]string{"error": "A tag with that name already exists, merge the tags instead"})
+	}
+
+	renamed, err := mergeTags(ctx, from, models.Tag{Name: newName})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	if err := writeAuditLog(ctx, models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditRenameTag,
+		TargetType: "tag",
+		TargetName: from.Name,
+		Reason:     "Renamed to " + renamed.Name,
+	}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": "Failed to record audit log"})
+	}
+
+	return c.Status(http.StatusOK).JSON(renamed)
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"gofiber-mongodb/models"
 	"gofiber-mongodb/server/database"
 	"log"
@@ -32,49 +31,12 @@ import (
 // @Failure 500 {object} map[string]string
 // @Router /users/{id} [get]
 func GetUser(c *fiber.Ctx) error {
-	// Extract the token from the Authorization header
-	authHeader := c.Get("Authorization")
-	if authHeader == "" {
-		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Missing or malformed JWT"})
+	user, err := currentUser(c)
+	if err == errUserNotFound {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": err.Error()})
 	}
-
-	splitToken := strings.Split(authHeader, "Bearer ")
-	if len(splitToken) != 2 {
-		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Malformed JWT"})
-	}
-	tokenString := splitToken[1]
-
-	// Parse and validate the token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(os.Getenv("SECRET")), nil
-	})
-
-	if err != nil {
-		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Invalid or expired JWT"})
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Invalid or expired JWT"})
-	}
-
-	// Check if the "email" claim is present and is a string
-	email, ok := claims["email"].(string)
-	if !ok || email == "" {
-		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": "Invalid JWT claims"})
-	}
-
-	collection := database.GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var user models.User
-	err = collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "User not found"})
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
 	}
 
 	// Strip passhash from response
@@ -104,6 +66,7 @@ func CreateUser(c *fiber.Ctx) error {
 		LastName  string `json:"lastname"`
 		Email     string `json:"email"`
 		Password  string `json:"password"`
+		Handle    string `json:"handle"`
 	}
 	
 	if err := c.BodyParser(&requestData); err != nil {
@@ -125,6 +88,16 @@ func CreateUser(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Email is already taken"})
 	}
 
+	// Use the requested handle, or pick one from the user's name
+	handle := strings.ToLower(strings.TrimSpace(requestData.Handle))
+	if handle != "" {
+		if err := checkHandle(ctx, handle, "", 0); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+	} else if handle, err = generateHandle(ctx, requestData.FirstName, requestData.LastName); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
 	// Hash the password using bcrypt
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(requestData.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -136,6 +109,7 @@ func CreateUser(c *fiber.Ctx) error {
 		FirstName: requestData.FirstName,
 		LastName:  requestData.LastName,
 		Email:     requestData.Email,
+		Handle:    handle,
 		PassHash:  string(hashedPassword),
 	}
 
@@ -159,6 +133,11 @@ func CreateUser(c *fiber.Ctx) error {
 
 // Global UpdateUserField to be referenced
 func UpdateUser(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
 	collection := database.GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -169,15 +148,23 @@ func UpdateUser(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "User ID is required"})
 	}
 
-	// Parse the request body for the fields to be updated
-	var updateData map[string]interface{}
-	if err := c.BodyParser(&updateData); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	// Users can only edit their own profile
+	if userID != user.ID {
+		return c.Status(http.StatusForbidden).JSON(map[string]string{"error": "You can only update your own profile"})
 	}
 
-	// Ensure that the updateData is not empty
-	if len(updateData) == 0 {
-		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "No update data provided"})
+	// Parse the request body for the fields to be updated. Roles, due dates,
+	// email and password have their own endpoints or none, so they cannot be set here
+	var requestData struct {
+		FirstName         *string `json:"firstname"`
+		LastName          *string `json:"lastname"`
+		Handle            *string `json:"handle"`
+		UserBio           *string `json:"userbio"`
+		PhoneNum          *int    `json:"phonenum"`
+		IsExpectingMother *bool   `json:"isexpectingmother"`
+	}
+	if err := c.BodyParser(&requestData); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
 	}
 
 	// Convert the user ID to an ObjectID
@@ -186,6 +173,37 @@ func UpdateUser(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Invalid user ID format"})
 	}
 
+	updateData := bson.M{}
+	if requestData.FirstName != nil {
+		updateData["firstname"] = strings.TrimSpace(*requestData.FirstName)
+	}
+	if requestData.LastName != nil {
+		updateData["lastname"] = strings.TrimSpace(*requestData.LastName)
+	}
+	if requestData.UserBio != nil {
+		updateData["userbio"] = *requestData.UserBio
+	}
+	if requestData.PhoneNum != nil {
+		updateData["phonenum"] = *requestData.PhoneNum
+	}
+	if requestData.IsExpectingMother != nil {
+		updateData["isexpectingmother"] = *requestData.IsExpectingMother
+	}
+
+	// Handles must stay unique across users and professionals
+	if requestData.Handle != nil {
+		handle := strings.ToLower(strings.TrimSpace(*requestData.Handle))
+		if err := checkHandle(ctx, handle, userID, 0); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+		updateData["handle"] = handle
+	}
+
+	// Ensure that the updateData is not empty
+	if len(updateData) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "No update data provided"})
+	}
+
 	// Create the update document
 	update := bson.M{
 		"$set": updateData,
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"gofiber-mongodb/models"
+	"gofiber-mongodb/server/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxAddressFieldLength bounds each part of a saved address.
+const maxAddressFieldLength = 100
+
+// GetUserAddress godoc
+// @Summary Get your address
+// @Description Get the authenticated user's saved address
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} models.UserAddress
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/address [get]
+func GetUserAddress(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("userAddresses")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var address models.UserAddress
+	err = collection.FindOne(ctx, bson.M{"userID": user.ID}).Decode(&address)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(http.StatusNotFound).JSON(map[string]string{"error": "Address not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(address)
+}
+
+// UpdateUserAddress godoc
+// @Summary Save your address
+// @Description Create or replace the authenticated user's address. Professional matching searches near its suburb and state.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param address body models.UserAddress true "Address payload"
+// @Success 200 {object} models.UserAddress
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/address [put]
+func UpdateUserAddress(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(map[string]string{"error": err.Error()})
+	}
+
+	collection := database.GetCollection("userAddresses")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var address models.UserAddress
+	if err := c.BodyParser(&address); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+	}
+
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"Unit number", &address.UnitNumber},
+		{"Street number", &address.StreetNum},
+		{"Street name", &address.StreetName},
+		{"Suburb", &address.Suburb},
+		{"State", &address.State},
+	}
+	for _, field := range fields {
+		*field.value = strings.TrimSpace(*field.value)
+		if err := checkLength(field.name, *field.value, maxAddressFieldLength); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": err.Error()})
+		}
+	}
+	if address.Suburb == "" || address.State == "" {
+		return c.Status(http.StatusBadRequest).JSON(map[string]string{"error": "Suburb and state are required"})
+	}
+
+	address.UserID = user.ID
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := collection.ReplaceOne(ctx, bson.M{"userID": user.ID}, address, opts); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(map[string]string{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusOK).JSON(address)
+}
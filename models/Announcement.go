@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Announcement limits, in characters of Markdown source for the content.
+const (
+	MaxAnnouncementTitleLength   = 200
+	MaxAnnouncementContentLength = 5000
+)
+
+// Announcement is a site-wide notice from moderators, such as a product recall.
+// It is shown to everyone until it expires or they dismiss it.
+type Announcement struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Title       string             `json:"title" bson:"title"`
+	Content     string             `json:"content" bson:"content"`
+	ContentHTML string             `json:"contentHTML" bson:"contentHTML"`
+	CreatedBy   string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	// ExpiresAt is when the announcement stops being shown. A zero ExpiresAt
+	// keeps it up until a moderator deletes it.
+	ExpiresAt time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+}
+
+// AnnouncementDismissal records that a user or professional has dismissed an
+// announcement. Exactly one of UserID and ProfID is set.
+type AnnouncementDismissal struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	AnnouncementID primitive.ObjectID `json:"announcementID" bson:"announcementID"`
+	UserID         string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID         int                `json:"profID,omitempty" bson:"profID,omitempty"`
+	DismissedAt    time.Time          `json:"dismissedAt" bson:"dismissedAt"`
+}
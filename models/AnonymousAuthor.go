@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AnonymousAuthor records who really wrote an anonymous post or comment.
+// It is kept apart from the content and only read through the audited
+// moderator lookup. CommentID is zero for the post itself.
+type AnonymousAuthor struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PostID    int                `json:"postID" bson:"postID"`
+	CommentID int                `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	UserID    string             `json:"userID" bson:"userID"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
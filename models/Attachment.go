@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxAttachmentSize is the largest image that can be uploaded, in bytes.
+const MaxAttachmentSize = 8 << 20
+
+// MaxAttachmentsPerItem bounds how many images one post or comment can carry.
+const MaxAttachmentsPerItem = 4
+
+// Attachment is an uploaded image stored in GridFS. It belongs to its
+// uploader until a post or comment claims it. Who uploaded it is never sent
+// to clients, since the image may sit on an anonymous post.
+type Attachment struct {
+	ID                   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID               string             `json:"-" bson:"userID,omitempty"`
+	ProfID               int                `json:"-" bson:"profID,omitempty"`
+	FileID               primitive.ObjectID `json:"-" bson:"fileID"`
+	ThumbnailID          primitive.ObjectID `json:"-" bson:"thumbnailID"`
+	ContentType          string             `json:"contentType" bson:"contentType"`
+	ThumbnailContentType string             `json:"thumbnailContentType" bson:"thumbnailContentType"`
+	Size                 int                `json:"size" bson:"size"`
+	Width                int                `json:"width" bson:"width"`
+	Height               int                `json:"height" bson:"height"`
+	PostID               int                `json:"postID,omitempty" bson:"postID,omitempty"`
+	CommentID            int                `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	CreatedAt            time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions.
+const (
+	AuditRevealAnonymousAuthor = "reveal_anonymous_author"
+	AuditMergeTag              = "merge_tag"
+	AuditRenameTag             = "rename_tag"
+	AuditPinPost               = "pin_post"
+	AuditUnpinPost             = "unpin_post"
+	AuditCreateAnnouncement    = "create_announcement"
+	AuditDeleteAnnouncement    = "delete_announcement"
+	AuditRotateMasterKey       = "rotate_master_key"
+	AuditRotateDataKey         = "rotate_data_key"
+	AuditBackfillEncryption    = "backfill_encryption"
+	AuditHideReview            = "hide_review"
+	AuditUnhideReview          = "unhide_review"
+)
+
+// AuditLog records a privileged action taken by staff.
+type AuditLog struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ActorID    string             `json:"actorID" bson:"actorID"`
+	Action     string             `json:"action" bson:"action"`
+	TargetType string             `json:"targetType" bson:"targetType"`
+	TargetID   int                `json:"targetID" bson:"targetID"`
+	TargetName string             `json:"targetName,omitempty" bson:"targetName,omitempty"`
+	Reason     string             `json:"reason" bson:"reason"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+}
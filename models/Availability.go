@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Availability limits, in minutes.
+const (
+	DefaultSlotMinutes = 30
+	MinSlotMinutes     = 10
+	MaxSlotMinutes     = 240
+	MaxBufferMinutes   = 120
+)
+
+// Availability is a professional's weekly consultation schedule.
+type Availability struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProfID int                `json:"profID" bson:"profID"`
+	// TimeZone is the IANA name the weekly windows are written in, e.g. "Australia/Sydney".
+	TimeZone string               `json:"timeZone" bson:"timeZone"`
+	Weekly   []AvailabilityWindow `json:"weekly" bson:"weekly"`
+	// SlotMinutes is the default consultation length slots are cut into.
+	SlotMinutes int `json:"slotMinutes" bson:"slotMinutes"`
+	// BufferMinutes is the gap kept free between two appointments.
+	BufferMinutes int       `json:"bufferMinutes" bson:"bufferMinutes"`
+	UpdatedAt     time.Time `json:"updatedAt" bson:"updatedAt"`
+
+	// BookingVersion is bumped by every booking so two bookings checked
+	// against the same calendar cannot both succeed.
+	BookingVersion int `json:"-" bson:"bookingVersion"`
+}
+
+// AvailabilityWindow is a recurring block of working time on one weekday,
+// in the schedule's time zone. Weekday counts from 0 for Sunday, and Start
+// and End are "15:04" times.
+type AvailabilityWindow struct {
+	Weekday int    `json:"weekday" bson:"weekday"`
+	Start   string `json:"start" bson:"start"`
+	End     string `json:"end" bson:"end"`
+}
+
+// AvailabilityException changes a professional's schedule for a stretch of
+// time. Leave and other time off have Available false; extra one-off
+// working time has Available true.
+type AvailabilityException struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProfID    int                `json:"profID" bson:"profID"`
+	Start     time.Time          `json:"start" bson:"start"`
+	End       time.Time          `json:"end" bson:"end"`
+	Available bool               `json:"available" bson:"available"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// Booking statuses.
+const (
+	BookingActive   = "active"
+	BookingReleased = "released"
+)
+
+// Booking reserves time on a professional's calendar for a consultation.
+type Booking struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProfID    int                `json:"profID" bson:"profID"`
+	UserID    string             `json:"userID" bson:"userID"`
+	RequestID int                `json:"requestID" bson:"requestID"`
+	Start     time.Time          `json:"start" bson:"start"`
+	End       time.Time          `json:"end" bson:"end"`
+	Status    string             `json:"status" bson:"status"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// Slot is a bookable stretch of a professional's time.
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Block hides everything BlockedUserID posts from UserID's feeds.
+type Block struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID        string             `json:"userID" bson:"userID"`
+	BlockedUserID string             `json:"blockedUserID" bson:"blockedUserID"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Board member roles.
+const (
+	BoardRoleMember = "member"
+	// BoardRoleManager members can add and remove members and answer join requests.
+	BoardRoleManager = "manager"
+)
+
+// BoardMember gives a user or a professional access to a restricted board.
+// Exactly one of UserID and ProfID is set.
+type BoardMember struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BoardID   int                `json:"boardID" bson:"boardID"`
+	UserID    string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID    int                `json:"profID,omitempty" bson:"profID,omitempty"`
+	Role      string             `json:"role" bson:"role"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxCollectionNameLength is the longest bookmark collection name, in characters.
+const MaxCollectionNameLength = 100
+
+// BookmarkCollection is a named group of a user's bookmarks.
+type BookmarkCollection struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"userID" bson:"userID"`
+	Name      string             `json:"name" bson:"name"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// Bookmark saves a post, or a comment on it, for a user to come back to.
+// Bookmarks without a collection are unsorted. CommentID is zero when the
+// post itself is saved.
+type Bookmark struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID       string             `json:"userID" bson:"userID"`
+	CollectionID string             `json:"collectionID,omitempty" bson:"collectionID,omitempty"`
+	PostID       int                `json:"postID" bson:"postID"`
+	CommentID    int                `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CalendarFeed is the private subscription feed of a user's or professional's
+// consultations. Exactly one of UserID and ProfID is set. Only a hash of the
+// feed token is stored; the token itself is shown once, when it is created.
+type CalendarFeed struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID    int                `json:"profID,omitempty" bson:"profID,omitempty"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxChatMessageLength is the longest chat message that can be sent.
+const MaxChatMessageLength = 4000
+
+// ChatMessage is one message in a consultation's chat. Sender is "user" or
+// "professional". UserID is the patient, whose data key encrypts the body.
+// ReadAt is set when the other side has read the message.
+type ChatMessage struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	RequestID int                `json:"requestID" bson:"requestID"`
+	UserID    string             `json:"userID" bson:"userID"`
+	ProfID    int                `json:"profID" bson:"profID"`
+	Sender    string             `json:"sender" bson:"sender"`
+	Body      string             `json:"body" bson:"body"`
+	SentAt    time.Time          `json:"sentAt" bson:"sentAt"`
+	ReadAt    time.Time          `json:"readAt,omitempty" bson:"readAt,omitempty"`
+}
+
+// EncryptionOwner implements database.Encrypted.
+func (m *ChatMessage) EncryptionOwner() string { return m.UserID }
+
+// EncryptedFields implements database.Encrypted.
+func (m *ChatMessage) EncryptedFields() []*string { return []*string{&m.Body} }
@@ -2,11 +2,25 @@ package models
 
 import "time"
 
+// MaxCommentContentLength is the longest comment, in characters of Markdown source.
+const MaxCommentContentLength = 5000
+
 type Comment struct {
-	CommentID        int       `json:"commentID" bson:"commentID"`
-	PostID           int       `json:"postID" bson:"postID"`
-	UserID           int       `json:"userID,omitempty" bson:"userID,omitempty"`
-	ProfID           int       `json:"profID,omitempty" bson:"profID,omitempty"`
-	Content          string    `json:"content" bson:"content"`
-	CreationDateTime time.Time `json:"creationDateTime" bson:"creationDateTime"`
+	CommentID        int                `json:"commentID" bson:"commentID"`
+	PostID           int                `json:"postID" bson:"postID"`
+	UserID           string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID           int                `json:"profID,omitempty" bson:"profID,omitempty"`
+	Content          string             `json:"content" bson:"content"`
+	ContentHTML      string             `json:"contentHTML" bson:"contentHTML"`
+	CreationDateTime time.Time          `json:"creationDateTime" bson:"creationDateTime"`
+	EditDateTime     time.Time          `json:"editDateTime,omitempty" bson:"editDateTime,omitempty"`
+	Edited           bool               `json:"edited" bson:"edited"`
+	Badge            *ProfessionalBadge `json:"badge,omitempty" bson:"badge,omitempty"`
+	Anonymous        bool               `json:"anonymous" bson:"anonymous"`
+	Pseudonym        string             `json:"pseudonym,omitempty" bson:"pseudonym,omitempty"`
+	Mentions         []Mention          `json:"mentions,omitempty" bson:"mentions,omitempty"`
+	Attachments      []string           `json:"attachments,omitempty" bson:"attachments,omitempty"`
+
+	// SupportResources is only set on write responses when crisis language was detected.
+	SupportResources []SupportResource `json:"supportResources,omitempty" bson:"-"`
 }
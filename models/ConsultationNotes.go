@@ -1,6 +1,69 @@
 package models
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Consultation note visibilities.
+const (
+	// NoteShared notes can be read by the patient as well as the professional.
+	NoteShared = "shared"
+	// NoteProfessionalOnly notes are only shown to professionals.
+	NoteProfessionalOnly = "professional_only"
+)
+
+// MaxConsultationNoteLength is the longest text a note version can hold.
+const MaxConsultationNoteLength = 10000
+
+// ConsultationNotes is a clinical note a professional writes about a
+// consultation. A consultation can have many notes. Versions are never
+// changed once signed: corrections are signed as amendments, and the last
+// version is the note's current text and visibility. UserID is the patient,
+// whose data key encrypts the note's text.
 type ConsultationNotes struct {
-	RequestID int    `json:"requestID" bson:"requestID"`
-	Notes     string `json:"notes" bson:"notes"`
+	ID           primitive.ObjectID        `json:"id" bson:"_id,omitempty"`
+	RequestID    int                       `json:"requestID" bson:"requestID"`
+	UserID       string                    `json:"userID" bson:"userID"`
+	AuthorProfID int                       `json:"authorProfID" bson:"authorProfID"`
+	Visibility   string                    `json:"visibility" bson:"visibility"`
+	Version      int                       `json:"version" bson:"version"`
+	Versions     []ConsultationNoteVersion `json:"versions" bson:"versions"`
+	CreatedAt    time.Time                 `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time                 `json:"updatedAt" bson:"updatedAt"`
+
+	// Erased is set per request when the patient's key has been destroyed,
+	// leaving the note's text unreadable.
+	Erased bool `json:"erased,omitempty" bson:"-"`
+}
+
+// ConsultationNoteVersion is one signed version of a note. Reason says why
+// an amendment was made and is empty for the first version.
+//
+// Signature covers the version's contents and the previous version's
+// signature, so no version can be altered, dropped or reordered without
+// breaking the chain. Intact reports whether it still verifies and is set
+// per request.
+type ConsultationNoteVersion struct {
+	Version      int       `json:"version" bson:"version"`
+	Notes        string    `json:"notes" bson:"notes"`
+	Visibility   string    `json:"visibility" bson:"visibility"`
+	Reason       string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	AuthorProfID int       `json:"authorProfID" bson:"authorProfID"`
+	SignedAt     time.Time `json:"signedAt" bson:"signedAt"`
+	Signature    string    `json:"signature" bson:"signature"`
+	Intact       bool      `json:"intact" bson:"-"`
+}
+
+// EncryptionOwner implements database.Encrypted.
+func (n *ConsultationNotes) EncryptionOwner() string { return n.UserID }
+
+// EncryptedFields implements database.Encrypted. The text and reason of every version is encrypted.
+func (n *ConsultationNotes) EncryptedFields() []*string {
+	fields := make([]*string, 0, 2*len(n.Versions))
+	for i := range n.Versions {
+		fields = append(fields, &n.Versions[i].Notes, &n.Versions[i].Reason)
+	}
+	return fields
 }
@@ -2,13 +2,79 @@ package models
 
 import "time"
 
+// Consultation request statuses. A request starts pending and moves through
+// accepted, scheduled and in progress to completed. Declined, completed,
+// cancelled and no-show requests are final.
+const (
+	ConsultationPending    = "pending"
+	ConsultationAccepted   = "accepted"
+	ConsultationDeclined   = "declined"
+	ConsultationScheduled  = "scheduled"
+	ConsultationInProgress = "in_progress"
+	ConsultationCompleted  = "completed"
+	ConsultationCancelled  = "cancelled"
+	ConsultationNoShow     = "no_show"
+)
+
+// CommunicationVideo is the communication type of video consultations.
+const CommunicationVideo = "video"
+
+// MaxConsultationDescriptionLength is the longest description a user can give with a request.
+const MaxConsultationDescriptionLength = 2000
+
 type ConsultationRequests struct {
 	RequestID            int       `json:"requestID" bson:"requestID"`
-	UserID               int       `json:"userID" bson:"userID"`
+	UserID               string    `json:"userID" bson:"userID"`
 	ProfID               int       `json:"profID" bson:"profID"`
 	Description          string    `json:"description,omitempty" bson:"description,omitempty"`
 	CommunicationType    string    `json:"communicationType" bson:"communicationType"`
 	ConsultationDateTime time.Time `json:"consultationDateTime" bson:"consultationDateTime"`
 	Status               string    `json:"status" bson:"status"`
 	PreferredGender      string    `json:"preferredGender,omitempty" bson:"preferredGender,omitempty"`
+
+	// DurationMinutes is the length of the booked slot, set when the request is scheduled.
+	DurationMinutes int `json:"durationMinutes,omitempty" bson:"durationMinutes,omitempty"`
+	// Sequence counts the changes made to the request, so calendar clients
+	// replace their copy of the consultation instead of adding another.
+	Sequence int `json:"sequence" bson:"sequence"`
+
+	// CallEvents records each side joining and leaving the video call, and
+	// Calls each stretch both sides were connected. CallSeconds totals them.
+	CallEvents  []CallEvent   `json:"callEvents,omitempty" bson:"callEvents,omitempty"`
+	Calls       []CallSession `json:"calls,omitempty" bson:"calls,omitempty"`
+	CallSeconds int           `json:"callSeconds,omitempty" bson:"callSeconds,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// StatusHistory lists every status the request has had, oldest first.
+	StatusHistory []ConsultationStatusChange `json:"statusHistory" bson:"statusHistory"`
+}
+
+// ConsultationStatusChange records one step of a consultation request.
+// Exactly one of UserID and ProfID is set, naming who made the change.
+type ConsultationStatusChange struct {
+	Status    string    `json:"status" bson:"status"`
+	UserID    string    `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID    int       `json:"profID,omitempty" bson:"profID,omitempty"`
+	Note      string    `json:"note,omitempty" bson:"note,omitempty"`
+	ChangedAt time.Time `json:"changedAt" bson:"changedAt"`
+}
+
+// Video call events.
+const (
+	CallJoined = "joined"
+	CallLeft   = "left"
+)
+
+// CallEvent records one side of a consultation joining or leaving its video call.
+type CallEvent struct {
+	Party string    `json:"party" bson:"party"`
+	Event string    `json:"event" bson:"event"`
+	At    time.Time `json:"at" bson:"at"`
+}
+
+// CallSession is a stretch of a video call during which both sides were connected.
+type CallSession struct {
+	StartedAt       time.Time `json:"startedAt" bson:"startedAt"`
+	EndedAt         time.Time `json:"endedAt" bson:"endedAt"`
+	DurationSeconds int       `json:"durationSeconds" bson:"durationSeconds"`
 }
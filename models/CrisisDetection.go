@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CrisisDetection logs that crisis rules matched some user-written text.
+// Only the rules and a reference to the text are kept, never the text itself.
+type CrisisDetection struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TargetType string             `json:"targetType" bson:"targetType"`
+	PostID     int                `json:"postID,omitempty" bson:"postID,omitempty"`
+	CommentID  int                `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	JournalID  int                `json:"journalID,omitempty" bson:"journalID,omitempty"`
+	UserID     string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	RuleIDs    []string           `json:"ruleIDs" bson:"ruleIDs"`
+	Categories []string           `json:"categories" bson:"categories"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+}
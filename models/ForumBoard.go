@@ -1,7 +1,33 @@
 package models
 
+// Board visibility settings. An empty visibility means public.
+const (
+	// BoardPublic boards can be read by anyone and written to by any signed-in member.
+	BoardPublic = "public"
+	// BoardMembersOnly boards are listed to everyone, but only members can read
+	// and post. Anyone signed in can join straight away.
+	BoardMembersOnly = "members"
+	// BoardProfessionalsOnly boards are only open to healthcare professionals.
+	BoardProfessionalsOnly = "professionals"
+	// BoardInviteOnly boards are only listed to their members. People join by
+	// invitation or by a join request that a board manager approves.
+	BoardInviteOnly = "invite"
+)
+
 type ForumBoard struct {
 	BoardID     int    `json:"boardID" bson:"boardID"`
 	Topic       string `json:"topic" bson:"topic"`
 	Description string `json:"description" bson:"description"`
+
+	// AllowAnonymous lets members post and comment without revealing who they are.
+	AllowAnonymous bool `json:"allowAnonymous" bson:"allowAnonymous"`
+
+	Visibility string `json:"visibility,omitempty" bson:"visibility,omitempty"`
+
+	// CohortMonth marks a due-date club, the board for everyone due in that
+	// month, in YYYY-MM form.
+	CohortMonth string `json:"cohortMonth,omitempty" bson:"cohortMonth,omitempty"`
+	// Born is set once a due-date club's month has passed and it has become
+	// a "babies born in" board.
+	Born bool `json:"born,omitempty" bson:"born,omitempty"`
 }
@@ -2,6 +2,7 @@ package models
 
 type HealthCareProfessional struct {
 	ProfID       int    `json:"profID" bson:"profID"`
+	Handle       string `json:"handle,omitempty" bson:"handle,omitempty"`
 	FirstName    string `json:"firstName" bson:"firstName"`
 	LastName     string `json:"lastName" bson:"lastName"`
 	EmailAddress string `json:"emailAddress" bson:"emailAddress"`
@@ -10,4 +11,15 @@ type HealthCareProfessional struct {
 	ProfBio      string `json:"profBio" bson:"profBio"`
 	ABN          string `json:"ABN" bson:"ABN"`
 	IsConsultant bool   `json:"isConsultant" bson:"isConsultant"`
+	IsVerified   bool   `json:"isVerified" bson:"isVerified"`
+	Credentials  string `json:"credentials,omitempty" bson:"credentials,omitempty"`
+
+	// Gender lets users ask for a professional of a particular gender.
+	Gender string `json:"gender,omitempty" bson:"gender,omitempty"`
+	// CommunicationTypes lists how the professional consults, e.g. "video"
+	// or "phone". Empty means they have not said.
+	CommunicationTypes []string `json:"communicationTypes,omitempty" bson:"communicationTypes,omitempty"`
+	// RatingAverage and RatingCount summarise the reviews the professional has received.
+	RatingAverage float64 `json:"ratingAverage,omitempty" bson:"ratingAverage,omitempty"`
+	RatingCount   int     `json:"ratingCount,omitempty" bson:"ratingCount,omitempty"`
 }
@@ -1,10 +1,22 @@
 package models
 
+import "time"
+
+// HealthRecord holds a user's basic pregnancy measurements. The measurements
+// are stored together as encrypted JSON in Values and never in the clear.
 type HealthRecord struct {
-	UserID         int    `json:"userID" bson:"userID"`
-	Age            int    `json:"age" bson:"age"`
-	Height         int    `json:"height" bson:"height"`
-	Weight         int    `json:"weight" bson:"weight"`
-	PregnancyPhase string `json:"pregnancyPhase" bson:"pregnancyPhase"`
-	WeeksAlong     int    `json:"weeksAlong" bson:"weeksAlong"`
+	UserID         string    `json:"userID" bson:"userID"`
+	Age            int       `json:"age" bson:"-"`
+	Height         int       `json:"height" bson:"-"`
+	Weight         int       `json:"weight" bson:"-"`
+	PregnancyPhase string    `json:"pregnancyPhase" bson:"-"`
+	WeeksAlong     int       `json:"weeksAlong" bson:"-"`
+	Values         string    `json:"-" bson:"values"`
+	UpdatedAt      time.Time `json:"updatedAt" bson:"updatedAt"`
 }
+
+// EncryptionOwner implements database.Encrypted.
+func (r *HealthRecord) EncryptionOwner() string { return r.UserID }
+
+// EncryptedFields implements database.Encrypted.
+func (r *HealthRecord) EncryptedFields() []*string { return []*string{&r.Values} }
@@ -2,14 +2,36 @@ package models
 
 import "time"
 
+// MaxJournalFieldLength is the longest journal text field, in characters of Markdown source.
+const MaxJournalFieldLength = 5000
+
 // HealthJournal represents the health journal entity.
+// The *HTML fields hold the server-rendered form of the matching text field.
 type HealthJournal struct {
-	JournalID   int       `json:"journalID" bson:"journalID"`
-	UserID      int       `json:"userID" bson:"userID"`
-	EntryDate   time.Time `json:"entryDate" bson:"entryDate"`
-	Feeling     string    `json:"feeling,omitempty" bson:"feeling,omitempty"`
-	Gratitudes  string    `json:"gratitudes,omitempty" bson:"gratitudes,omitempty"`
-	SelfCare    string    `json:"selfCare,omitempty" bson:"selfCare,omitempty"`
-	Thoughts    string    `json:"thoughts,omitempty" bson:"thoughts,omitempty"`
-	DailyRating int       `json:"dailyRating,omitempty" bson:"dailyRating,omitempty"`
+	JournalID      int       `json:"journalID" bson:"journalID"`
+	UserID         string    `json:"userID" bson:"userID"`
+	EntryDate      time.Time `json:"entryDate" bson:"entryDate"`
+	Feeling        string    `json:"feeling,omitempty" bson:"feeling,omitempty"`
+	Gratitudes     string    `json:"gratitudes,omitempty" bson:"gratitudes,omitempty"`
+	SelfCare       string    `json:"selfCare,omitempty" bson:"selfCare,omitempty"`
+	Thoughts       string    `json:"thoughts,omitempty" bson:"thoughts,omitempty"`
+	DailyRating    int       `json:"dailyRating,omitempty" bson:"dailyRating,omitempty"`
+	FeelingHTML    string    `json:"feelingHTML,omitempty" bson:"feelingHTML,omitempty"`
+	GratitudesHTML string    `json:"gratitudesHTML,omitempty" bson:"gratitudesHTML,omitempty"`
+	SelfCareHTML   string    `json:"selfCareHTML,omitempty" bson:"selfCareHTML,omitempty"`
+	ThoughtsHTML   string    `json:"thoughtsHTML,omitempty" bson:"thoughtsHTML,omitempty"`
+
+	// SupportResources is only set on write responses when crisis language was detected.
+	SupportResources []SupportResource `json:"supportResources,omitempty" bson:"-"`
+}
+
+// EncryptionOwner implements database.Encrypted.
+func (j *HealthJournal) EncryptionOwner() string { return j.UserID }
+
+// EncryptedFields implements database.Encrypted. All text and its rendered HTML is encrypted.
+func (j *HealthJournal) EncryptedFields() []*string {
+	return []*string{
+		&j.Feeling, &j.Gratitudes, &j.SelfCare, &j.Thoughts,
+		&j.FeelingHTML, &j.GratitudesHTML, &j.SelfCareHTML, &j.ThoughtsHTML,
+	}
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Join request statuses.
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+// MaxJoinRequestMessageLength is the longest note that can accompany a join request.
+const MaxJoinRequestMessageLength = 500
+
+// JoinRequest asks to join an invite-only board. Exactly one of UserID and
+// ProfID is set.
+type JoinRequest struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BoardID   int                `json:"boardID" bson:"boardID"`
+	UserID    string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID    int                `json:"profID,omitempty" bson:"profID,omitempty"`
+	Message   string             `json:"message,omitempty" bson:"message,omitempty"`
+	Status    string             `json:"status" bson:"status"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	DecidedBy string             `json:"decidedBy,omitempty" bson:"decidedBy,omitempty"`
+	DecidedAt time.Time          `json:"decidedAt,omitempty" bson:"decidedAt,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// MaxMentions bounds how many people one post or comment can mention.
+const MaxMentions = 10
+
+// Mention is an @handle in a post or comment, resolved to the user or
+// professional it names. Exactly one of UserID and ProfID is set.
+type Mention struct {
+	Handle string `json:"handle" bson:"handle"`
+	UserID string `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID int    `json:"profID,omitempty" bson:"profID,omitempty"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Moderation flag reasons.
+const (
+	FlagReasonCrisis = "crisis"
+)
+
+// Moderation flag statuses.
+const (
+	FlagStatusOpen     = "open"
+	FlagStatusResolved = "resolved"
+)
+
+// Moderation flag priorities. Higher values are reviewed first.
+const (
+	FlagPriorityNormal = 1
+	FlagPriorityHigh   = 2
+	FlagPriorityUrgent = 3
+)
+
+// ModerationFlag is an item in the moderation queue. It points at the
+// flagged content rather than copying it.
+type ModerationFlag struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Reason     string             `json:"reason" bson:"reason"`
+	TargetType string             `json:"targetType" bson:"targetType"`
+	PostID     int                `json:"postID,omitempty" bson:"postID,omitempty"`
+	CommentID  int                `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	JournalID  int                `json:"journalID,omitempty" bson:"journalID,omitempty"`
+	UserID     string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	Categories []string           `json:"categories,omitempty" bson:"categories,omitempty"`
+	Priority   int                `json:"priority" bson:"priority"`
+	Status     string             `json:"status" bson:"status"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	ResolvedBy string             `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty"`
+	ResolvedAt time.Time          `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification types.
+const (
+	NotificationNewComment = "new_comment"
+	NotificationNewPost    = "new_post"
+	NotificationMention    = "mention"
+
+	NotificationJoinRequestDecided = "join_request_decided"
+	NotificationConsultation       = "consultation"
+
+	NotificationConsultationReminder = "consultation_reminder"
+	NotificationNewReview            = "new_review"
+)
+
+// Notification is a single entry in a user's or professional's in-app inbox.
+// Exactly one of UserID and ProfID is set.
+type Notification struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID    int                `json:"profID,omitempty" bson:"profID,omitempty"`
+	ActorID   string             `json:"actorID,omitempty" bson:"actorID,omitempty"`
+	Type      string             `json:"type" bson:"type"`
+	BoardID   int                `json:"boardID,omitempty" bson:"boardID,omitempty"`
+	PostID    int                `json:"postID,omitempty" bson:"postID,omitempty"`
+	CommentID int                `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	RequestID int                `json:"requestID,omitempty" bson:"requestID,omitempty"`
+	Message   string             `json:"message" bson:"message"`
+	Read      bool               `json:"read" bson:"read"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
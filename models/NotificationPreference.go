@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification channels.
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+)
+
+// NotificationPreference lists the channels a user or professional wants
+// reminders on. Exactly one of UserID and ProfID is set. Without a saved
+// preference, reminders are sent in-app only.
+type NotificationPreference struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"userID,omitempty" bson:"userID,omitempty"`
+	ProfID    int                `json:"profID,omitempty" bson:"profID,omitempty"`
+	Channels  []string           `json:"channels" bson:"channels"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
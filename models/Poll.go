@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Poll limits.
+const (
+	MinPollOptions        = 2
+	MaxPollOptions        = 10
+	MaxPollQuestionLength = 200
+	MaxPollOptionLength   = 100
+)
+
+// Poll is an optional question attached to a post. Vote counts are kept on
+// the poll but only shown to people who have voted, or to everyone once the
+// poll has closed.
+type Poll struct {
+	Question       string       `json:"question" bson:"question"`
+	Options        []PollOption `json:"options" bson:"options"`
+	MultipleChoice bool         `json:"multipleChoice" bson:"multipleChoice"`
+	// ClosesAt is when voting ends. A zero ClosesAt leaves the poll open until
+	// its author or a moderator closes it.
+	ClosesAt    time.Time `json:"closesAt,omitempty" bson:"closesAt,omitempty"`
+	Closed      bool      `json:"closed" bson:"closed"`
+	TotalVoters int       `json:"totalVoters" bson:"totalVoters"`
+
+	// Voted, MyVote and ResultsHidden describe the poll for the caller and are never stored.
+	Voted         bool  `json:"voted" bson:"-"`
+	MyVote        []int `json:"myVote,omitempty" bson:"-"`
+	ResultsHidden bool  `json:"resultsHidden" bson:"-"`
+}
+
+// PollOption is one answer in a poll. IDs count up from 1 in the order the
+// options were given.
+type PollOption struct {
+	ID    int    `json:"id" bson:"id"`
+	Text  string `json:"text" bson:"text"`
+	Votes int    `json:"votes" bson:"votes"`
+}
+
+// PollVote records a user's answer to a poll. Each user votes once per poll.
+type PollVote struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PostID    int                `json:"postID" bson:"postID"`
+	UserID    string             `json:"userID" bson:"userID"`
+	OptionIDs []int              `json:"optionIDs" bson:"optionIDs"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// ProfessionalBadge marks content written by a verified healthcare professional.
+// It is only ever set by the server from the author's professional record.
+type ProfessionalBadge struct {
+	ProfID      int    `json:"profID" bson:"profID"`
+	Name        string `json:"name" bson:"name"`
+	Credentials string `json:"credentials" bson:"credentials"`
+}
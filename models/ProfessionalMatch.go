@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Match factors, naming what a MatchReason was awarded for.
+const (
+	MatchSkill         = "skill"
+	MatchGender        = "gender"
+	MatchProximity     = "proximity"
+	MatchAvailability  = "availability"
+	MatchCommunication = "communication"
+	MatchRating        = "rating"
+	MatchVerified      = "verified"
+)
+
+// ProfessionalMatch is a consultant recommended for a consultation, with the
+// reasons they were ranked where they are.
+type ProfessionalMatch struct {
+	ProfID             int                `json:"profID"`
+	Name               string             `json:"name"`
+	Handle             string             `json:"handle,omitempty"`
+	Badge              *ProfessionalBadge `json:"badge,omitempty"`
+	Gender             string             `json:"gender,omitempty"`
+	Suburb             string             `json:"suburb,omitempty"`
+	State              string             `json:"state,omitempty"`
+	Skills             []string           `json:"skills"`
+	CommunicationTypes []string           `json:"communicationTypes,omitempty"`
+	RatingAverage      float64            `json:"ratingAverage,omitempty"`
+	RatingCount        int                `json:"ratingCount,omitempty"`
+	NextSlot           *time.Time         `json:"nextSlot,omitempty"`
+	Score              int                `json:"score"`
+	Reasons            []MatchReason      `json:"reasons"`
+}
+
+// MatchReason explains part of a match's score.
+type MatchReason struct {
+	Factor  string `json:"factor"`
+	Points  int    `json:"points"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// ProfessionalProfile is the public view of a healthcare professional, without
+// their contact or business details.
+type ProfessionalProfile struct {
+	ProfID             int                `json:"profID"`
+	Name               string             `json:"name"`
+	Handle             string             `json:"handle,omitempty"`
+	Badge              *ProfessionalBadge `json:"badge,omitempty"`
+	ProfBio            string             `json:"profBio,omitempty"`
+	Gender             string             `json:"gender,omitempty"`
+	IsConsultant       bool               `json:"isConsultant"`
+	CommunicationTypes []string           `json:"communicationTypes,omitempty"`
+	RatingAverage      float64            `json:"ratingAverage"`
+	RatingCount        int                `json:"ratingCount"`
+	// RatingBreakdown counts the visible reviews by stars, 1 to 5.
+	RatingBreakdown map[int]int `json:"ratingBreakdown"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxReviewLength is the longest review or reply that can be written.
+const MaxReviewLength = 2000
+
+// Review is a user's rating of a professional after a completed
+// consultation, with an optional public reply from the professional. Each
+// consultation can be reviewed once. Reviews are shown under the reviewer's
+// first name only. Hidden reviews are left out of listings and of the
+// professional's rating.
+type Review struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	RequestID  int                `json:"requestID" bson:"requestID"`
+	UserID     string             `json:"-" bson:"userID"`
+	AuthorName string             `json:"authorName" bson:"authorName"`
+	ProfID     int                `json:"profID" bson:"profID"`
+	Rating     int                `json:"rating" bson:"rating"`
+	Text       string             `json:"text,omitempty" bson:"text,omitempty"`
+	Reply      string             `json:"reply,omitempty" bson:"reply,omitempty"`
+	RepliedAt  time.Time          `json:"repliedAt,omitempty" bson:"repliedAt,omitempty"`
+	Hidden     bool               `json:"hidden,omitempty" bson:"hidden"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+}
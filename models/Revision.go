@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Revision is a superseded version of a post or comment's content.
+// CommentID is zero for revisions of the post itself.
+type Revision struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PostID     int                `json:"postID" bson:"postID"`
+	CommentID  int                `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	Content    string             `json:"content" bson:"content"`
+	WrittenAt  time.Time          `json:"writtenAt" bson:"writtenAt"`
+	ReplacedAt time.Time          `json:"replacedAt" bson:"replacedAt"`
+}
+
+// Diff operations.
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffOp is one run of a word-level diff between two revisions.
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
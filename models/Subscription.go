@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Subscription links a user to a post or a board they want to hear about.
+// Exactly one of PostID and BoardID is set.
+type Subscription struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string             `json:"userID" bson:"userID"`
+	PostID    int                `json:"postID,omitempty" bson:"postID,omitempty"`
+	BoardID   int                `json:"boardID,omitempty" bson:"boardID,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
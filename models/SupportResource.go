@@ -0,0 +1,10 @@
+package models
+
+// SupportResource is a crisis or support service shown alongside content
+// that may indicate someone is at risk.
+type SupportResource struct {
+	Name        string `json:"name"`
+	Phone       string `json:"phone,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxTagsPerPost bounds how many tags one post can carry.
+const MaxTagsPerPost = 5
+
+// MaxTagLength is the longest tag name, in characters.
+const MaxTagLength = 32
+
+// Tag is a label posts can be browsed by. Names are lowercase words joined
+// by hyphens, e.g. "second-trimester". Curated tags are picked by moderators
+// and suggested ahead of free-form ones.
+type Tag struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Curated   bool               `json:"curated" bson:"curated"`
+	PostCount int                `json:"postCount" bson:"postCount"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -2,10 +2,17 @@ package models
 
 import "time"
 
+// Limits on forum text, in characters.
+const (
+    MaxForumTitleLength   = 200
+    MaxForumContentLength = 10000
+)
+
 type Forum struct {
-    ID        string    `json:"id,omitempty" bson:"_id,omitempty"`
-    Title     string    `json:"title" bson:"title"`
-    Content   string    `json:"content" bson:"content"`
-    UserID    string    `json:"user_id" bson:"user_id"`
-    CreatedAt time.Time `json:"created_at" bson:"created_at"`
+    ID          string    `json:"id,omitempty" bson:"_id,omitempty"`
+    Title       string    `json:"title" bson:"title"`
+    Content     string    `json:"content" bson:"content"`
+    ContentHTML string    `json:"content_html" bson:"content_html"`
+    UserID      string    `json:"user_id" bson:"user_id"`
+    CreatedAt   time.Time `json:"created_at" bson:"created_at"`
 }
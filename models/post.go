@@ -1,13 +1,47 @@
 package models // Post represents the post entity.
 import "time"
 
+// MaxPostContentLength is the longest post, in characters of Markdown source.
+const MaxPostContentLength = 10000
+
+// MaxPinnedPosts bounds how many posts can be pinned on one board.
+const MaxPinnedPosts = 5
+
 type Post struct {
 	PostID           int       `json:"postID" bson:"postID"`
 	BoardID          int       `json:"boardID" bson:"boardID"`
-	UserID           int       `json:"userID" bson:"userID"`
+	UserID           string    `json:"userID" bson:"userID"`
 	ProfID           int       `json:"profID,omitempty" bson:"profID,omitempty"`
 	Content          string    `json:"content" bson:"content"`
+	ContentHTML      string    `json:"contentHTML" bson:"contentHTML"`
 	CreationDateTime time.Time `json:"creationDateTime" bson:"creationDateTime"`
 	EditDateTime     time.Time `json:"editDateTime,omitempty" bson:"editDateTime,omitempty"`
-	NumOfReplies     int       `json:"numOfReplies,omitempty" bson:"numOfReplies,omitempty"`
+	Edited           bool      `json:"edited" bson:"edited"`
+	NumOfReplies     int       `json:"numOfReplies" bson:"numOfReplies"`
+
+	// LastActivityAt is when the post was created or last commented on.
+	LastActivityAt time.Time `json:"lastActivityAt" bson:"lastActivityAt"`
+	// HotScore ranks the "hot" feed; see hotScore in the handlers package.
+	HotScore float64 `json:"-" bson:"hotScore"`
+
+	AcceptedCommentID     int  `json:"acceptedCommentID,omitempty" bson:"acceptedCommentID,omitempty"`
+	HasProfessionalAnswer bool `json:"hasProfessionalAnswer" bson:"hasProfessionalAnswer"`
+
+	Tags     []string  `json:"tags" bson:"tags"`
+	Mentions []Mention `json:"mentions,omitempty" bson:"mentions,omitempty"`
+
+	// Attachments are the hex IDs of images uploaded with the post.
+	Attachments []string `json:"attachments,omitempty" bson:"attachments,omitempty"`
+
+	Poll *Poll `json:"poll,omitempty" bson:"poll,omitempty"`
+
+	// Pinned posts are picked by moderators and shown first on their board.
+	Pinned   bool      `json:"pinned" bson:"pinned,omitempty"`
+	PinnedAt time.Time `json:"pinnedAt,omitempty" bson:"pinnedAt,omitempty"`
+
+	Anonymous bool   `json:"anonymous" bson:"anonymous"`
+	Pseudonym string `json:"pseudonym,omitempty" bson:"pseudonym,omitempty"`
+
+	// SupportResources is only set on write responses when crisis language was detected.
+	SupportResources []SupportResource `json:"supportResources,omitempty" bson:"-"`
 }
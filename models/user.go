@@ -1,7 +1,16 @@
 package models
 
+import "time"
+
+// User roles. Regular members have no role.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	ID                string `json:"id,omitempty" bson:"_id,omitempty"`
+	Handle            string `json:"handle,omitempty" bson:"handle,omitempty"`
 	FirstName         string `json:"firstname" bson:"firstname"`
 	LastName          string `json:"lastname" bson:"lastname"`
 	Email             string `json:"email" bson:"email"`
@@ -9,4 +18,8 @@ type User struct {
 	UserBio           string `json:"userbio" bson:"userbio"`
 	PassHash          string `json:"passhash" bson:"passhash"`
 	IsExpectingMother bool   `json:"isexpectingmother" bson:"isexpectingmother"`
+	Role              string `json:"role,omitempty" bson:"role,omitempty"`
+
+	// DueDate places the user in the due-date club for that month.
+	DueDate time.Time `json:"dueDate,omitempty" bson:"dueDate,omitempty"`
 }
@@ -13,10 +13,157 @@ func SetupRoutes(app *fiber.App) {
 	// User routes
 	api.Post("/signup", handlers.CreateUser)
 	api.Post("/login", handlers.LoginUser)
+	api.Post("/professionals/login", handlers.LoginProfessional)
+	api.Put("/professionals/handle", handlers.UpdateProfessionalHandle)
+	api.Put("/professionals/consulting", handlers.UpdateConsultingProfile)
+	api.Get("/professionals/matches", handlers.GetProfessionalMatches)
 	api.Get("/user", handlers.GetUser)
 	api.Put("/users/update/:id", handlers.UpdateUser)
+	api.Put("/users/due-date", handlers.SetDueDate)
+	api.Get("/users/address", handlers.GetUserAddress)
+	api.Put("/users/address", handlers.UpdateUserAddress)
+	api.Delete("/user", handlers.DeleteAccount)
+	api.Get("/healthrecord", handlers.GetHealthRecord)
+	api.Put("/healthrecord", handlers.UpdateHealthRecord)
+	api.Get("/blocks", handlers.GetBlockedUsers)
+	api.Post("/users/:id/block", handlers.BlockUser)
+	api.Delete("/users/:id/block", handlers.UnblockUser)
 
 	// Forum routes
 	api.Post("/forums", handlers.CreateForum)
 	api.Get("/forums/:id", handlers.GetForum)
+
+	// Board routes
+	api.Get("/boards", handlers.GetBoards)
+	api.Post("/boards", handlers.CreateBoard)
+	api.Get("/boards/:id", handlers.GetBoard)
+	api.Put("/boards/:id", handlers.UpdateBoard)
+
+	// Post routes
+	api.Post("/posts", handlers.CreatePost)
+	api.Get("/posts/:id", handlers.GetPost)
+	api.Put("/posts/:id", handlers.UpdatePost)
+	api.Get("/posts/:id/revisions", handlers.GetPostRevisions)
+	api.Put("/posts/:id/accepted-answer", handlers.AcceptAnswer)
+	api.Put("/posts/:id/pin", handlers.PinPost)
+	api.Post("/posts/:id/poll/vote", handlers.VotePoll)
+	api.Post("/posts/:id/poll/close", handlers.ClosePoll)
+	api.Get("/boards/:id/posts", handlers.GetBoardPosts)
+
+	// Board membership routes
+	api.Post("/boards/:id/join", handlers.JoinBoard)
+	api.Delete("/boards/:id/join", handlers.LeaveBoard)
+	api.Get("/boards/:id/members", handlers.GetBoardMembers)
+	api.Post("/boards/:id/members", handlers.AddBoardMember)
+	api.Delete("/boards/:id/members/:memberID", handlers.RemoveBoardMember)
+	api.Get("/boards/:id/join-requests", handlers.GetJoinRequests)
+	api.Put("/boards/:id/join-requests/:requestID", handlers.DecideJoinRequest)
+
+	// Announcement routes
+	api.Get("/announcements", handlers.GetAnnouncements)
+	api.Post("/announcements", handlers.CreateAnnouncement)
+	api.Delete("/announcements/:id", handlers.DeleteAnnouncement)
+	api.Post("/announcements/:id/dismiss", handlers.DismissAnnouncement)
+
+	// Tag routes
+	api.Get("/tags", handlers.SearchTags)
+	api.Post("/tags", handlers.CreateTag)
+	api.Get("/tags/trending", handlers.GetTrendingTags)
+	api.Get("/tags/:name/posts", handlers.GetTagFeed)
+	api.Post("/tags/:name/merge", handlers.MergeTag)
+	api.Put("/tags/:name", handlers.RenameTag)
+
+	// Feed routes
+	api.Get("/feed", handlers.GetHomeFeed)
+	api.Get("/boards/:id/feed", handlers.GetBoardFeed)
+
+	// Attachment routes
+	api.Post("/attachments", handlers.UploadAttachment)
+	api.Get("/attachments/:id", handlers.GetAttachment)
+	api.Get("/attachments/:id/thumbnail", handlers.GetAttachmentThumbnail)
+	api.Delete("/attachments/:id", handlers.DeleteAttachment)
+
+	// Comment routes
+	api.Post("/comments", handlers.CreateComment)
+	api.Get("/comments/:id", handlers.GetComment)
+	api.Put("/comments/:id", handlers.UpdateComment)
+	api.Delete("/comments/:id", handlers.DeleteComment)
+	api.Get("/comments/:id/revisions", handlers.GetCommentRevisions)
+
+	// Consultation request routes
+	api.Get("/consultationrequests", handlers.GetConsultationRequests)
+	api.Post("/consultationrequests", handlers.CreateConsultationRequest)
+	api.Get("/consultationrequests/:id", handlers.GetConsultationRequest)
+	api.Put("/consultationrequests/:id/status", handlers.UpdateConsultationStatus)
+	api.Get("/consultationrequests/:id/calendar", handlers.GetConsultationCalendar)
+	api.Get("/consultationrequests/:id/notes", handlers.GetConsultationNotes)
+	api.Post("/consultationrequests/:id/notes", handlers.CreateConsultationNote)
+	api.Get("/consultationrequests/:id/notes/:noteID", handlers.GetConsultationNote)
+	api.Post("/consultationrequests/:id/notes/:noteID/amendments", handlers.AmendConsultationNote)
+	api.Get("/consultationrequests/:id/chat", handlers.UpgradeConsultationChat, handlers.ConsultationChat)
+	api.Get("/consultationrequests/:id/messages", handlers.GetChatMessages)
+	api.Get("/consultationrequests/:id/call", handlers.UpgradeConsultationCall, handlers.ConsultationCall)
+
+	// Calendar feed routes
+	api.Post("/calendar/feed", handlers.CreateCalendarFeed)
+	api.Delete("/calendar/feed", handlers.DeleteCalendarFeed)
+	api.Get("/calendar/feeds/:token", handlers.GetCalendarFeed)
+
+	// Availability routes
+	api.Put("/professionals/availability", handlers.SetAvailability)
+	api.Get("/professionals/availability/exceptions", handlers.GetAvailabilityExceptions)
+	api.Post("/professionals/availability/exceptions", handlers.CreateAvailabilityException)
+	api.Delete("/professionals/availability/exceptions/:id", handlers.DeleteAvailabilityException)
+	api.Get("/professionals/:id/availability", handlers.GetAvailability)
+	api.Get("/professionals/:id/slots", handlers.GetSlots)
+	api.Get("/professionals/:id", handlers.GetProfessionalProfile)
+
+	// Review routes
+	api.Post("/consultationrequests/:id/review", handlers.CreateReview)
+	api.Get("/professionals/:id/reviews", handlers.GetProfessionalReviews)
+	api.Put("/reviews/:id/reply", handlers.ReplyToReview)
+	api.Put("/reviews/:id/hide", handlers.HideReview)
+	api.Put("/reviews/:id/unhide", handlers.UnhideReview)
+
+	// Health journal routes
+	api.Get("/journals", handlers.GetJournalEntries)
+	api.Post("/journals", handlers.CreateJournalEntry)
+	api.Get("/journals/:id", handlers.GetJournalEntry)
+	api.Put("/journals/:id", handlers.UpdateJournalEntry)
+	api.Delete("/journals/:id", handlers.DeleteJournalEntry)
+
+	// Subscription routes
+	api.Get("/subscriptions", handlers.GetSubscriptions)
+	api.Post("/posts/:id/subscribe", handlers.SubscribePost)
+	api.Delete("/posts/:id/subscribe", handlers.UnsubscribePost)
+	api.Post("/boards/:id/subscribe", handlers.SubscribeBoard)
+	api.Delete("/boards/:id/subscribe", handlers.UnsubscribeBoard)
+
+	// Bookmark routes
+	api.Get("/bookmarks", handlers.GetBookmarks)
+	api.Post("/bookmarks", handlers.CreateBookmark)
+	api.Get("/bookmarks/collections", handlers.GetBookmarkCollections)
+	api.Post("/bookmarks/collections", handlers.CreateBookmarkCollection)
+	api.Put("/bookmarks/collections/:id", handlers.RenameBookmarkCollection)
+	api.Delete("/bookmarks/collections/:id", handlers.DeleteBookmarkCollection)
+	api.Delete("/bookmarks/:id", handlers.DeleteBookmark)
+
+	// Notification routes
+	api.Get("/notifications", handlers.GetNotifications)
+	api.Get("/notifications/unread-count", handlers.GetUnreadNotificationCount)
+	api.Put("/notifications/read-all", handlers.MarkAllNotificationsRead)
+	api.Get("/notifications/preferences", handlers.GetNotificationPreferences)
+	api.Put("/notifications/preferences", handlers.UpdateNotificationPreferences)
+	api.Put("/notifications/:id/read", handlers.MarkNotificationRead)
+
+	// Moderation routes
+	api.Post("/moderation/anonymous-author", handlers.RevealAnonymousAuthor)
+	api.Get("/moderation/audit-logs", handlers.GetAuditLogs)
+	api.Get("/moderation/queue", handlers.GetModerationQueue)
+	api.Put("/moderation/queue/:id/resolve", handlers.ResolveModerationFlag)
+
+	// Encryption key routes
+	api.Post("/admin/keys/rotate", handlers.RotateMasterKey)
+	api.Post("/admin/keys/users/:id/rotate", handlers.RotateUserDataKey)
+	api.Post("/admin/encryption/backfill", handlers.BackfillEncryption)
 }
@@ -0,0 +1,202 @@
+// Package crisis scans user-written text for language suggesting self-harm,
+// perinatal distress or domestic violence, and picks the support services
+// to show in response.
+//
+// Rules are loaded from JSON. The built-in set can be replaced by pointing
+// the CRISIS_RULES_FILE environment variable at a file with the same shape
+// as default_rules.json.
+package crisis
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"gofiber-mongodb/models"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//go:embed default_rules.json
+var defaultRules []byte
+
+// Rule matches text containing any of its phrases or patterns.
+// Phrases match whole words, ignoring case and punctuation; patterns are
+// regular expressions applied to the lower-cased text.
+type Rule struct {
+	ID       string   `json:"id"`
+	Category string   `json:"category"`
+	Priority int      `json:"priority"`
+	Phrases  []string `json:"phrases"`
+	Patterns []string `json:"patterns"`
+}
+
+// Config is the on-disk rule set.
+type Config struct {
+	Rules     []Rule                              `json:"rules"`
+	Resources map[string][]models.SupportResource `json:"resources"`
+}
+
+// Match is a rule that fired.
+type Match struct {
+	RuleID   string
+	Category string
+	Priority int
+}
+
+// Engine is a compiled rule set. It is safe for concurrent use.
+type Engine struct {
+	rules     []compiledRule
+	resources map[string][]models.SupportResource
+}
+
+type compiledRule struct {
+	Rule
+	phrases  []string
+	patterns []*regexp.Regexp
+}
+
+// New compiles cfg into an Engine.
+func New(cfg Config) (*Engine, error) {
+	engine := &Engine{resources: cfg.Resources}
+
+	for _, rule := range cfg.Rules {
+		compiled := compiledRule{Rule: rule}
+		for _, phrase := range rule.Phrases {
+			if normalized := normalize(phrase); normalized != " " {
+				compiled.phrases = append(compiled.phrases, normalized)
+			}
+		}
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+			compiled.patterns = append(compiled.patterns, re)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	return engine, nil
+}
+
+// Load reads and compiles the rule set at path, or the built-in rules if path is empty.
+func Load(path string) (*Engine, error) {
+	data := defaultRules
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	return New(cfg)
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultEngine *Engine
+)
+
+// Default returns the engine configured by CRISIS_RULES_FILE, falling back
+// to the built-in rules if that file cannot be loaded.
+func Default() *Engine {
+	defaultOnce.Do(func() {
+		var err error
+		defaultEngine, err = Load(os.Getenv("CRISIS_RULES_FILE"))
+		if err != nil {
+			log.Printf("Failed to load crisis rules, using built-in rules: %s", err)
+			defaultEngine, _ = Load("")
+		}
+	})
+	return defaultEngine
+}
+
+// Scan returns the rules matched by any of texts, highest priority first.
+func (e *Engine) Scan(texts ...string) []Match {
+	var normalized, lowered []string
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		normalized = append(normalized, normalize(text))
+		lowered = append(lowered, strings.ToLower(text))
+	}
+
+	var matches []Match
+	for _, rule := range e.rules {
+		if rule.matches(normalized, lowered) {
+			matches = append(matches, Match{RuleID: rule.ID, Category: rule.Category, Priority: rule.Priority})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Priority > matches[j].Priority })
+	return matches
+}
+
+func (r compiledRule) matches(normalized, lowered []string) bool {
+	for _, text := range normalized {
+		for _, phrase := range r.phrases {
+			if strings.Contains(text, phrase) {
+				return true
+			}
+		}
+	}
+	for _, text := range lowered {
+		for _, re := range r.patterns {
+			if re.MatchString(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Resources returns the support services for the categories in matches, without duplicates.
+func (e *Engine) Resources(matches []Match) []models.SupportResource {
+	var resources []models.SupportResource
+	seen := map[string]bool{}
+	for _, match := range matches {
+		for _, resource := range e.resources[match.Category] {
+			if !seen[resource.Name] {
+				seen[resource.Name] = true
+				resources = append(resources, resource)
+			}
+		}
+	}
+	return resources
+}
+
+// normalize lower-cases text, drops apostrophes and turns every other
+// non-alphanumeric run into a single space, padding both ends so phrases
+// can be matched on word boundaries with strings.Contains.
+func normalize(text string) string {
+	var b strings.Builder
+	b.WriteByte(' ')
+	space := true
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r == '\'' || r == '’':
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	if !space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
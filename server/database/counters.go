@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// seededCounters remembers the counters this process has already seeded.
+var seededCounters sync.Map
+
+// NextID allocates the next integer ID for name, e.g. "postID", from the
+// counters collection. IDs used to be the creation time in Unix seconds, so a
+// counter starts at the time it is first used to stay clear of those.
+func NextID(ctx context.Context, name string) (int, error) {
+	counters := GetCollection("counters")
+
+	if _, seeded := seededCounters.Load(name); !seeded {
+		seed := bson.M{"$setOnInsert": bson.M{"seq": time.Now().Unix()}}
+		if _, err := counters.UpdateOne(ctx, bson.M{"_id": name}, seed, options.Update().SetUpsert(true)); err != nil {
+			return 0, err
+		}
+		seededCounters.Store(name, true)
+	}
+
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := counters.FindOneAndUpdate(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+	return counter.Seq, err
+}
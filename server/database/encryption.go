@@ -0,0 +1,358 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gofiber-mongodb/server/kms"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sensitive fields are encrypted with a data key belonging to the user the
+// data is about. Data keys are stored wrapped by a master key from the KMS,
+// in their own database so they can be kept out of the main database's
+// backups. Destroying a user's data keys leaves everything encrypted under
+// them unreadable, backups included.
+
+// encryptedPrefix marks an encrypted field. The full form is
+// "enc:v1:<data key version>:<base64 ciphertext>". Values without it are
+// plaintext written before encryption was added and are read as they are.
+const encryptedPrefix = "enc:v1:"
+
+// ErrDataKeyDestroyed is returned when reading data whose owner's key has
+// been destroyed, or writing data for them afterwards.
+var ErrDataKeyDestroyed = errors.New("data key has been destroyed")
+
+// destroyedVersion is the version of the tombstone left in place of a
+// destroyed owner's keys. It sorts above every real version, so looking up
+// the current key finds it first.
+const destroyedVersion = math.MaxInt32
+
+var keyManager kms.KeyManager
+
+// Encrypted is implemented by documents with fields that are stored encrypted.
+type Encrypted interface {
+	// EncryptionOwner is the ID of the user whose data key protects the document.
+	EncryptionOwner() string
+	// EncryptedFields points at the fields to encrypt and decrypt.
+	EncryptedFields() []*string
+}
+
+// dataKey is one version of a user's data key, wrapped by a master key.
+type dataKey struct {
+	OwnerID     string    `bson:"ownerID"`
+	Version     int       `bson:"version"`
+	WrappedKey  []byte    `bson:"wrappedKey"`
+	MasterKeyID string    `bson:"masterKeyID"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	// Destroyed marks the tombstone of an owner whose keys were destroyed.
+	Destroyed bool `bson:"destroyed,omitempty"`
+}
+
+// ConnectKMS opens the master keys. KMS_MASTER_KEYS gives them directly, as
+// described at kms.ParseStatic. Otherwise KMS_KEY_FILE names a local key file
+// for development, which is created on first use. It is never created while
+// wrapped data keys exist, as a fresh master key could not unwrap them and
+// everyone's data would be lost.
+func ConnectKMS() {
+	if config := os.Getenv("KMS_MASTER_KEYS"); config != "" {
+		manager, err := kms.ParseStatic(config)
+		if err != nil {
+			log.Fatalf("Error reading KMS_MASTER_KEYS: %s", err)
+		}
+		keyManager = manager
+		return
+	}
+
+	path := os.Getenv("KMS_KEY_FILE")
+	if path == "" {
+		path = "kms-keys.json"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	wrapped, err := keyCollection().CountDocuments(ctx, bson.M{"destroyed": bson.M{"$ne": true}})
+	if err != nil {
+		log.Fatalf("Error counting data keys: %s", err)
+	}
+
+	manager, err := kms.OpenLocalFile(path, wrapped == 0)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("KMS key file %s is missing but %d data keys are wrapped by it; restore it or set KMS_MASTER_KEYS", path, wrapped)
+	}
+	if err != nil {
+		log.Fatalf("Error opening KMS key file: %s", err)
+	}
+	keyManager = manager
+}
+
+// keyCollection holds the wrapped data keys. KEY_DATABASE names its database.
+func keyCollection() *mongo.Collection {
+	name := os.Getenv("KEY_DATABASE")
+	if name == "" {
+		name = "my-pregnancy-keys"
+	}
+	return MongoClient.Database(name).Collection("dataKeys")
+}
+
+// currentDataKey returns the newest version of owner's data key, creating
+// the first one if they have none. It returns ErrDataKeyDestroyed once the
+// owner's keys have been destroyed, so nothing new is written for them.
+func currentDataKey(ctx context.Context, owner string) (int, []byte, error) {
+	if owner == "" {
+		return 0, nil, errors.New("encrypted data needs an owner")
+	}
+
+	var stored dataKey
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := keyCollection().FindOne(ctx, bson.M{"ownerID": owner}, opts).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return addDataKey(ctx, owner, 1)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if stored.Destroyed {
+		return 0, nil, ErrDataKeyDestroyed
+	}
+
+	key, err := keyManager.Unwrap(stored.WrappedKey, stored.MasterKeyID)
+	return stored.Version, key, err
+}
+
+// addDataKey stores a new version of owner's data key. If another request
+// added that version first, theirs is used instead.
+func addDataKey(ctx context.Context, owner string, version int) (int, []byte, error) {
+	key, err := kms.NewKey()
+	if err != nil {
+		return 0, nil, err
+	}
+	wrapped, masterKeyID, err := keyManager.Wrap(key)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, err = keyCollection().InsertOne(ctx, dataKey{
+		OwnerID:     owner,
+		Version:     version,
+		WrappedKey:  wrapped,
+		MasterKeyID: masterKeyID,
+		CreatedAt:   time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		key, err = dataKeyVersion(ctx, owner, version)
+		return version, key, err
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The owner's keys may have been destroyed since the caller looked, so take
+	// this one back rather than let it outlive them
+	err = keyCollection().FindOne(ctx, bson.M{"ownerID": owner, "destroyed": true}).Err()
+	if err == nil {
+		if _, err := keyCollection().DeleteOne(ctx, bson.M{"ownerID": owner, "version": version}); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, ErrDataKeyDestroyed
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil, err
+	}
+	return version, key, nil
+}
+
+// dataKeyVersion returns one version of owner's data key.
+func dataKeyVersion(ctx context.Context, owner string, version int) ([]byte, error) {
+	var stored dataKey
+	err := keyCollection().FindOne(ctx, bson.M{"ownerID": owner, "version": version}).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Encrypted data only refers to keys that existed, so a missing one was destroyed
+		return nil, ErrDataKeyDestroyed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.Destroyed {
+		return nil, ErrDataKeyDestroyed
+	}
+	return keyManager.Unwrap(stored.WrappedKey, stored.MasterKeyID)
+}
+
+// Encrypt encrypts doc's encrypted fields in place under the current version
+// of its owner's data key. Empty and already encrypted fields are left alone.
+func Encrypt(ctx context.Context, doc Encrypted) error {
+	owner := doc.EncryptionOwner()
+
+	var version int
+	var key []byte
+	for _, field := range doc.EncryptedFields() {
+		if *field == "" || strings.HasPrefix(*field, encryptedPrefix) {
+			continue
+		}
+		if key == nil {
+			var err error
+			if version, key, err = currentDataKey(ctx, owner); err != nil {
+				return err
+			}
+		}
+
+		// The owner is bound into the ciphertext so it cannot be passed off as someone else's
+		ciphertext, err := kms.Encrypt(key, []byte(*field), []byte(owner))
+		if err != nil {
+			return err
+		}
+		*field = fmt.Sprintf("%s%d:%s", encryptedPrefix, version, base64.StdEncoding.EncodeToString(ciphertext))
+	}
+	return nil
+}
+
+// Decrypt decrypts doc's encrypted fields in place. It returns
+// ErrDataKeyDestroyed if the owner's key has been destroyed.
+func Decrypt(ctx context.Context, doc Encrypted) error {
+	owner := doc.EncryptionOwner()
+
+	keys := map[int][]byte{}
+	for _, field := range doc.EncryptedFields() {
+		if !strings.HasPrefix(*field, encryptedPrefix) {
+			continue
+		}
+
+		versionText, encoded, ok := strings.Cut(strings.TrimPrefix(*field, encryptedPrefix), ":")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil {
+			return errors.New("malformed encrypted field")
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+
+		key, ok := keys[version]
+		if !ok {
+			if key, err = dataKeyVersion(ctx, owner, version); err != nil {
+				return err
+			}
+			keys[version] = key
+		}
+
+		// A key that cannot open the data is not the one it was written with,
+		// which happens when the owner's keys were destroyed and the version
+		// handed out again before tombstones were kept
+		plaintext, err := kms.Decrypt(key, ciphertext, []byte(owner))
+		if err != nil {
+			return ErrDataKeyDestroyed
+		}
+		*field = string(plaintext)
+	}
+	return nil
+}
+
+// Unencrypted is a query condition matching a text field that holds
+// plaintext: set, not empty and not yet encrypted.
+func Unencrypted() bson.M {
+	return bson.M{
+		"$exists": true,
+		"$ne":     "",
+		"$not":    primitive.Regex{Pattern: "^" + encryptedPrefix},
+	}
+}
+
+// Erase overwrites doc's non-empty encrypted fields with a marker that
+// decrypts as ErrDataKeyDestroyed. It is for plaintext left behind by an
+// owner whose keys are gone, which can no longer be encrypted.
+func Erase(doc Encrypted) {
+	for _, field := range doc.EncryptedFields() {
+		if *field != "" {
+			*field = fmt.Sprintf("%s%d:", encryptedPrefix, destroyedVersion)
+		}
+	}
+}
+
+// RotateDataKey starts a new version of owner's data key. New writes use it;
+// data already written stays readable under the older versions.
+func RotateDataKey(ctx context.Context, owner string) (int, error) {
+	var stored dataKey
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := keyCollection().FindOne(ctx, bson.M{"ownerID": owner}, opts).Decode(&stored)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+	if stored.Destroyed {
+		return 0, ErrDataKeyDestroyed
+	}
+
+	version, _, err := addDataKey(ctx, owner, stored.Version+1)
+	return version, err
+}
+
+// RotateMasterKey makes a new master key current and rewraps every data key
+// under it. It returns the new master key's ID and how many data keys were
+// rewrapped.
+func RotateMasterKey(ctx context.Context) (string, int, error) {
+	masterKeyID, err := keyManager.Rotate()
+	if err != nil {
+		return "", 0, err
+	}
+
+	collection := keyCollection()
+	cursor, err := collection.Find(ctx, bson.M{"masterKeyID": bson.M{"$ne": masterKeyID}, "destroyed": bson.M{"$ne": true}})
+	if err != nil {
+		return masterKeyID, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	rewrapped := 0
+	for cursor.Next(ctx) {
+		var stored dataKey
+		if err := cursor.Decode(&stored); err != nil {
+			return masterKeyID, rewrapped, err
+		}
+
+		key, err := keyManager.Unwrap(stored.WrappedKey, stored.MasterKeyID)
+		if err != nil {
+			return masterKeyID, rewrapped, err
+		}
+		wrapped, newID, err := keyManager.Wrap(key)
+		if err != nil {
+			return masterKeyID, rewrapped, err
+		}
+
+		// Matching on the old master key leaves alone a key that was destroyed or rewrapped meanwhile
+		filter := bson.M{"ownerID": stored.OwnerID, "version": stored.Version, "masterKeyID": stored.MasterKeyID}
+		update := bson.M{"$set": bson.M{"wrappedKey": wrapped, "masterKeyID": newID}}
+		if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+			return masterKeyID, rewrapped, err
+		}
+		rewrapped++
+	}
+	return masterKeyID, rewrapped, cursor.Err()
+}
+
+// DestroyDataKeys deletes every version of owner's data key, making all
+// data encrypted for them unreadable. A tombstone is left in their place so
+// no new key is ever made for the owner.
+func DestroyDataKeys(ctx context.Context, owner string) error {
+	collection := keyCollection()
+
+	// The tombstone goes in first, so a write racing the deletion cannot start a new key
+	tombstone := bson.M{"$setOnInsert": bson.M{"destroyed": true, "createdAt": time.Now()}}
+	filter := bson.M{"ownerID": owner, "version": destroyedVersion}
+	if _, err := collection.UpdateOne(ctx, filter, tombstone, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+
+	_, err := collection.DeleteMany(ctx, bson.M{"ownerID": owner, "destroyed": bson.M{"$ne": true}})
+	return err
+}
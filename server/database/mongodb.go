@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -39,6 +41,115 @@ func ConnectDB() {
 	MongoClient = client
 }
 
+// EnsureIndexes creates the indexes the handlers rely on for uniqueness.
+func EnsureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Integer IDs come from counters, and the indexes make sure no two documents ever share one
+	for name, key := range map[string]string{
+		"posts":                "postID",
+		"comments":             "commentID",
+		"boards":               "boardID",
+		"journals":             "journalID",
+		"consultationrequests": "requestID",
+	} {
+		idIndex := mongo.IndexModel{
+			Keys:    bson.D{{Key: key, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}
+		if _, err := GetCollection(name).Indexes().CreateOne(ctx, idIndex); err != nil {
+			log.Printf("Failed to create %s index on %s: %s", key, name, err)
+		}
+	}
+
+	// Handles are optional, so only documents that have one must be unique
+	handleIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "handle", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"handle": bson.M{"$exists": true}}),
+	}
+
+	for _, name := range []string{"users", "professionals"} {
+		if _, err := GetCollection(name).Indexes().CreateOne(ctx, handleIndex); err != nil {
+			log.Printf("Failed to create handle index on %s: %s", name, err)
+		}
+	}
+
+	// One due-date club per month, even when two people are first to join at once
+	cohortIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "cohortMonth", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"cohortMonth": bson.M{"$exists": true}}),
+	}
+	if _, err := GetCollection("boards").Indexes().CreateOne(ctx, cohortIndex); err != nil {
+		log.Printf("Failed to create cohort index on boards: %s", err)
+	}
+
+	// One vote per user per poll
+	voteIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "postID", Value: 1}, {Key: "userID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := GetCollection("pollVotes").Indexes().CreateOne(ctx, voteIndex); err != nil {
+		log.Printf("Failed to create vote index on pollVotes: %s", err)
+	}
+
+	// One calendar per professional, so every booking bumps the same version
+	availabilityIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "profID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := GetCollection("availability").Indexes().CreateOne(ctx, availabilityIndex); err != nil {
+		log.Printf("Failed to create profID index on availability: %s", err)
+	}
+
+	// Calendar feeds are looked up by token alone
+	feedIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := GetCollection("calendarFeeds").Indexes().CreateOne(ctx, feedIndex); err != nil {
+		log.Printf("Failed to create token index on calendarFeeds: %s", err)
+	}
+
+	// One pending job per key, so scheduling a job again moves it instead of adding another
+	jobIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": "pending"}),
+	}
+	if _, err := GetCollection("jobs").Indexes().CreateOne(ctx, jobIndex); err != nil {
+		log.Printf("Failed to create key index on jobs: %s", err)
+	}
+
+	// One review per consultation
+	reviewIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "requestID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := GetCollection("reviews").Indexes().CreateOne(ctx, reviewIndex); err != nil {
+		log.Printf("Failed to create requestID index on reviews: %s", err)
+	}
+
+	// One data key per owner and version, so concurrent first writes share a key
+	keyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "ownerID", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := keyCollection().Indexes().CreateOne(ctx, keyIndex); err != nil {
+		log.Printf("Failed to create owner index on dataKeys: %s", err)
+	}
+}
+
+// GetBucket opens a GridFS bucket for storing files.
+func GetBucket(name string) (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(MongoClient.Database("my-pregnancy-dev"), options.GridFSBucket().SetName(name))
+}
+
 func GetCollection(collectionName string) *mongo.Collection {
 	return MongoClient.Database("my-pregnancy-dev").Collection(collectionName)
 }
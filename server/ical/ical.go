@@ -0,0 +1,140 @@
+// Package ical writes RFC 5545 iCalendar data for calendar downloads and
+// subscription feeds.
+//
+// Event times are always written in UTC. Calendar clients convert them to
+// the viewer's own time zone, so no VTIMEZONE components are needed and an
+// event keeps the same instant whichever zone the organiser works in.
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProdID identifies this application as the producer of the calendar data.
+const ProdID = "-//MyPregnancy//Consultations//EN"
+
+// Event statuses.
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// maxLineOctets is the longest a content line may be before it is folded.
+const maxLineOctets = 75
+
+const utcLayout = "20060102T150405Z"
+
+// Event is a single VEVENT.
+//
+// UID must stay the same for the life of the event and Sequence must grow
+// every time it is changed, so clients that already have the event replace
+// it instead of adding a copy.
+type Event struct {
+	UID          string
+	Sequence     int
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	Status       string
+	LastModified time.Time
+}
+
+// Calendar is a VCALENDAR holding a list of events.
+type Calendar struct {
+	// Name is shown by clients that subscribe to the calendar.
+	Name string
+	// Method is set for one-off downloads, e.g. "PUBLISH", and left empty for
+	// subscription feeds.
+	Method string
+	Events []Event
+}
+
+// Render returns the calendar as iCalendar text.
+func (cal Calendar) Render() string {
+	var b strings.Builder
+
+	writeLine(&b, "BEGIN:VCALENDAR")
+	writeLine(&b, "VERSION:2.0")
+	writeLine(&b, "PRODID:"+ProdID)
+	writeLine(&b, "CALSCALE:GREGORIAN")
+	if cal.Method != "" {
+		writeLine(&b, "METHOD:"+cal.Method)
+	}
+	if cal.Name != "" {
+		writeLine(&b, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+
+	for _, event := range cal.Events {
+		stamp := event.LastModified
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+
+		writeLine(&b, "BEGIN:VEVENT")
+		writeLine(&b, "UID:"+event.UID)
+		writeLine(&b, fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+		writeLine(&b, "DTSTAMP:"+formatTime(stamp))
+		writeLine(&b, "LAST-MODIFIED:"+formatTime(stamp))
+		writeLine(&b, "DTSTART:"+formatTime(event.Start))
+		writeLine(&b, "DTEND:"+formatTime(event.End))
+		writeLine(&b, "SUMMARY:"+escapeText(event.Summary))
+		if event.Description != "" {
+			writeLine(&b, "DESCRIPTION:"+escapeText(event.Description))
+		}
+		if event.Location != "" {
+			writeLine(&b, "LOCATION:"+escapeText(event.Location))
+		}
+		if event.Status != "" {
+			writeLine(&b, "STATUS:"+event.Status)
+		}
+		writeLine(&b, "END:VEVENT")
+	}
+
+	writeLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// formatTime writes t as a UTC date-time.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(utcLayout)
+}
+
+// escapeText escapes a TEXT property value.
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// writeLine writes a content line, folding it onto continuation lines so no
+// line is longer than maxLineOctets. Folds never split a UTF-8 character.
+func writeLine(b *strings.Builder, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines lose one octet to the leading space
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
@@ -0,0 +1,161 @@
+package ical
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares got with testdata/name, or rewrites the file with -update.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file\ngot:\n%q\nwant:\n%q", name, got, want)
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "short line",
+			line: "SUMMARY:Consultation",
+			want: "SUMMARY:Consultation\r\n",
+		},
+		{
+			name: "exactly 75 octets",
+			line: strings.Repeat("a", 75),
+			want: strings.Repeat("a", 75) + "\r\n",
+		},
+		{
+			name: "76 octets",
+			line: strings.Repeat("a", 76),
+			want: strings.Repeat("a", 75) + "\r\n a\r\n",
+		},
+		{
+			name: "continuation lines hold 74 octets after the space",
+			line: strings.Repeat("a", 75+74+1),
+			want: strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n a\r\n",
+		},
+		{
+			name: "two-octet rune across the fold",
+			line: strings.Repeat("a", 74) + "é",
+			want: strings.Repeat("a", 74) + "\r\n é\r\n",
+		},
+		{
+			name: "three-octet rune across the fold",
+			line: strings.Repeat("a", 73) + "€b",
+			want: strings.Repeat("a", 73) + "\r\n €b\r\n",
+		},
+		{
+			name: "four-octet rune across the fold",
+			line: strings.Repeat("a", 72) + "🤰b",
+			want: strings.Repeat("a", 72) + "\r\n 🤰b\r\n",
+		},
+		{
+			name: "rune ending exactly at the fold",
+			line: strings.Repeat("a", 73) + "éb",
+			want: strings.Repeat("a", 73) + "é\r\n b\r\n",
+		},
+		{
+			name: "rune across the fold of a continuation line",
+			line: strings.Repeat("a", 75) + strings.Repeat("b", 73) + "€",
+			want: strings.Repeat("a", 75) + "\r\n " + strings.Repeat("b", 73) + "\r\n €\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			writeLine(&b, tt.line)
+			got := b.String()
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+			for _, line := range lines {
+				if len(line) > maxLineOctets {
+					t.Errorf("line %q is %d octets", line, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %q splits a character", line)
+				}
+			}
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(got, "\r\n"), "\r\n ", ""); unfolded != tt.line {
+				t.Errorf("unfolds to %q, want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Consultation", "Consultation"},
+		{"Dr. Smith, GP", `Dr. Smith\, GP`},
+		{"Bring: notes; scans", `Bring: notes\; scans`},
+		{`C:\Users\notes`, `C:\\Users\\notes`},
+		{"first\nsecond", `first\nsecond`},
+		{"first\r\nsecond", `first\nsecond`},
+		{"first\rsecond", `first\nsecond`},
+		{`a\;b,c`, `a\\\;b\,c`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderCancelledEvent(t *testing.T) {
+	start := time.Date(2027, time.April, 4, 1, 30, 0, 0, time.FixedZone("AEDT", 11*60*60))
+	cal := Calendar{
+		Name:   "Consultations; Dr. Smith, GP",
+		Method: "PUBLISH",
+		Events: []Event{{
+			UID:          "consultation-42@mypregnancy",
+			Sequence:     3,
+			Start:        start,
+			End:          start.Add(30 * time.Minute),
+			Summary:      "Video consultation with Dr. Émilie Zoë Smith",
+			Description:  "Cancelled by the patient.\nPlease book again, or call us on ☎ 1800 000 000; we're happy to help — à bientôt.",
+			Location:     `Online\video`,
+			Status:       StatusCancelled,
+			LastModified: time.Date(2027, time.March, 30, 8, 15, 0, 0, time.UTC),
+		}},
+	}
+
+	got := cal.Render()
+	checkGolden(t, "cancelled.ics", got)
+
+	for _, want := range []string{"\r\nSEQUENCE:3\r\n", "\r\nSTATUS:CANCELLED\r\n", "\r\nDTSTART:20270403T143000Z\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("calendar is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// Package imaging cleans and thumbnails uploaded images using only the
+// standard library.
+//
+// Every image is decoded and encoded again, so nothing from the original file
+// survives except pixels: EXIF blocks (including GPS positions), comments and
+// any data appended after the image are dropped. JPEG orientation is applied
+// to the pixels first so photos taken on phones stay upright.
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxPixels bounds the decoded size of an image, so a small file cannot
+// expand into an enormous bitmap.
+const MaxPixels = 24_000_000
+
+// ThumbnailSize is the longest side of a thumbnail, in pixels.
+const ThumbnailSize = 320
+
+// Supported content types.
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	GIF  = "image/gif"
+)
+
+var (
+	ErrUnsupported = errors.New("Only JPEG, PNG and GIF images are supported")
+	ErrTooLarge    = errors.New("Image dimensions are too large")
+	ErrInvalid     = errors.New("File is not a valid image")
+)
+
+// Result is a cleaned image and its thumbnail.
+type Result struct {
+	ContentType          string
+	Data                 []byte
+	Width, Height        int
+	Thumbnail            []byte
+	ThumbnailContentType string
+}
+
+// Process validates data as an image, strips its metadata and builds a thumbnail.
+// The content type is sniffed from the data; whatever the client claimed is ignored.
+func Process(data []byte) (Result, error) {
+	var result Result
+
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case JPEG, PNG, GIF:
+	default:
+		return result, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return result, ErrInvalid
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return result, ErrTooLarge
+	}
+
+	result.ContentType = contentType
+
+	var buf bytes.Buffer
+	var first image.Image
+
+	switch contentType {
+	case GIF:
+		// Keep every frame of an animation; extension blocks are not written back.
+		// The frames are counted before decoding so a long animation of small
+		// frames is turned away without allocating any of them.
+		if err := checkGIFFrames(data); err != nil {
+			return result, err
+		}
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return result, ErrInvalid
+		}
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return result, err
+		}
+		first = anim.Image[0]
+
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return result, ErrInvalid
+		}
+
+		rgba := toRGBA(img)
+		if contentType == JPEG {
+			rgba = orient(rgba, jpegOrientation(data))
+			err = jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, rgba)
+		}
+		if err != nil {
+			return result, err
+		}
+		first = rgba
+	}
+
+	result.Data = buf.Bytes()
+	result.Width, result.Height = first.Bounds().Dx(), first.Bounds().Dy()
+
+	thumb := thumbnail(toRGBA(first), ThumbnailSize)
+	buf = bytes.Buffer{}
+	if contentType == JPEG {
+		result.ThumbnailContentType = JPEG
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		// PNG keeps transparency that JPEG would turn black
+		result.ThumbnailContentType = PNG
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Thumbnail = buf.Bytes()
+
+	return result, nil
+}
+
+// checkGIFFrames walks the blocks of a GIF without decoding any pixels and
+// returns ErrTooLarge as soon as its frames add up to more than MaxPixels.
+func checkGIFFrames(data []byte) error {
+	const (
+		extension  = 0x21
+		descriptor = 0x2C
+		trailer    = 0x3B
+	)
+
+	// colorTable returns the size of the color table a packed field announces
+	colorTable := func(packed byte) int {
+		if packed&0x80 == 0 {
+			return 0
+		}
+		return 3 << (packed&0x07 + 1)
+	}
+
+	// skipSubBlocks returns the offset just past the data sub-blocks at i
+	skipSubBlocks := func(i int) (int, error) {
+		for {
+			if i >= len(data) {
+				return 0, ErrInvalid
+			}
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return i, nil
+			}
+			i += size
+		}
+	}
+
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return ErrInvalid
+	}
+	i := 13 + colorTable(data[10])
+
+	pixels := 0
+	for {
+		if i >= len(data) {
+			return ErrInvalid
+		}
+
+		var err error
+		switch data[i] {
+		case extension:
+			if i, err = skipSubBlocks(i + 2); err != nil {
+				return err
+			}
+
+		case descriptor:
+			if i+10 > len(data) {
+				return ErrInvalid
+			}
+			width := int(binary.LittleEndian.Uint16(data[i+5:]))
+			height := int(binary.LittleEndian.Uint16(data[i+7:]))
+			pixels += width * height
+			if pixels > MaxPixels {
+				return ErrTooLarge
+			}
+
+			// Skip the local color table and the LZW code size before the image data
+			i += 10 + colorTable(data[i+9]) + 1
+			if i, err = skipSubBlocks(i); err != nil {
+				return err
+			}
+
+		case trailer:
+			return nil
+
+		default:
+			return ErrInvalid
+		}
+	}
+}
+
+// toRGBA copies img into a premultiplied RGBA bitmap anchored at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// thumbnail scales img down so its longest side is at most size, averaging
+// the source pixels under each output pixel. Small images are returned as is.
+func thumbnail(img *image.RGBA, size int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, max(1, h*size/w)
+	if h > w {
+		tw, th = max(1, w*size/h), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := ty*h/th, max((ty+1)*h/th, ty*h/th+1)
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := tx*w/tw, max((tx+1)*w/tw, tx*w/tw+1)
+
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				row := img.Pix[y*img.Stride:]
+				for x := x0; x < x1; x++ {
+					for i := 0; i < 4; i++ {
+						sum[i] += int(row[x*4+i])
+					}
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			off := ty*dst.Stride + tx*4
+			for i := 0; i < 4; i++ {
+				dst.Pix[off+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) to img.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // turn 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // turn 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // turn 90° counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:][:4], img.Pix[sy*img.Stride+sx*4:][:4])
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG, or returns 1.
+func jpegOrientation(data []byte) int {
+	const orientationTag = 0x0112
+
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the marker segments up to the start of the image data
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		i += 2 + length
+
+		if marker != 0xE1 || len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+			continue
+		}
+
+		tiff := segment[6:]
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 1
+		}
+
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for e := 0; e < entries; e++ {
+			entry := ifd + 2 + e*12
+			if entry+12 > len(tiff) {
+				return 1
+			}
+			if order.Uint16(tiff[entry:]) == orientationTag {
+				return int(order.Uint16(tiff[entry+8:]))
+			}
+		}
+		return 1
+	}
+
+	return 1
+}
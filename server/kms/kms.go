@@ -0,0 +1,258 @@
+// Package kms protects data keys with master keys for envelope encryption.
+//
+// Data is encrypted with data keys, and only wrapped (encrypted) copies of
+// the data keys are stored; the master keys that wrap them never leave the
+// KeyManager. Static takes its master keys from configuration. LocalFile
+// keeps them in a JSON file and is meant for development. A hosted KMS can
+// stand in for either behind the same interface.
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeySize is the length of master and data keys, for AES-256.
+const KeySize = 32
+
+// ErrUnknownKey is returned when unwrapping under a master key the manager does not hold.
+var ErrUnknownKey = errors.New("kms: unknown master key")
+
+// KeyManager wraps and unwraps data keys.
+type KeyManager interface {
+	// Wrap encrypts dataKey under the current master key and returns the ID of that master key.
+	Wrap(dataKey []byte) (wrapped []byte, masterKeyID string, err error)
+	// Unwrap decrypts a data key wrapped under the named master key.
+	Unwrap(wrapped []byte, masterKeyID string) ([]byte, error)
+	// Rotate makes a new master key current. Older master keys stay available to Unwrap.
+	Rotate() (masterKeyID string, err error)
+}
+
+// NewKey returns a random key of KeySize bytes.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypt seals plaintext with AES-GCM under key, binding it to aad. The
+// random nonce is prefixed to the result.
+func Encrypt(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// Decrypt opens ciphertext produced by Encrypt with the same key and aad.
+func Decrypt(key, ciphertext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("kms: ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Static is a KeyManager whose master keys are given in configuration.
+type Static struct {
+	current string
+	keys    map[string][]byte
+}
+
+// ParseStatic reads master keys written as "id:base64key", separated by
+// commas. The first key is current; the others are older keys kept so data
+// keys wrapped under them can still be unwrapped.
+func ParseStatic(config string) (*Static, error) {
+	s := &Static{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(config, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, errors.New("kms: master keys must be written as id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("kms: master key %s: %w", id, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("kms: master key %s must be %d bytes", id, KeySize)
+		}
+		if _, ok := s.keys[id]; ok {
+			return nil, fmt.Errorf("kms: master key %s is given twice", id)
+		}
+		if s.current == "" {
+			s.current = id
+		}
+		s.keys[id] = key
+	}
+	return s, nil
+}
+
+// Wrap implements KeyManager.
+func (s *Static) Wrap(dataKey []byte) ([]byte, string, error) {
+	wrapped, err := Encrypt(s.keys[s.current], dataKey, []byte(s.current))
+	return wrapped, s.current, err
+}
+
+// Unwrap implements KeyManager.
+func (s *Static) Unwrap(wrapped []byte, masterKeyID string) ([]byte, error) {
+	master, ok := s.keys[masterKeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return Decrypt(master, wrapped, []byte(masterKeyID))
+}
+
+// Rotate implements KeyManager. Static keys are rotated by putting a new key
+// first in the configuration, so Rotate only returns the current one, and
+// rotating rewraps the data keys still under older ones.
+func (s *Static) Rotate() (string, error) {
+	return s.current, nil
+}
+
+// localKeyFile is the on-disk form of a LocalFile. Keys are base64 encoded by encoding/json.
+type localKeyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// LocalFile is a KeyManager whose master keys live in a JSON file.
+type LocalFile struct {
+	mu   sync.RWMutex
+	path string
+	file localKeyFile
+}
+
+// OpenLocalFile loads the master keys in path. If the file does not exist
+// yet, it is created with a first master key when create is set, and an
+// error is returned otherwise.
+func OpenLocalFile(path string, create bool) (*LocalFile, error) {
+	l := &LocalFile{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		l.file.Keys = map[string][]byte{}
+		if _, err := l.Rotate(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &l.file); err != nil {
+		return nil, fmt.Errorf("kms: reading %s: %w", path, err)
+	}
+	if _, ok := l.file.Keys[l.file.Current]; !ok {
+		return nil, fmt.Errorf("kms: %s has no current master key", path)
+	}
+	return l, nil
+}
+
+// Wrap implements KeyManager.
+func (l *LocalFile) Wrap(dataKey []byte) ([]byte, string, error) {
+	l.mu.RLock()
+	id := l.file.Current
+	master := l.file.Keys[id]
+	l.mu.RUnlock()
+
+	wrapped, err := Encrypt(master, dataKey, []byte(id))
+	return wrapped, id, err
+}
+
+// Unwrap implements KeyManager.
+func (l *LocalFile) Unwrap(wrapped []byte, masterKeyID string) ([]byte, error) {
+	l.mu.RLock()
+	master, ok := l.file.Keys[masterKeyID]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return Decrypt(master, wrapped, []byte(masterKeyID))
+}
+
+// Rotate implements KeyManager. The new key is written to the file before
+// it is used.
+func (l *LocalFile) Rotate() (string, error) {
+	key, err := NewKey()
+	if err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	id := "mk-" + time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	next := localKeyFile{Current: id, Keys: map[string][]byte{id: key}}
+	for existing, k := range l.file.Keys {
+		next.Keys[existing] = k
+	}
+	if err := writeKeyFile(l.path, next); err != nil {
+		return "", err
+	}
+	l.file = next
+	return id, nil
+}
+
+// writeKeyFile replaces the key file at path in one step, so a crash cannot
+// leave it half written.
+func writeKeyFile(path string, file localKeyFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".kms-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,63 @@
+// Package mailer sends plain text email through an SMTP server.
+//
+// The server is set with SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM. Without SMTP_HOST email is switched off and
+// Send fails with ErrNotConfigured.
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotConfigured is returned by Send when no SMTP server is set.
+var ErrNotConfigured = errors.New("email is not configured")
+
+// Configured reports whether an SMTP server is set.
+func Configured() bool {
+	return os.Getenv("SMTP_HOST") != ""
+}
+
+// Send emails body to the address to.
+func Send(to, subject, body string) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return ErrNotConfigured
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USERNAME")
+	}
+
+	// Reject header injection through the addresses
+	if strings.ContainsAny(to+from, "\r\n") {
+		return errors.New("invalid email address")
+	}
+
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(net.JoinHostPort(host, port), auth, from, []string{to}, []byte(msg.String()))
+}
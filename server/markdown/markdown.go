@@ -0,0 +1,188 @@
+// Package markdown renders the small Markdown dialect used for forum and
+// journal text into sanitized HTML.
+//
+// The dialect supports paragraphs, line breaks, **bold**, *italic*, bullet
+// and numbered lists, > quotes, [text](url) links and bare http(s) URLs.
+// Everything else is treated as plain text: raw HTML tags are dropped, script
+// and style blocks are removed with their contents, and all remaining text is
+// escaped, so the output can only ever contain the tags produced here.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxQuoteDepth bounds how deeply quotes may nest.
+const maxQuoteDepth = 3
+
+var (
+	unsafeBlock = regexp.MustCompile(`(?is)<(script|style|iframe|object|embed)\b.*?</(script|style|iframe|object|embed)\s*>`)
+	htmlTag     = regexp.MustCompile(`(?s)<!--.*?-->|</?[a-zA-Z][^<>]*>`)
+
+	bulletItem   = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	numberedItem = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	quoteLine    = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+
+	link     = regexp.MustCompile(`\[([^\[\]\n]+)\]\(([^()\s]+)\)|https?://[^\s<>"]+`)
+	strong   = regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`)
+	emphasis = regexp.MustCompile(`\*([^*\n]+)\*|(^|[^\w])_([^_\n]+)_([^\w]|$)`)
+)
+
+// Render converts src to sanitized HTML.
+func Render(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = unsafeBlock.ReplaceAllString(src, "")
+	src = htmlTag.ReplaceAllString(src, "")
+
+	return renderBlocks(strings.Split(src, "\n"), 0)
+}
+
+// renderBlocks renders a run of lines as paragraphs, lists and quotes.
+func renderBlocks(lines []string, depth int) string {
+	var out strings.Builder
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case quoteLine.MatchString(line):
+			var inner []string
+			for ; i < len(lines) && quoteLine.MatchString(lines[i]); i++ {
+				inner = append(inner, quoteLine.FindStringSubmatch(lines[i])[1])
+			}
+			out.WriteString("<blockquote>")
+			if depth < maxQuoteDepth {
+				out.WriteString(renderBlocks(inner, depth+1))
+			} else {
+				out.WriteString(renderParagraph(inner))
+			}
+			out.WriteString("</blockquote>")
+
+		case bulletItem.MatchString(line):
+			i = renderList(&out, lines, i, bulletItem, "ul")
+
+		case numberedItem.MatchString(line):
+			i = renderList(&out, lines, i, numberedItem, "ol")
+
+		default:
+			var paragraph []string
+			for ; i < len(lines) && startsParagraphLine(lines[i]); i++ {
+				paragraph = append(paragraph, lines[i])
+			}
+			out.WriteString(renderParagraph(paragraph))
+		}
+	}
+
+	return out.String()
+}
+
+// startsParagraphLine reports whether line continues a plain paragraph.
+func startsParagraphLine(line string) bool {
+	return strings.TrimSpace(line) != "" &&
+		!quoteLine.MatchString(line) &&
+		!bulletItem.MatchString(line) &&
+		!numberedItem.MatchString(line)
+}
+
+// renderList writes the list starting at lines[i] and returns the index after it.
+func renderList(out *strings.Builder, lines []string, i int, item *regexp.Regexp, tag string) int {
+	out.WriteString("<" + tag + ">")
+	for ; i < len(lines) && item.MatchString(lines[i]); i++ {
+		out.WriteString("<li>")
+		out.WriteString(renderInline(item.FindStringSubmatch(lines[i])[1]))
+		out.WriteString("</li>")
+	}
+	out.WriteString("</" + tag + ">")
+	return i
+}
+
+// renderParagraph joins lines into a paragraph with explicit line breaks.
+func renderParagraph(lines []string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = renderInline(strings.TrimSpace(line))
+	}
+	return "<p>" + strings.Join(rendered, "<br>") + "</p>"
+}
+
+// renderInline renders links and emphasis within a single line.
+func renderInline(text string) string {
+	var out strings.Builder
+
+	last := 0
+	for _, m := range link.FindAllStringSubmatchIndex(text, -1) {
+		out.WriteString(renderEmphasis(text[last:m[0]]))
+		last = m[1]
+
+		// Markdown link: [label](target)
+		if m[2] >= 0 {
+			label, target := text[m[2]:m[3]], text[m[4]:m[5]]
+			if href, ok := safeURL(target); ok {
+				out.WriteString(anchor(href, renderEmphasis(label)))
+			} else {
+				out.WriteString(renderEmphasis(label))
+			}
+			continue
+		}
+
+		// Bare URL, minus any trailing punctuation that belongs to the sentence
+		raw := text[m[0]:m[1]]
+		trimmed := strings.TrimRight(raw, ".,;:!?)'")
+		if href, ok := safeURL(trimmed); ok {
+			out.WriteString(anchor(href, html.EscapeString(trimmed)))
+		} else {
+			out.WriteString(html.EscapeString(trimmed))
+		}
+		out.WriteString(html.EscapeString(raw[len(trimmed):]))
+	}
+	out.WriteString(renderEmphasis(text[last:]))
+
+	return out.String()
+}
+
+// renderEmphasis escapes text and applies bold and italic markers.
+func renderEmphasis(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = strong.ReplaceAllString(escaped, "<strong>$1$2</strong>")
+	return emphasis.ReplaceAllStringFunc(escaped, func(match string) string {
+		m := emphasis.FindStringSubmatch(match)
+		if m[1] != "" {
+			return "<em>" + m[1] + "</em>"
+		}
+		return m[2] + "<em>" + m[3] + "</em>" + m[4]
+	})
+}
+
+// anchor builds a link that search engines and the target page cannot exploit.
+func anchor(href, label string) string {
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow ugc noopener noreferrer">` + label + `</a>`
+}
+
+// safeURL accepts only absolute http, https and mailto URLs.
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	return u.String(), true
+}
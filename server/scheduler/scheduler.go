@@ -0,0 +1,237 @@
+// Package scheduler runs background jobs stored in MongoDB.
+//
+// Jobs live in the jobs collection, so they survive restarts. Any number of
+// server instances can run the scheduler at once: each job is claimed with a
+// single atomic update and leased for a while, and a job whose instance dies
+// mid-run is picked up again once its lease runs out. Handlers should
+// therefore be safe to run more than once for the same job.
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"gofiber-mongodb/server/database"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Job statuses.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+const (
+	// pollInterval is how often an idle scheduler looks for due jobs.
+	pollInterval = 15 * time.Second
+	// leaseDuration is how long a claimed job is held before another instance may retry it.
+	leaseDuration = 2 * time.Minute
+	// maxAttempts is how many times a job is tried before it is marked failed.
+	maxAttempts = 5
+	// retryDelay is the wait before the first retry. It doubles with each attempt.
+	retryDelay = time.Minute
+)
+
+// Job is one scheduled piece of work.
+//
+// Key names the job for rescheduling and cancelling, e.g.
+// "consultation-42-24h"; at most one pending job can have a given key.
+type Job struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type        string             `json:"type" bson:"type"`
+	Key         string             `json:"key" bson:"key"`
+	Data        bson.M             `json:"data,omitempty" bson:"data,omitempty"`
+	RunAt       time.Time          `json:"runAt" bson:"runAt"`
+	Status      string             `json:"status" bson:"status"`
+	Attempts    int                `json:"attempts" bson:"attempts"`
+	LockedBy    string             `json:"lockedBy,omitempty" bson:"lockedBy,omitempty"`
+	LockedUntil time.Time          `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"`
+	LastError   string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Handler runs a job of one type.
+type Handler func(ctx context.Context, job Job) error
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string]Handler{}
+
+	// instanceID tells this process's leases apart from other instances'.
+	instanceID = newInstanceID()
+)
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return primitive.NewObjectID().Hex()
+	}
+	return hex.EncodeToString(b)
+}
+
+func jobs() *mongo.Collection {
+	return database.GetCollection("jobs")
+}
+
+// Register sets the handler for jobs of the given type.
+func Register(jobType string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[jobType] = handler
+}
+
+// Schedule adds a job to run at job.RunAt, or moves the pending job with the
+// same key to the new time and data.
+func Schedule(ctx context.Context, job Job) error {
+	now := time.Now()
+	filter := bson.M{"key": job.Key, "status": StatusPending}
+	update := bson.M{
+		"$set": bson.M{
+			"type":      job.Type,
+			"data":      job.Data,
+			"runAt":     job.RunAt,
+			"attempts":  0,
+			"updatedAt": now,
+		},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+
+	_, err := jobs().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Another instance inserted the same key at the same moment; move theirs instead
+		_, err = jobs().UpdateOne(ctx, filter, update)
+	}
+	return err
+}
+
+// Cancel cancels the pending jobs with the given keys. Jobs already running
+// are left to finish.
+func Cancel(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	filter := bson.M{"key": bson.M{"$in": keys}, "status": StatusPending}
+	update := bson.M{"$set": bson.M{"status": StatusCancelled, "updatedAt": time.Now()}}
+	_, err := jobs().UpdateMany(ctx, filter, update)
+	return err
+}
+
+// Run claims and runs due jobs for the life of the server, so start it with go.
+func Run() {
+	for {
+		// Work through everything that is due before sleeping again
+		for {
+			ran, err := runNext()
+			if err != nil {
+				log.Printf("Scheduler failed to run a job: %s", err)
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// claim takes the next due job, or one whose lease ran out, for this
+// instance. It returns mongo.ErrNoDocuments when nothing is due.
+func claim(ctx context.Context) (Job, error) {
+	now := time.Now()
+	filter := bson.M{
+		"$or": []bson.M{
+			{"status": StatusPending, "runAt": bson.M{"$lte": now}},
+			{"status": StatusRunning, "lockedUntil": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      StatusRunning,
+			"lockedBy":    instanceID,
+			"lockedUntil": now.Add(leaseDuration),
+			"updatedAt":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "runAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job Job
+	err := jobs().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+// runNext runs one due job. It reports whether there was one.
+func runNext() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseDuration)
+	defer cancel()
+
+	job, err := claim(ctx)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	mu.RLock()
+	handler, ok := handlers[job.Type]
+	mu.RUnlock()
+
+	var runErr error
+	if !ok {
+		runErr = errors.New("no handler for job type " + job.Type)
+	} else {
+		runErr = handler(ctx, job)
+	}
+
+	return true, finish(ctx, job, runErr)
+}
+
+// finish records the outcome of a job run, scheduling a retry after a
+// failure until the job runs out of attempts. Only the instance holding the
+// lease can record it.
+func finish(ctx context.Context, job Job, runErr error) error {
+	now := time.Now()
+	set := bson.M{"updatedAt": now, "lastError": ""}
+
+	switch {
+	case runErr == nil:
+		set["status"] = StatusDone
+	case job.Attempts >= maxAttempts:
+		log.Printf("Job %s (%s) failed for good: %s", job.Key, job.Type, runErr)
+		set["status"] = StatusFailed
+		set["lastError"] = runErr.Error()
+	default:
+		set["status"] = StatusPending
+		set["runAt"] = now.Add(retryDelay << (job.Attempts - 1))
+		set["lastError"] = runErr.Error()
+	}
+
+	update := bson.M{
+		"$set":   set,
+		"$unset": bson.M{"lockedBy": "", "lockedUntil": ""},
+	}
+	_, err := jobs().UpdateOne(ctx, bson.M{"_id": job.ID, "lockedBy": instanceID, "status": StatusRunning}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		// The job was rescheduled while running, and the new pending copy takes over
+		_, err = jobs().UpdateOne(ctx, bson.M{"_id": job.ID, "lockedBy": instanceID}, bson.M{
+			"$set":   bson.M{"status": StatusCancelled, "updatedAt": now},
+			"$unset": bson.M{"lockedBy": "", "lockedUntil": ""},
+		})
+	}
+	return err
+}